@@ -0,0 +1,104 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// Format is an archive format detected from the content of a file
+type Format string
+
+const (
+	FormatTar     Format = "tar"
+	FormatTarGz   Format = "tar.gz"
+	FormatTarXz   Format = "tar.xz"
+	FormatTarBz2  Format = "tar.bz2"
+	FormatTarZstd Format = "tar.zst"
+	FormatZip     Format = "zip"
+)
+
+var (
+	magicGzip  = []byte{0x1f, 0x8b}
+	magicXz    = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+	magicBzip2 = []byte{'B', 'Z', 'h'}
+	magicZstd  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	magicZip   = []byte{'P', 'K', 0x03, 0x04}
+	magicEmpty = []byte{'P', 'K', 0x05, 0x06}
+	magicUstar = []byte("ustar")
+)
+
+// tarMagicOffset is where the "ustar" magic lives in a tar header
+const tarMagicOffset = 257
+
+// DetectFormat identifies the archive format of a file by its magic bytes,
+// regardless of its extension.
+func DetectFormat(path string) (Format, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer f.Close()
+
+	header := make([]byte, tarMagicOffset+len(magicUstar))
+	n, err := io.ReadFull(f, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", fmt.Errorf("failed to read archive: %w", err)
+	}
+	return detect(header[:n])
+}
+
+func detect(header []byte) (Format, error) {
+	switch {
+	case bytes.HasPrefix(header, magicGzip):
+		return FormatTarGz, nil
+	case bytes.HasPrefix(header, magicXz):
+		return FormatTarXz, nil
+	case bytes.HasPrefix(header, magicBzip2):
+		return FormatTarBz2, nil
+	case bytes.HasPrefix(header, magicZstd):
+		return FormatTarZstd, nil
+	case bytes.HasPrefix(header, magicZip), bytes.HasPrefix(header, magicEmpty):
+		return FormatZip, nil
+	case len(header) >= tarMagicOffset+len(magicUstar) &&
+		bytes.Equal(header[tarMagicOffset:tarMagicOffset+len(magicUstar)], magicUstar):
+		return FormatTar, nil
+	default:
+		return "", fmt.Errorf("unrecognized archive format")
+	}
+}
+
+// decompress wraps r with the decompressor of a tar based format
+func decompress(format Format, r io.Reader) (io.ReadCloser, error) {
+	buffered := bufio.NewReader(r)
+
+	switch format {
+	case FormatTar:
+		return io.NopCloser(buffered), nil
+	case FormatTarGz:
+		return gzip.NewReader(buffered)
+	case FormatTarXz:
+		xzReader, err := xz.NewReader(buffered)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(xzReader), nil
+	case FormatTarBz2:
+		return io.NopCloser(bzip2.NewReader(buffered)), nil
+	case FormatTarZstd:
+		zstdReader, err := zstd.NewReader(buffered)
+		if err != nil {
+			return nil, err
+		}
+		return zstdReader.IOReadCloser(), nil
+	default:
+		return nil, fmt.Errorf("%s is not a tar based format", format)
+	}
+}
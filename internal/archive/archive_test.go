@@ -0,0 +1,289 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+type tarEntry struct {
+	header  tar.Header
+	content string
+}
+
+func buildTar(t *testing.T, entries []tarEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := tar.NewWriter(&buf)
+	for _, e := range entries {
+		h := e.header
+		if h.Typeflag == tar.TypeReg {
+			h.Size = int64(len(e.content))
+		}
+		if h.Mode == 0 {
+			h.Mode = 0644
+		}
+		if err := w.WriteHeader(&h); err != nil {
+			t.Fatal(err)
+		}
+		if e.content != "" {
+			if _, err := w.Write([]byte(e.content)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func sourceTree() []tarEntry {
+	return []tarEntry{
+		{header: tar.Header{Name: "pkg-1.0/", Typeflag: tar.TypeDir, Mode: 0755}},
+		{header: tar.Header{Name: "pkg-1.0/configure", Typeflag: tar.TypeReg, Mode: 0755}, content: "#!/bin/sh\n"},
+		{header: tar.Header{Name: "pkg-1.0/include/pkg.h", Typeflag: tar.TypeReg}, content: "#pragma once\n"},
+		{header: tar.Header{Name: "pkg-1.0/include/alias.h", Typeflag: tar.TypeSymlink, Linkname: "pkg.h"}},
+	}
+}
+
+func compress(t *testing.T, format Format, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	var err error
+	switch format {
+	case FormatTar:
+		return data
+	case FormatTarGz:
+		w = gzip.NewWriter(&buf)
+	case FormatTarXz:
+		w, err = xz.NewWriter(&buf)
+	case FormatTarZstd:
+		w, err = zstd.NewWriter(&buf)
+	case FormatTarBz2:
+		if _, err := exec.LookPath("bzip2"); err != nil {
+			t.Skip("bzip2 is not available")
+		}
+		cmd := exec.Command("bzip2", "-c")
+		cmd.Stdin = bytes.NewReader(data)
+		out, err := cmd.Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func writeArchive(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestExtractFormats(t *testing.T) {
+	for _, format := range []Format{FormatTar, FormatTarGz, FormatTarXz, FormatTarBz2, FormatTarZstd} {
+		t.Run(string(format), func(t *testing.T) {
+			// The extension is deliberately misleading, detection uses magic bytes
+			path := writeArchive(t, "source.bin", compress(t, format, buildTar(t, sourceTree())))
+
+			detected, err := DetectFormat(path)
+			if err != nil || detected != format {
+				t.Fatalf("expected %s, detected %s (%v)", format, detected, err)
+			}
+
+			dest := t.TempDir()
+			if err := Extract(path, dest, Options{StripComponents: 1}); err != nil {
+				t.Fatalf("Extract failed: %v", err)
+			}
+
+			info, err := os.Stat(filepath.Join(dest, "configure"))
+			if err != nil {
+				t.Fatalf("configure was not extracted: %v", err)
+			}
+			if info.Mode().Perm() != 0755 {
+				t.Errorf("permissions not preserved: %v", info.Mode().Perm())
+			}
+
+			link, err := os.Readlink(filepath.Join(dest, "include", "alias.h"))
+			if err != nil || link != "pkg.h" {
+				t.Errorf("symlink not preserved: %q (%v)", link, err)
+			}
+		})
+	}
+}
+
+func TestExtractZip(t *testing.T) {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	header := &zip.FileHeader{Name: "pkg-1.0/run.sh", Method: zip.Deflate}
+	header.SetMode(0755)
+	f, err := w.CreateHeader(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.Write([]byte("#!/bin/sh\n"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	path := writeArchive(t, "source.zip", buf.Bytes())
+	dest := t.TempDir()
+	if err := Extract(path, dest, Options{}); err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+
+	info, err := os.Stat(filepath.Join(dest, "pkg-1.0", "run.sh"))
+	if err != nil {
+		t.Fatalf("run.sh was not extracted: %v", err)
+	}
+	if info.Mode().Perm() != 0755 {
+		t.Errorf("permissions not preserved: %v", info.Mode().Perm())
+	}
+}
+
+func TestExtractRejectsMaliciousEntries(t *testing.T) {
+	cases := map[string][]tarEntry{
+		"traversal": {
+			{header: tar.Header{Name: "pkg/../../evil", Typeflag: tar.TypeReg}, content: "x"},
+		},
+		"absolute": {
+			{header: tar.Header{Name: "/tmp/evil", Typeflag: tar.TypeReg}, content: "x"},
+		},
+		"absolute symlink": {
+			{header: tar.Header{Name: "pkg/etc", Typeflag: tar.TypeSymlink, Linkname: "/etc"}},
+		},
+		"escaping symlink": {
+			{header: tar.Header{Name: "pkg/up", Typeflag: tar.TypeSymlink, Linkname: "../../.."}},
+		},
+		"write through symlink": {
+			{header: tar.Header{Name: "pkg/dir", Typeflag: tar.TypeSymlink, Linkname: "."}},
+			{header: tar.Header{Name: "pkg/dir/file", Typeflag: tar.TypeReg}, content: "x"},
+		},
+		"escaping hard link": {
+			{header: tar.Header{Name: "pkg/passwd", Typeflag: tar.TypeLink, Linkname: "../etc/passwd"}},
+		},
+	}
+
+	for name, entries := range cases {
+		t.Run(name, func(t *testing.T) {
+			path := writeArchive(t, "evil.tar", buildTar(t, entries))
+			parent := t.TempDir()
+			dest := filepath.Join(parent, "src")
+
+			err := Extract(path, dest, Options{})
+			if err == nil || !strings.Contains(err.Error(), "illegal") {
+				t.Fatalf("expected the archive to be rejected, got %v", err)
+			}
+			if _, err := os.Stat(filepath.Join(parent, "evil")); !os.IsNotExist(err) {
+				t.Error("archive wrote outside of the destination")
+			}
+		})
+	}
+}
+
+func TestExtractRejectsLinksThroughExtractedSymlinks(t *testing.T) {
+	// x looks like it stays in dest, but a/b leads to dest itself so x points
+	// two levels above it. The hard link and the file then truncate victim.txt
+	// through x.
+	path := writeArchive(t, "evil.tar", buildTar(t, []tarEntry{
+		{header: tar.Header{Name: "a/", Typeflag: tar.TypeDir, Mode: 0755}},
+		{header: tar.Header{Name: "a/b", Typeflag: tar.TypeSymlink, Linkname: ".."}},
+		{header: tar.Header{Name: "x", Typeflag: tar.TypeSymlink, Linkname: "a/b/../.."}},
+		{header: tar.Header{Name: "h", Typeflag: tar.TypeLink, Linkname: "x/victim.txt"}},
+		{header: tar.Header{Name: "h", Typeflag: tar.TypeReg}, content: "pwned"},
+	}))
+	outside := t.TempDir()
+	victim := filepath.Join(outside, "victim.txt")
+	if err := os.WriteFile(victim, []byte("intact"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dest := filepath.Join(outside, "one", "src")
+
+	err := Extract(path, dest, Options{})
+	if err == nil || !strings.Contains(err.Error(), "illegal") {
+		t.Errorf("expected the archive to be rejected, got %v", err)
+	}
+	if data, _ := os.ReadFile(victim); string(data) != "intact" {
+		t.Errorf("archive wrote outside of the destination: %q", data)
+	}
+
+	// Without the escaping symlink, the hard link through a/b is still
+	// refused, and the file replaces the hard link instead of writing to it
+	path = writeArchive(t, "evil.tar", buildTar(t, []tarEntry{
+		{header: tar.Header{Name: "a/", Typeflag: tar.TypeDir, Mode: 0755}},
+		{header: tar.Header{Name: "a/b", Typeflag: tar.TypeSymlink, Linkname: ".."}},
+		{header: tar.Header{Name: "h", Typeflag: tar.TypeLink, Linkname: "a/b/victim.txt"}},
+	}))
+	if err := Extract(path, t.TempDir(), Options{}); err == nil || !strings.Contains(err.Error(), "illegal") {
+		t.Errorf("expected the hard link through a symlink to be rejected, got %v", err)
+	}
+
+	dest = t.TempDir()
+	if err := os.Link(victim, filepath.Join(dest, "h")); err != nil {
+		t.Skipf("cannot create a hard link: %v", err)
+	}
+	path = writeArchive(t, "file.tar", buildTar(t, []tarEntry{
+		{header: tar.Header{Name: "h", Typeflag: tar.TypeReg}, content: "pwned"},
+	}))
+	if err := Extract(path, dest, Options{}); err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+	if data, _ := os.ReadFile(victim); string(data) != "intact" {
+		t.Errorf("file was written through an existing hard link: %q", data)
+	}
+}
+
+func TestExtractRejectsLinksRedirectedLater(t *testing.T) {
+	// s stays in dest when it is extracted, x/b only makes it escape later
+	path := writeArchive(t, "evil.tar", buildTar(t, []tarEntry{
+		{header: tar.Header{Name: "x/", Typeflag: tar.TypeDir, Mode: 0755}},
+		{header: tar.Header{Name: "s", Typeflag: tar.TypeSymlink, Linkname: "x/b/../.."}},
+		{header: tar.Header{Name: "x/b", Typeflag: tar.TypeSymlink, Linkname: ".."}},
+	}))
+	dest := filepath.Join(t.TempDir(), "one", "src")
+
+	err := Extract(path, dest, Options{})
+	if err == nil || !strings.Contains(err.Error(), "illegal") {
+		t.Errorf("expected the archive to be rejected, got %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(dest, "s")); !os.IsNotExist(err) {
+		t.Error("the escaping symlink was left in the destination")
+	}
+}
+
+func TestHasSingleTopLevelDirectory(t *testing.T) {
+	wrapped := writeArchive(t, "wrapped.tar", buildTar(t, sourceTree()))
+	if single, err := HasSingleTopLevelDirectory(wrapped); err != nil || !single {
+		t.Errorf("expected a single top-level directory (%v)", err)
+	}
+
+	flat := writeArchive(t, "flat.tar", buildTar(t, append(sourceTree(),
+		tarEntry{header: tar.Header{Name: "README", Typeflag: tar.TypeReg}, content: "x"})))
+	if single, err := HasSingleTopLevelDirectory(flat); err != nil || single {
+		t.Errorf("expected no single top-level directory (%v)", err)
+	}
+}
@@ -0,0 +1,493 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Options controls how an archive is extracted
+type Options struct {
+	// StripComponents removes that many leading path components from every
+	// entry, like tar --strip-components. Entries with fewer components are
+	// skipped.
+	StripComponents int
+}
+
+// entry is the format independent view of an archive member
+type entry struct {
+	name     string
+	mode     os.FileMode
+	modTime  time.Time
+	linkname string
+	kind     entryKind
+	open     func() (io.ReadCloser, error)
+}
+
+type entryKind int
+
+const (
+	kindFile entryKind = iota
+	kindDir
+	kindSymlink
+	kindHardlink
+	kindOther
+)
+
+// Extract unpacks the archive at archivePath into dest. The format is detected
+// from the content. Permissions and symlinks are preserved, while absolute
+// paths, ".." traversal and links pointing outside of dest are rejected so a
+// malicious archive cannot write outside the destination.
+func Extract(archivePath, dest string, opts Options) error {
+	if opts.StripComponents < 0 {
+		return fmt.Errorf("strip components must not be negative")
+	}
+
+	format, err := DetectFormat(archivePath)
+	if err != nil {
+		return fmt.Errorf("%s: %w", archivePath, err)
+	}
+
+	absDest, err := filepath.Abs(dest)
+	if err != nil {
+		return fmt.Errorf("failed to resolve destination: %w", err)
+	}
+	if err := os.MkdirAll(absDest, 0755); err != nil {
+		return fmt.Errorf("failed to create destination: %w", err)
+	}
+
+	x := &extractor{dest: absDest, strip: opts.StripComponents}
+	if format == FormatZip {
+		err = x.extractZip(archivePath)
+	} else {
+		err = x.extractTar(archivePath, format)
+	}
+	if err != nil {
+		return err
+	}
+
+	return x.finish()
+}
+
+// HasSingleTopLevelDirectory reports whether every entry of the archive lives
+// below one common directory, as in most source tarballs (e.g.
+// root-6.30.02/...). Callers usually strip that directory.
+func HasSingleTopLevelDirectory(archivePath string) (bool, error) {
+	format, err := DetectFormat(archivePath)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", archivePath, err)
+	}
+
+	top := ""
+	single := true
+	collect := func(e entry) error {
+		name := strings.TrimPrefix(path.Clean("/"+e.name), "/")
+		if name == "" || !single {
+			return nil
+		}
+		first, _, nested := strings.Cut(name, "/")
+		if !nested && e.kind != kindDir {
+			// A top-level file means there is no wrapping directory
+			single = false
+		} else if top == "" {
+			top = first
+		} else if top != first {
+			single = false
+		}
+		return nil
+	}
+
+	if format == FormatZip {
+		err = walkZip(archivePath, collect)
+	} else {
+		err = walkTar(archivePath, format, collect)
+	}
+	return single && top != "", err
+}
+
+type extractor struct {
+	dest  string
+	strip int
+	dirs  []entry
+	// links are the symlinks created, checked again once the tree is
+	// complete
+	links []entry
+}
+
+func (x *extractor) extractTar(archivePath string, format Format) error {
+	return walkTar(archivePath, format, x.extract)
+}
+
+func (x *extractor) extractZip(archivePath string) error {
+	return walkZip(archivePath, x.extract)
+}
+
+func walkTar(archivePath string, format Format, fn func(entry) error) error {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer f.Close()
+
+	r, err := decompress(format, f)
+	if err != nil {
+		return fmt.Errorf("failed to decompress archive: %w", err)
+	}
+	defer r.Close()
+
+	reader := tar.NewReader(r)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive: %w", err)
+		}
+
+		e := entry{
+			name:     header.Name,
+			mode:     header.FileInfo().Mode(),
+			modTime:  header.ModTime,
+			linkname: header.Linkname,
+			open:     func() (io.ReadCloser, error) { return io.NopCloser(reader), nil },
+		}
+		switch header.Typeflag {
+		case tar.TypeReg, tar.TypeRegA:
+			e.kind = kindFile
+		case tar.TypeDir:
+			e.kind = kindDir
+		case tar.TypeSymlink:
+			e.kind = kindSymlink
+		case tar.TypeLink:
+			e.kind = kindHardlink
+		default:
+			// Devices, fifos and pax/global headers have no place in a source tree
+			e.kind = kindOther
+		}
+
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+}
+
+func walkZip(archivePath string, fn func(entry) error) error {
+	reader, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer reader.Close()
+
+	for _, file := range reader.File {
+		file := file
+		e := entry{
+			name:    file.Name,
+			mode:    file.Mode(),
+			modTime: file.Modified,
+			open:    file.Open,
+		}
+		switch {
+		case file.Mode()&os.ModeSymlink != 0:
+			// Zip stores the target of a symlink as its content
+			e.kind = kindSymlink
+			target, err := readAll(file.Open)
+			if err != nil {
+				return fmt.Errorf("failed to read archive: %w", err)
+			}
+			e.linkname = target
+		case file.FileInfo().IsDir():
+			e.kind = kindDir
+		case file.Mode().IsRegular():
+			e.kind = kindFile
+		default:
+			e.kind = kindOther
+		}
+
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readAll(open func() (io.ReadCloser, error)) (string, error) {
+	r, err := open()
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	data, err := io.ReadAll(io.LimitReader(r, 4096))
+	return string(data), err
+}
+
+// extract writes a single entry below the destination
+func (x *extractor) extract(e entry) error {
+	if e.kind == kindOther {
+		return nil
+	}
+
+	rel, err := x.relativePath(e.name)
+	if err != nil {
+		return err
+	}
+	if rel == "" {
+		return nil
+	}
+
+	target := filepath.Join(x.dest, rel)
+	if err := x.ensureParent(target); err != nil {
+		return err
+	}
+
+	switch e.kind {
+	case kindDir:
+		if err := os.MkdirAll(target, 0755); err != nil {
+			return err
+		}
+		// Permissions are applied at the end, a read-only directory would
+		// otherwise prevent extracting its content.
+		e.name = target
+		x.dirs = append(x.dirs, e)
+		return nil
+
+	case kindFile:
+		return x.writeFile(target, e)
+
+	case kindSymlink:
+		if err := x.checkLink(target, e.linkname); err != nil {
+			return err
+		}
+		_ = os.Remove(target)
+		if err := os.Symlink(e.linkname, target); err != nil {
+			return err
+		}
+		x.links = append(x.links, entry{name: target, linkname: e.linkname})
+		return nil
+
+	case kindHardlink:
+		linkRel, err := x.relativePath(e.linkname)
+		if err != nil || linkRel == "" {
+			return fmt.Errorf("illegal hard link target %q in %q", e.linkname, e.name)
+		}
+		// os.Link follows the directories of the target, a symlink among
+		// them could make it link a file outside of dest
+		linkTarget := filepath.Join(x.dest, linkRel)
+		if err := x.checkNoSymlinks(filepath.Dir(linkTarget)); err != nil {
+			return fmt.Errorf("illegal hard link target %q in %q: %w", e.linkname, e.name, err)
+		}
+		_ = os.Remove(target)
+		return os.Link(linkTarget, target)
+	}
+
+	return nil
+}
+
+// relativePath validates an entry name and applies StripComponents. It
+// returns "" for entries that are stripped away entirely.
+func (x *extractor) relativePath(name string) (string, error) {
+	if name == "" || strings.HasPrefix(name, "/") || filepath.IsAbs(name) || strings.Contains(name, "\\") {
+		return "", fmt.Errorf("illegal absolute path in archive: %q", name)
+	}
+
+	for _, component := range strings.Split(name, "/") {
+		if component == ".." {
+			return "", fmt.Errorf("illegal path traversal in archive: %q", name)
+		}
+	}
+
+	cleaned := path.Clean(name)
+	if cleaned == "." {
+		return "", nil
+	}
+
+	components := strings.Split(cleaned, "/")
+	if len(components) <= x.strip {
+		return "", nil
+	}
+	return filepath.Join(components[x.strip:]...), nil
+}
+
+// ensureParent creates the parent directories of target and makes sure none
+// of them is a symlink, which could redirect the write outside of dest.
+func (x *extractor) ensureParent(target string) error {
+	parent := filepath.Dir(target)
+	rel, err := filepath.Rel(x.dest, parent)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return fmt.Errorf("illegal path in archive: %q", target)
+	}
+
+	current := x.dest
+	if rel == "." {
+		return nil
+	}
+	for _, component := range strings.Split(rel, string(os.PathSeparator)) {
+		current = filepath.Join(current, component)
+		info, err := os.Lstat(current)
+		if os.IsNotExist(err) {
+			if err := os.Mkdir(current, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("illegal path in archive: %q passes through a symlink", target)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("illegal path in archive: %q is not a directory", current)
+		}
+	}
+	return nil
+}
+
+// checkNoSymlinks makes sure no component of dir below dest is a symlink
+func (x *extractor) checkNoSymlinks(dir string) error {
+	rel, err := filepath.Rel(x.dest, dir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+		return fmt.Errorf("%s is outside of the destination", dir)
+	}
+	if rel == "." {
+		return nil
+	}
+
+	current := x.dest
+	for _, component := range strings.Split(rel, string(os.PathSeparator)) {
+		current = filepath.Join(current, component)
+		info, err := os.Lstat(current)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("%s is a symlink", current)
+		}
+	}
+	return nil
+}
+
+// maxLinkHops bounds the symlinks followed to resolve a link, like the
+// ELOOP limit of the kernel
+const maxLinkHops = 40
+
+// checkLink rejects symlinks that are absolute or resolve outside of dest.
+// The target is resolved against what is already extracted: ".." applies to
+// the directory a symlink leads to, not to the text before it, so
+// "a/b/../.." leaves dest when a/b is itself a link to "..".
+func (x *extractor) checkLink(target, linkname string) error {
+	if filepath.IsAbs(linkname) {
+		return fmt.Errorf("illegal absolute symlink in archive: %s -> %s", target, linkname)
+	}
+
+	current := filepath.Dir(target)
+	pending := strings.Split(linkname, "/")
+	hops := 0
+	for len(pending) > 0 {
+		component := pending[0]
+		pending = pending[1:]
+		switch component {
+		case "", ".":
+			continue
+		case "..":
+			if current == x.dest {
+				return fmt.Errorf("illegal symlink escaping destination: %s -> %s", target, linkname)
+			}
+			current = filepath.Dir(current)
+			continue
+		}
+
+		next := filepath.Join(current, component)
+		info, err := os.Lstat(next)
+		if err != nil || info.Mode()&os.ModeSymlink == 0 {
+			// Missing components cannot redirect the path (yet), a later
+			// symlink in their place is checked when it is extracted
+			current = next
+			continue
+		}
+
+		hops++
+		if hops > maxLinkHops {
+			return fmt.Errorf("illegal symlink in archive: too many levels of links in %s -> %s", target, linkname)
+		}
+		link, err := os.Readlink(next)
+		if err != nil {
+			return err
+		}
+		if filepath.IsAbs(link) {
+			return fmt.Errorf("illegal symlink escaping destination: %s -> %s", target, linkname)
+		}
+		pending = append(strings.Split(link, "/"), pending...)
+	}
+	return nil
+}
+
+func (x *extractor) writeFile(target string, e entry) error {
+	// An existing entry is replaced rather than written to: it may be a
+	// symlink or a hard link to a file outside of dest
+	if _, err := os.Lstat(target); err == nil {
+		if err := os.RemoveAll(target); err != nil {
+			return err
+		}
+	}
+
+	r, err := e.open()
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", e.name, err)
+	}
+	defer r.Close()
+
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, e.mode.Perm()|0200)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		_ = out.Close()
+		return fmt.Errorf("failed to extract %s: %w", e.name, err)
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	// OpenFile is subject to the umask, set the archived permissions explicitly
+	if err := os.Chmod(target, e.mode.Perm()); err != nil {
+		return err
+	}
+	if !e.modTime.IsZero() {
+		_ = os.Chtimes(target, e.modTime, e.modTime)
+	}
+	return nil
+}
+
+// finish checks the symlinks against the complete tree, then applies directory
+// permissions and times, deepest directories first. A symlink extracted later
+// can change where an earlier one leads: with x/b -> .. extracted after
+// s -> x/b/../.., s leaves dest although it did not when it was created.
+func (x *extractor) finish() error {
+	for _, link := range x.links {
+		if err := x.checkLink(link.name, link.linkname); err != nil {
+			_ = os.Remove(link.name)
+			return err
+		}
+	}
+
+	for i := len(x.dirs) - 1; i >= 0; i-- {
+		dir := x.dirs[i]
+		if err := os.Chmod(dir.name, dir.mode.Perm()|0700); err != nil {
+			return err
+		}
+		if !dir.modTime.IsZero() {
+			_ = os.Chtimes(dir.name, dir.modTime, dir.modTime)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,353 @@
+package bincache
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/thisismeamir/hepsw/internal/archive"
+	"github.com/thisismeamir/hepsw/internal/checksum"
+	"github.com/thisismeamir/hepsw/internal/configuration"
+	"gopkg.in/yaml.v3"
+)
+
+// Layout of a binary cache location, a local directory or an HTTP endpoint
+// serving the same tree:
+//
+//	<location>/<name>/<version>/<build hash>.tar.gz             the install tree
+//	<location>/<name>/<version>/<build hash>.tar.gz.meta.yaml   its metadata
+
+const (
+	artifactSuffix = ".tar.gz"
+	metaSuffix     = ".meta.yaml"
+)
+
+// ErrNotFound is returned when no location has an artifact for a build hash
+var ErrNotFound = errors.New("no cached artifact")
+
+// Entry describes a cached install tree. The build hash identifies the
+// manifest, options, variables, toolchain and dependencies it was built with.
+type Entry struct {
+	Name      string            `yaml:"name"`
+	Version   string            `yaml:"version"`
+	BuildHash string            `yaml:"buildHash"`
+	Variant   string            `yaml:"variant,omitempty"`
+	Options   []string          `yaml:"options,omitempty"`
+	Variables map[string]string `yaml:"variables,omitempty"`
+	// Toolchain maps the toolchain tools to the versions they reported
+	Toolchain map[string]string `yaml:"toolchain,omitempty"`
+	// Dependencies maps the dependencies to their build hashes
+	Dependencies map[string]string `yaml:"dependencies,omitempty"`
+	// Prefix is the install prefix the tree was built for
+	Prefix string `yaml:"prefix"`
+	// Sha256 and Size describe the artifact
+	Sha256    string `yaml:"sha256"`
+	Size      int64  `yaml:"size"`
+	BuildTime string `yaml:"buildTime,omitempty"`
+	PushedAt  string `yaml:"pushedAt"`
+
+	// Location is where the entry was found
+	Location string `yaml:"-"`
+}
+
+// ID returns the name@version of the entry
+func (e *Entry) ID() string {
+	return e.Name + "@" + e.Version
+}
+
+// entryPath returns the artifact path of a build relative to a location
+func entryPath(name, version, buildHash string) string {
+	return path.Join(name, version, buildHash+artifactSuffix)
+}
+
+// Location is a place cached artifacts are looked up in
+type Location interface {
+	// Lookup returns the metadata of the artifact of a build, or ErrNotFound
+	Lookup(name, version, buildHash string) (*Entry, error)
+	// Open opens the artifact of an entry found by Lookup
+	Open(entry *Entry) (io.ReadCloser, error)
+	String() string
+}
+
+// NewLocation returns the location for a directory or an http(s) URL
+func NewLocation(location string) Location {
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		return &httpLocation{base: strings.TrimSuffix(location, "/")}
+	}
+	return &dirLocation{dir: location}
+}
+
+// Locations returns the binary cache locations of a configuration in lookup
+// order: the push directory, the other local directories, then the HTTP
+// endpoints.
+func Locations(config *configuration.Configuration) []Location {
+	locations := []Location{NewLocation(config.BinaryCacheDir())}
+	remote := make([]Location, 0)
+	for _, location := range config.BinaryCaches {
+		if IsRemote(location) {
+			remote = append(remote, NewLocation(location))
+		} else if location != config.BinaryCacheDir() {
+			locations = append(locations, NewLocation(location))
+		}
+	}
+	return append(locations, remote...)
+}
+
+// IsRemote reports whether a location is an HTTP endpoint
+func IsRemote(location string) bool {
+	_, ok := NewLocation(location).(*httpLocation)
+	return ok
+}
+
+type dirLocation struct {
+	dir string
+}
+
+func (l *dirLocation) Lookup(name, version, buildHash string) (*Entry, error) {
+	artifact := filepath.Join(l.dir, filepath.FromSlash(entryPath(name, version, buildHash)))
+	entry, err := readEntry(artifact + metaSuffix)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	entry.Location = l.dir
+	return entry, nil
+}
+
+func (l *dirLocation) Open(entry *Entry) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(l.dir, filepath.FromSlash(entryPath(entry.Name, entry.Version, entry.BuildHash))))
+}
+
+func (l *dirLocation) String() string {
+	return l.dir
+}
+
+type httpLocation struct {
+	base string
+}
+
+func (l *httpLocation) get(rel string) (io.ReadCloser, error) {
+	target := l.base + "/" + (&url.URL{Path: rel}).EscapedPath()
+	resp, err := http.Get(target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", target, err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		_ = resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("failed to download %s: %s", target, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+func (l *httpLocation) Lookup(name, version, buildHash string) (*Entry, error) {
+	body, err := l.get(entryPath(name, version, buildHash) + metaSuffix)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache entry: %w", err)
+	}
+	entry := &Entry{}
+	if err := yaml.Unmarshal(data, entry); err != nil {
+		return nil, fmt.Errorf("failed to parse cache entry: %w", err)
+	}
+	entry.Location = l.base
+	return entry, nil
+}
+
+func (l *httpLocation) Open(entry *Entry) (io.ReadCloser, error) {
+	return l.get(entryPath(entry.Name, entry.Version, entry.BuildHash))
+}
+
+func (l *httpLocation) String() string {
+	return l.base
+}
+
+// Push packs the install tree at prefix into the cache directory dir, keyed by
+// the name, version and build hash of the entry. The artifact and its
+// metadata are written atomically, an existing entry is replaced.
+func Push(dir, prefix string, entry Entry) (*Entry, error) {
+	artifact := filepath.Join(dir, filepath.FromSlash(entryPath(entry.Name, entry.Version, entry.BuildHash)))
+	if err := os.MkdirAll(filepath.Dir(artifact), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(artifact), filepath.Base(artifact)+".part-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cache file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	packErr := pack(prefix, tmp)
+	closeErr := tmp.Close()
+	if packErr == nil {
+		packErr = closeErr
+	}
+	if packErr != nil {
+		_ = os.Remove(tmpPath)
+		return nil, packErr
+	}
+
+	sum, err := checksum.Compute(tmpPath, "sha256")
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return nil, err
+	}
+	info, err := os.Stat(tmpPath)
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return nil, err
+	}
+	entry.Sha256 = strings.TrimPrefix(sum, "sha256:")
+	entry.Size = info.Size()
+	entry.PushedAt = time.Now().Format(time.RFC3339)
+	entry.Location = dir
+
+	if err := os.Rename(tmpPath, artifact); err != nil {
+		_ = os.Remove(tmpPath)
+		return nil, fmt.Errorf("failed to store artifact in cache: %w", err)
+	}
+	if err := writeEntry(artifact+metaSuffix, &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// Find looks the artifact of a build up in the locations, in order
+func Find(locations []Location, name, version, buildHash string) (*Entry, Location, error) {
+	errs := make([]string, 0)
+	for _, location := range locations {
+		entry, err := location.Lookup(name, version, buildHash)
+		if err == nil {
+			return entry, location, nil
+		}
+		if !errors.Is(err, ErrNotFound) {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return nil, nil, fmt.Errorf("%w for %s@%s (%s)", ErrNotFound, name, version, strings.Join(errs, "; "))
+	}
+	return nil, nil, fmt.Errorf("%w for %s@%s with build hash %s", ErrNotFound, name, version, buildHash)
+}
+
+// Extract downloads the artifact of an entry, verifies its hash and unpacks it
+// into dest. Nothing is unpacked from an artifact that does not match the
+// hash recorded in its metadata, and entries that would write outside of dest
+// are rejected.
+func Extract(location Location, entry *Entry, dest string) error {
+	body, err := location.Open(entry)
+	if err != nil {
+		return fmt.Errorf("failed to open artifact: %w", err)
+	}
+	defer body.Close()
+
+	tmp, err := os.CreateTemp("", "hepsw-artifact-*"+artifactSuffix)
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	verifier, err := checksum.NewVerifier("sha256:" + entry.Sha256)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(io.MultiWriter(tmp, verifier), body); err != nil {
+		return fmt.Errorf("failed to download artifact: %w", err)
+	}
+	if err := verifier.Verify(); err != nil {
+		return fmt.Errorf("artifact of %s from %s is corrupted: %w", entry.ID(), location, err)
+	}
+
+	// Artifacts come from anywhere the binary caches point to, they are
+	// unpacked with the checks applied to source archives
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := archive.Extract(tmp.Name(), dest, archive.Options{}); err != nil {
+		return fmt.Errorf("failed to unpack artifact of %s: %w", entry.ID(), err)
+	}
+	return nil
+}
+
+// Entries lists the artifacts cached in a directory
+func Entries(dir string) ([]Entry, error) {
+	entries := make([]Entry, 0)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if info.IsDir() || !strings.HasSuffix(path, artifactSuffix+metaSuffix) {
+			return nil
+		}
+		entry, err := readEntry(path)
+		if err != nil {
+			return err
+		}
+		entry.Location = dir
+		entries = append(entries, *entry)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list binary cache: %w", err)
+	}
+	return entries, nil
+}
+
+func readEntry(path string) (*Entry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache entry: %w", err)
+	}
+	entry := &Entry{}
+	if err := yaml.Unmarshal(data, entry); err != nil {
+		return nil, fmt.Errorf("failed to parse cache entry: %w", err)
+	}
+	return entry, nil
+}
+
+// writeEntry writes the metadata of an artifact atomically
+func writeEntry(path string, entry *Entry) error {
+	data, err := yaml.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal cache entry: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".part-*")
+	if err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	return nil
+}
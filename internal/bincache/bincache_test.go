@@ -0,0 +1,155 @@
+package bincache
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTree(t *testing.T, root string) {
+	t.Helper()
+	for path, content := range map[string]string{
+		"bin/hello":         "binary",
+		"lib/libhello.so.1": "library",
+	} {
+		full := filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("libhello.so.1", filepath.Join(root, "lib", "libhello.so")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func checkTree(t *testing.T, root string) {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(root, "bin", "hello"))
+	if err != nil || string(data) != "binary" {
+		t.Fatalf("bin/hello not restored: %q, %v", data, err)
+	}
+	if link, err := os.Readlink(filepath.Join(root, "lib", "libhello.so")); err != nil || link != "libhello.so.1" {
+		t.Errorf("lib/libhello.so not restored: %q, %v", link, err)
+	}
+}
+
+func TestPushAndPull(t *testing.T) {
+	prefix := filepath.Join(t.TempDir(), "hello", "1.0.0")
+	writeTree(t, prefix)
+
+	cache := t.TempDir()
+	pushed, err := Push(cache, prefix, Entry{Name: "hello", Version: "1.0.0", BuildHash: "abc123", Prefix: prefix})
+	if err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+	if pushed.Sha256 == "" || pushed.Size == 0 {
+		t.Fatalf("artifact not described: %+v", pushed)
+	}
+
+	entries, err := Entries(cache)
+	if err != nil || len(entries) != 1 || entries[0].BuildHash != "abc123" {
+		t.Fatalf("unexpected entries: %+v, %v", entries, err)
+	}
+
+	// An empty directory is searched first, then the HTTP endpoint
+	server := httptest.NewServer(http.FileServer(http.Dir(cache)))
+	defer server.Close()
+	locations := []Location{NewLocation(t.TempDir()), NewLocation(server.URL)}
+
+	if _, _, err := Find(locations, "hello", "1.0.0", "other"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for an unknown build hash, got %v", err)
+	}
+
+	entry, location, err := Find(locations, "hello", "1.0.0", "abc123")
+	if err != nil {
+		t.Fatalf("Find failed: %v", err)
+	}
+	if location.String() != server.URL {
+		t.Errorf("expected the entry to be found at %s, got %s", server.URL, location)
+	}
+
+	dest := t.TempDir()
+	if err := Extract(location, entry, dest); err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+	checkTree(t, dest)
+}
+
+func TestExtractRejectsCorruptedArtifact(t *testing.T) {
+	prefix := t.TempDir()
+	writeTree(t, prefix)
+
+	cache := t.TempDir()
+	if _, err := Push(cache, prefix, Entry{Name: "hello", Version: "1.0.0", BuildHash: "abc123"}); err != nil {
+		t.Fatal(err)
+	}
+	artifact := filepath.Join(cache, "hello", "1.0.0", "abc123"+artifactSuffix)
+	if err := os.WriteFile(artifact, []byte("not the artifact"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	location := NewLocation(cache)
+	entry, err := location.Lookup("hello", "1.0.0", "abc123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dest := t.TempDir()
+	err = Extract(location, entry, dest)
+	if err == nil || !strings.Contains(err.Error(), "corrupted") {
+		t.Fatalf("expected the corrupted artifact to be rejected, got %v", err)
+	}
+	if files, _ := os.ReadDir(dest); len(files) != 0 {
+		t.Errorf("expected nothing to be unpacked, got %d entries", len(files))
+	}
+}
+
+func TestExtractRejectsEscapingArtifact(t *testing.T) {
+	prefix := t.TempDir()
+	writeTree(t, prefix)
+	cache := t.TempDir()
+	if _, err := Push(cache, prefix, Entry{Name: "hello", Version: "1.0.0", BuildHash: "abc123"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The hash of the metadata matches, but lib leads out of the prefix
+	outside := t.TempDir()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	_ = tw.WriteHeader(&tar.Header{Name: "lib", Typeflag: tar.TypeSymlink, Linkname: outside})
+	_ = tw.WriteHeader(&tar.Header{Name: "lib/evil", Typeflag: tar.TypeReg, Mode: 0644, Size: 4})
+	_, _ = tw.Write([]byte("evil"))
+	_ = tw.Close()
+	_ = gz.Close()
+	artifact := filepath.Join(cache, "hello", "1.0.0", "abc123"+artifactSuffix)
+	if err := os.WriteFile(artifact, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	location := NewLocation(cache)
+	entry, err := location.Lookup("hello", "1.0.0", "abc123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	entry.Sha256 = hex.EncodeToString(sum[:])
+
+	if err := Extract(location, entry, t.TempDir()); err == nil {
+		t.Error("expected the artifact to be rejected")
+	}
+	if _, err := os.Stat(filepath.Join(outside, "evil")); !os.IsNotExist(err) {
+		t.Error("artifact wrote outside of the install prefix")
+	}
+}
@@ -0,0 +1,372 @@
+package builder
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thisismeamir/hepsw/internal/configuration"
+	"github.com/thisismeamir/hepsw/internal/manifest"
+	"github.com/thisismeamir/hepsw/internal/relocate"
+	"github.com/thisismeamir/hepsw/internal/workspace"
+)
+
+// Recipe phases in execution order
+const (
+	PhaseConfiguration = "configuration"
+	PhaseBuild         = "build"
+	PhaseTest          = "test"
+	PhaseInstall       = "install"
+)
+
+// DefaultPhases are the phases executed by a full build
+var DefaultPhases = []string{PhaseConfiguration, PhaseBuild, PhaseInstall}
+
+// phaseOrder is the recipe order of every phase the builder can run, the test
+// phase runs on its own but belongs between build and install
+var phaseOrder = []string{PhaseConfiguration, PhaseBuild, PhaseTest, PhaseInstall}
+
+// Builder executes the recipe of a manifest against a fetched source
+type Builder struct {
+	Config        *configuration.Configuration
+	Manifest      *manifest.Manifest
+	Options       []string
+	Variables     map[string]string
+	SourceDir     string
+	BuildDir      string
+	InstallPrefix string
+	LogDir        string
+
+	// Output receives a copy of the output of every step when set
+	Output io.Writer
+	// Notify is called whenever a step changes its status
+	Notify func(StepEvent)
+
+	// Resume skips steps completed by a previous run, as long as their
+	// checkpoint matches. Without it checkpoints are discarded.
+	Resume bool
+	// FromPhase forces every step from that phase on to run again, earlier
+	// steps are resumed from their checkpoints
+	FromPhase string
+	// FromStep narrows FromPhase to a step, counted from 1
+	FromStep int
+
+	// BuildHash identifies what the builder installs, see Identify
+	BuildHash string
+	// Variant is the prefix of the build hash naming a variant build, empty
+	// for the default build of the manifest
+	Variant string
+
+	// CheckRelocatable audits the staged install before it is promoted and
+	// fails it when the tree references the build or source directories,
+	// misses libraries or has RPATH entries outside of the workspace
+	CheckRelocatable bool
+	// IsolateNetwork runs the configuration, build and install steps without
+	// network access, in an unprivileged user and network namespace. Steps
+	// declaring network: true are left out. Only available on Linux.
+	IsolateNetwork bool
+	// AllowThirdParty lets imported third-party packages satisfy the build
+	// dependencies, as it does when the dependency tree is resolved
+	AllowThirdParty bool
+
+	// dependencies are the environments of the installed build dependencies,
+	// read from the workspace state by Identify
+	dependencies []dependencyEnvironment
+	// dependencyWarnings lists the build dependencies left out of them
+	dependencyWarnings []string
+}
+
+// Result summarizes a recipe execution
+type Result struct {
+	Steps       []StepResult
+	Variables   map[string]string
+	BuildTime   time.Time
+	InstallTime time.Time
+	// Files are the files written by the install phase
+	Files []workspace.InstalledFile
+	// Relocation is the audit of the install when CheckRelocatable is set
+	Relocation *relocate.Report
+}
+
+// New creates a Builder using the workspace layout for the build directory,
+// install prefix and logs of the manifest.
+func New(config *configuration.Configuration, m *manifest.Manifest, sourceDir string) *Builder {
+	return &Builder{
+		Config:        config,
+		Manifest:      m,
+		Options:       []string{},
+		Variables:     map[string]string{},
+		SourceDir:     sourceDir,
+		BuildDir:      workspace.BuildDir(config, m.Name, m.Version),
+		InstallPrefix: workspace.InstallDir(config, m.Name, m.Version),
+		LogDir:        filepath.Join(config.Logs, m.Name, m.Version),
+	}
+}
+
+// Run executes the configuration, build and install phases and records the
+// package in the workspace state on success. The configuration is modified
+// but not saved.
+func (b *Builder) Run(ctx context.Context) (*Result, error) {
+	result, err := b.RunPhases(ctx, DefaultPhases)
+	if err != nil {
+		return result, err
+	}
+
+	b.Config.RecordPackage(b.PackageState(result))
+
+	return result, nil
+}
+
+// PackageState is the workspace state entry of a package built by Run. It is
+// exposed for callers that run several builders and record the state
+// themselves.
+func (b *Builder) PackageState(result *Result) configuration.WorkspacePackageState {
+	return configuration.WorkspacePackageState{
+		PackageId:   fmt.Sprintf("%s@%s", b.Manifest.Name, b.PackageVersion()),
+		Name:        b.Manifest.Name,
+		Path:        b.InstallPrefix,
+		Version:     b.Manifest.Version,
+		BuildTime:   result.BuildTime.Format(time.RFC3339),
+		InstallTime: result.InstallTime.Format(time.RFC3339),
+		IsUsing:     dependencyNames(b.Manifest),
+		Files:       len(result.Files),
+		Size:        workspace.TotalSize(result.Files),
+		BuildHash:   b.BuildHash,
+		Variant:     b.Variant,
+		Options:     b.Options,
+		Variables:   b.userVariables(),
+	}
+}
+
+// RunPhases executes the given recipe phases in order and stops at the first
+// failing step.
+func (b *Builder) RunPhases(ctx context.Context, phases []string) (*Result, error) {
+	result := &Result{Steps: make([]StepResult, 0)}
+	if err := b.Identify(); err != nil {
+		return result, err
+	}
+	result.Variables = b.initialVariables()
+	if b.IsolateNetwork {
+		if err := CheckNetworkIsolation(); err != nil {
+			return result, err
+		}
+	}
+
+	for _, dir := range []string{b.BuildDir, b.LogDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return result, fmt.Errorf("failed to create %s: %w", dir, err)
+		}
+	}
+
+	resume, err := b.newResumeState(phases)
+	if err != nil {
+		return result, err
+	}
+
+	for _, phase := range phases {
+		if phase == PhaseInstall {
+			if err := b.runInstallPhase(ctx, result, resume); err != nil {
+				return result, err
+			}
+			continue
+		}
+
+		if err := b.runSteps(ctx, phase, b.phaseSteps(phase), result, resume); err != nil {
+			return result, err
+		}
+		if phase == PhaseBuild {
+			result.BuildTime = time.Now()
+		}
+	}
+
+	return result, nil
+}
+
+func (b *Builder) phaseSteps(phase string) []manifest.RecipeStep {
+	return manifest.NewManifestAccessor(b.Manifest).GetStepsByPhase(phase)
+}
+
+// runSteps runs the steps of a phase in order and stops at the first failure
+func (b *Builder) runSteps(ctx context.Context, phase string, steps []manifest.RecipeStep, result *Result, resume *resumeState) error {
+	for i, step := range steps {
+		stepResult, err := b.runStep(ctx, phase, i, len(steps), step, result.Variables, resume)
+		result.Steps = append(result.Steps, stepResult)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Test runs the test phase against the existing build directory of the
+// package
+func (b *Builder) Test(ctx context.Context) (*Result, error) {
+	if err := b.checkBuildDir(); err != nil {
+		return nil, err
+	}
+	return b.RunPhases(ctx, []string{PhaseTest})
+}
+
+// Install runs the install phase against the existing build directory and
+// records the package in the workspace state. The configuration is modified
+// but not saved.
+func (b *Builder) Install(ctx context.Context) (*Result, error) {
+	if err := b.checkBuildDir(); err != nil {
+		return nil, err
+	}
+	result, err := b.RunPhases(ctx, []string{PhaseInstall})
+	if err != nil {
+		return result, err
+	}
+
+	result.BuildTime = b.lastBuildTime()
+	b.Config.RecordPackage(b.PackageState(result))
+	return result, nil
+}
+
+func (b *Builder) checkBuildDir() error {
+	if err := b.Identify(); err != nil {
+		return err
+	}
+	if _, err := os.Stat(b.BuildDir); err != nil {
+		return fmt.Errorf("no build directory for %s@%s, build the package first: %w", b.Manifest.Name, b.Manifest.Version, err)
+	}
+	return nil
+}
+
+// lastBuildTime is the build time recorded for the package, or the last
+// change of its build directory
+func (b *Builder) lastBuildTime() time.Time {
+	if pkg, ok := b.Config.FindPackage(b.Manifest.Name, b.PackageVersion()); ok {
+		if buildTime, err := time.Parse(time.RFC3339, pkg.BuildTime); err == nil {
+			return buildTime
+		}
+	}
+	if info, err := os.Stat(b.BuildDir); err == nil {
+		return info.ModTime()
+	}
+	return time.Now()
+}
+
+// resumeState tracks which steps of a run may be skipped
+type resumeState struct {
+	checkpoints *checkpoints
+	// skipping stays set until the first step executes, every step after
+	// it has to run again
+	skipping  bool
+	fromPhase string
+	fromIndex int
+}
+
+// newResumeState loads the checkpoints of the build directory and validates
+// the resume point. A run that does not resume starts over from its first
+// phase, dropping the checkpoints of that phase and every later one.
+func (b *Builder) newResumeState(phases []string) (*resumeState, error) {
+	store, err := loadCheckpoints(b.BuildDir)
+	if err != nil {
+		return nil, err
+	}
+
+	state := &resumeState{
+		checkpoints: store,
+		skipping:    b.Resume || b.FromPhase != "",
+		fromPhase:   b.FromPhase,
+	}
+
+	if b.FromStep > 0 && b.FromPhase == "" {
+		return nil, fmt.Errorf("a step to resume from requires its phase")
+	}
+	if b.FromPhase != "" {
+		steps := b.phaseSteps(b.FromPhase)
+		if !containsPhase(phases, b.FromPhase) {
+			return nil, fmt.Errorf("phase %s is not part of this run (%s)", b.FromPhase, strings.Join(phases, ", "))
+		}
+		if b.FromStep > len(steps) {
+			return nil, fmt.Errorf("%s phase has %d step(s), cannot start from step %d", b.FromPhase, len(steps), b.FromStep)
+		}
+		if b.FromStep > 0 {
+			state.fromIndex = b.FromStep - 1
+		}
+	}
+
+	if !state.skipping && len(phases) > 0 {
+		if err := store.invalidateFrom(phases[0], 0); err != nil {
+			return nil, err
+		}
+	}
+	return state, nil
+}
+
+// restart stops skipping completed steps from the start of phase on
+func (r *resumeState) restart(phase string) error {
+	if !r.skipping {
+		return nil
+	}
+	r.skipping = false
+	return r.checkpoints.invalidateFrom(phase, 0)
+}
+
+// maySkip reports whether a completed step may be skipped
+func (r *resumeState) maySkip(phase string, index int) bool {
+	if !r.skipping {
+		return false
+	}
+	return r.fromPhase == "" || stepBefore(phase, index, r.fromPhase, r.fromIndex)
+}
+
+// completed returns the checkpoint of a step that may be skipped because it
+// completed with the same key. A nil state skips nothing.
+func (r *resumeState) completed(phase string, index int, key string) (Checkpoint, bool) {
+	if r == nil || !r.maySkip(phase, index) {
+		return Checkpoint{}, false
+	}
+	return r.checkpoints.completed(phase, index, key)
+}
+
+func containsPhase(phases []string, phase string) bool {
+	for _, p := range phases {
+		if p == phase {
+			return true
+		}
+	}
+	return false
+}
+
+// initialVariables computes the variables visible to the first step, using
+// the same defaults as the walker but pointing at the real workspace paths.
+func (b *Builder) initialVariables() map[string]string {
+	variables := make(map[string]string)
+	_ = manifest.InitializeDefaultVariables(variables, b.Manifest)
+
+	variables["SOURCE_DIR"] = b.SourceDir
+	variables["BUILD_DIR"] = b.BuildDir
+	variables["INSTALL_PREFIX"] = b.InstallPrefix
+	if _, ok := variables["NCORES"]; !ok {
+		variables["NCORES"] = strconv.Itoa(runtime.NumCPU())
+	}
+
+	for k, v := range b.Variables {
+		variables[k] = v
+	}
+	return variables
+}
+
+func (b *Builder) notify(event StepEvent) {
+	if b.Notify != nil {
+		b.Notify(event)
+	}
+}
+
+func dependencyNames(m *manifest.Manifest) []string {
+	names := make([]string, 0)
+	for _, dep := range manifest.NewManifestAccessor(m).AllDependencies() {
+		names = append(names, dep.Name)
+	}
+	return names
+}
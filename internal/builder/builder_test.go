@@ -0,0 +1,538 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thisismeamir/hepsw/internal/configuration"
+	"github.com/thisismeamir/hepsw/internal/manifest"
+	"github.com/thisismeamir/hepsw/internal/manifest/loader"
+	"github.com/thisismeamir/hepsw/internal/workspace"
+)
+
+func newTestBuilder(t *testing.T, recipe manifest.Recipe) *Builder {
+	t.Helper()
+	root := t.TempDir()
+	config := &configuration.Configuration{
+		Sources:  filepath.Join(root, "sources"),
+		Builds:   filepath.Join(root, "builds"),
+		Installs: filepath.Join(root, "installs"),
+		Logs:     filepath.Join(root, "logs"),
+	}
+	m := &manifest.Manifest{Name: "hello", Version: "1.0.0", Recipe: recipe}
+	return New(config, m, filepath.Join(root, "sources", "hello", "1.0.0", "src"))
+}
+
+func TestRunExecutesPhasesInOrder(t *testing.T) {
+	b := newTestBuilder(t, manifest.Recipe{
+		Configuration: []manifest.RecipeStep{
+			{Name: "Set greeting", Set: map[string]string{"GREETING": "hello-${PACKAGE_VERSION}"}},
+			{Name: "Configure", Command: "echo configure > order.txt"},
+		},
+		Build: []manifest.RecipeStep{
+			{Name: "Optional", Command: "echo optional >> order.txt", If: "${OPTIONS_WITH_EXTRA}"},
+			{Name: "Compile", Command: "echo $GREETING >> order.txt"},
+		},
+		Install: []manifest.RecipeStep{
+			{Name: "Install", Command: "mkdir -p ${INSTALL_PREFIX} && cp order.txt ${INSTALL_PREFIX}/"},
+		},
+	})
+
+	result, err := b.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(b.InstallPrefix, "order.txt"))
+	if err != nil {
+		t.Fatalf("install step did not run: %v", err)
+	}
+	if got := string(data); got != "configure\nhello-1.0.0\n" {
+		t.Errorf("unexpected step output: %q", got)
+	}
+
+	if !result.Steps[2].Skipped {
+		t.Error("conditional step should have been skipped")
+	}
+	if _, err := os.Stat(result.Steps[1].LogPath); err != nil {
+		t.Errorf("expected a log file for the configure step: %v", err)
+	}
+
+	pkg, ok := b.Config.FindPackage("hello", "1.0.0")
+	if !ok {
+		t.Fatal("package state was not recorded")
+	}
+	if pkg.BuildTime == "" || pkg.InstallTime == "" {
+		t.Errorf("expected build and install timestamps, got %+v", pkg)
+	}
+}
+
+func TestRunStopsOnFailure(t *testing.T) {
+	b := newTestBuilder(t, manifest.Recipe{
+		Build: []manifest.RecipeStep{
+			{Name: "Break", Command: "echo broken; exit 3"},
+			{Name: "Never", Command: "touch never"},
+		},
+	})
+
+	_, err := b.Run(context.Background())
+	var stepErr *StepError
+	if !errors.As(err, &stepErr) {
+		t.Fatalf("expected a StepError, got %v", err)
+	}
+	if stepErr.Phase != PhaseBuild || stepErr.Index != 0 {
+		t.Errorf("unexpected failing step: %s[%d]", stepErr.Phase, stepErr.Index)
+	}
+
+	log, _ := os.ReadFile(stepErr.LogPath)
+	if !strings.Contains(string(log), "broken") {
+		t.Errorf("step output missing from log: %q", log)
+	}
+	if _, err := os.Stat(filepath.Join(b.BuildDir, "never")); !os.IsNotExist(err) {
+		t.Error("steps after a failure must not run")
+	}
+	if len(b.Config.State.Packages) != 0 {
+		t.Error("failed builds must not be recorded")
+	}
+}
+
+func TestStepTimeoutKillsProcessGroup(t *testing.T) {
+	b := newTestBuilder(t, manifest.Recipe{
+		Build: []manifest.RecipeStep{
+			{Name: "Hang", Command: "(sleep 1; touch late) & sleep 30", Timeout: "200ms"},
+		},
+	})
+
+	started := time.Now()
+	_, err := b.Run(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "timed out after 200ms") {
+		t.Fatalf("expected a timeout, got %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("step was not killed on timeout, took %s", elapsed)
+	}
+
+	// The background child belongs to the process group of the step
+	time.Sleep(1500 * time.Millisecond)
+	if _, err := os.Stat(filepath.Join(b.BuildDir, "late")); !os.IsNotExist(err) {
+		t.Error("children of a timed out step must be killed")
+	}
+}
+
+func TestStepRetriesAndContinueOnError(t *testing.T) {
+	b := newTestBuilder(t, manifest.Recipe{
+		Build: []manifest.RecipeStep{
+			{Name: "Flaky", Command: "echo run >> attempts; [ $(wc -l < attempts) -ge 3 ]", Retries: 2},
+			{Name: "Broken", Command: "exit 1", Retries: 1, ContinueOnError: true},
+			{Name: "After", Command: "touch after"},
+		},
+	})
+
+	result, err := b.RunPhases(context.Background(), []string{PhaseBuild})
+	if err != nil {
+		t.Fatalf("RunPhases failed: %v", err)
+	}
+
+	if flaky := result.Steps[0]; flaky.Failed || flaky.Attempts != 3 {
+		t.Errorf("expected the flaky step to pass on its third attempt, got %+v", flaky)
+	}
+	log, _ := os.ReadFile(result.Steps[0].LogPath)
+	if !strings.Contains(string(log), "# attempt 3 of 3") {
+		t.Errorf("attempts missing from log: %q", log)
+	}
+	if broken := result.Steps[1]; !broken.Failed || broken.Attempts != 2 {
+		t.Errorf("expected the broken step to fail twice, got %+v", broken)
+	}
+	if _, err := os.Stat(filepath.Join(b.BuildDir, "after")); err != nil {
+		t.Error("steps after a step allowed to fail must run")
+	}
+}
+
+func TestStepEnvShellAndCapture(t *testing.T) {
+	b := newTestBuilder(t, manifest.Recipe{
+		Build: []manifest.RecipeStep{
+			{Name: "Detect", Command: `echo "  ${GREETING}-${BASH_VERSION:+bash}  "`, Shell: manifest.ShellBash,
+				Env: map[string]string{"GREETING": "hello-${PACKAGE_VERSION}"}, Capture: "DETECTED"},
+			{Name: "Use", Command: "echo ${DETECTED} > detected; echo ${GREETING:-unset} >> detected"},
+		},
+	})
+	b.Resume = true
+
+	result, err := b.RunPhases(context.Background(), []string{PhaseBuild})
+	if err != nil {
+		t.Fatalf("RunPhases failed: %v", err)
+	}
+	if got := result.Variables["DETECTED"]; got != "hello-1.0.0-bash" {
+		t.Errorf("expected the trimmed output to be captured, got %q", got)
+	}
+	data, _ := os.ReadFile(filepath.Join(b.BuildDir, "detected"))
+	if got := string(data); got != "hello-1.0.0-bash\nunset\n" {
+		t.Errorf("the environment of a step must not leak into later steps, got %q", got)
+	}
+
+	// Resuming restores the captured variable, the later step still matches
+	// its checkpoint
+	result, err = b.RunPhases(context.Background(), []string{PhaseBuild})
+	if err != nil {
+		t.Fatalf("resumed RunPhases failed: %v", err)
+	}
+	if !result.Steps[0].Skipped || !result.Steps[1].Skipped || result.Variables["DETECTED"] != "hello-1.0.0-bash" {
+		t.Errorf("expected both steps to resume with the captured variable, got %+v", result.Steps)
+	}
+}
+
+// addInstalledDependency records a fetched and installed package exporting
+// the self environment
+func addInstalledDependency(t *testing.T, config *configuration.Configuration, name, version string, self map[string]string) string {
+	t.Helper()
+	root := workspace.SourceRoot(config, name, version)
+	if err := os.MkdirAll(root, 0755); err != nil {
+		t.Fatal(err)
+	}
+	m := &manifest.Manifest{Name: name, Version: version}
+	m.Specifications.Environment.Self = self
+	manifestPath := filepath.Join(root, workspace.ManifestFileName)
+	if err := loader.SaveManifest(m, manifestPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := workspace.WriteBuildFile(filepath.Join(root, workspace.BuildFileName), &workspace.BuildFile{
+		Name: name, Version: version, Manifest: manifestPath,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	config.RecordSource(configuration.WorkspaceSourceState{SourceId: name + "@" + version, Name: name, Version: version, Path: root})
+
+	prefix := workspace.InstallDir(config, name, version)
+	config.RecordPackage(configuration.WorkspacePackageState{PackageId: name + "@" + version, Name: name, Version: version, Path: prefix})
+	return prefix
+}
+
+func TestStepEnvironmentIsHermetic(t *testing.T) {
+	t.Setenv("HEPSW_TEST_LEAK", "leaked")
+	t.Setenv("LD_LIBRARY_PATH", "/host/lib")
+
+	b := newTestBuilder(t, manifest.Recipe{
+		Build: []manifest.RecipeStep{
+			{Name: "Dump", Command: "env > env.txt", Env: map[string]string{"CFLAGS": "${CFLAGS} -g"}},
+		},
+	})
+	b.Manifest.Specifications.Environment.Build = map[string]string{"CFLAGS": "-O2 -I${SOURCE_DIR}/include"}
+	b.Manifest.Specifications.Build.Dependencies = []manifest.Dependency{{Name: "zlib"}, {Name: "missing"}}
+	b.Manifest.Specifications.Build.Toolchain = []manifest.Tool{{Name: "sh"}}
+	zlib := addInstalledDependency(t, b.Config, "zlib", "1.3", map[string]string{
+		"ZLIB_ROOT":       "${INSTALL_PREFIX}",
+		"LD_LIBRARY_PATH": "${INSTALL_PREFIX}/lib:${LD_LIBRARY_PATH}",
+	})
+
+	if _, err := b.RunPhases(context.Background(), []string{PhaseBuild}); err != nil {
+		t.Fatalf("RunPhases failed: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(b.BuildDir, "env.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := make(map[string]string)
+	for _, line := range strings.Split(string(data), "\n") {
+		if k, v, ok := strings.Cut(line, "="); ok {
+			env[k] = v
+		}
+	}
+
+	if _, ok := env["HEPSW_TEST_LEAK"]; ok {
+		t.Error("the environment of hepsw leaked into the step")
+	}
+	expected := map[string]string{
+		"CFLAGS":          "-O2 -I" + b.SourceDir + "/include -g",
+		"ZLIB_ROOT":       zlib,
+		"LD_LIBRARY_PATH": zlib + "/lib",
+		"PATH":            minimalPath,
+		"PACKAGE_NAME":    "hello",
+	}
+	for k, v := range expected {
+		if env[k] != v {
+			t.Errorf("expected %s=%s, got %q", k, v, env[k])
+		}
+	}
+
+	// The dependencies are read once by Identify, steps do not touch the
+	// workspace state other builds record their packages in
+	b.Config.State = configuration.WorkspaceState{}
+	initial, err := b.InitialEnvironment()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(initial.Warnings) != 1 || !strings.Contains(initial.Warnings[0], "missing") {
+		t.Errorf("expected a warning for the missing dependency, got %v", initial.Warnings)
+	}
+	if origin := initial.Origins["ZLIB_ROOT"]; origin != "dependency zlib@1.3" {
+		t.Errorf("unexpected origin of ZLIB_ROOT: %q", origin)
+	}
+}
+
+func TestExecStepReplaysEarlierSteps(t *testing.T) {
+	b := newTestBuilder(t, manifest.Recipe{
+		Configuration: []manifest.RecipeStep{
+			{Name: "Detect", Command: "echo detected", Capture: "DETECTED"},
+		},
+		Build: []manifest.RecipeStep{
+			{Name: "Flavour", Set: map[string]string{"FLAVOUR": "${DETECTED}-fast"}},
+			{Name: "Write", Command: "echo ${FLAVOUR} > flavour"},
+		},
+	})
+
+	if _, err := b.ExecStep(context.Background(), PhaseBuild, 1); err == nil || !strings.Contains(err.Error(), "DETECTED") {
+		t.Fatalf("expected the missing capture to be reported, got %v", err)
+	}
+
+	if _, err := b.RunPhases(context.Background(), []string{PhaseConfiguration}); err != nil {
+		t.Fatalf("RunPhases failed: %v", err)
+	}
+	result, err := b.ExecStep(context.Background(), PhaseBuild, 1)
+	if err != nil || result.Skipped {
+		t.Fatalf("ExecStep failed: %v (%+v)", err, result)
+	}
+	data, _ := os.ReadFile(filepath.Join(b.BuildDir, "flavour"))
+	if got := string(data); got != "detected-fast\n" {
+		t.Errorf("unexpected step output: %q", got)
+	}
+
+	checkpoints, err := ReadCheckpoints(b.BuildDir)
+	if err != nil || len(checkpoints) != 1 {
+		t.Errorf("ExecStep must not record checkpoints, got %+v (%v)", checkpoints, err)
+	}
+}
+
+func TestNetworkIsolation(t *testing.T) {
+	// Checkpoints taken with the network do not let an isolated build resume
+	keyed := newTestBuilder(t, manifest.Recipe{})
+	step := manifest.RecipeStep{Name: "Configure", Command: "cmake ."}
+	open := keyed.stepKey(PhaseConfiguration, step, nil)
+	test := keyed.stepKey(PhaseTest, step, nil)
+	keyed.IsolateNetwork = true
+	if keyed.stepKey(PhaseConfiguration, step, nil) == open {
+		t.Error("expected isolation to change the checkpoint key of the step")
+	}
+	if keyed.stepKey(PhaseTest, step, nil) != test {
+		t.Error("test steps are never isolated, their key must not change")
+	}
+
+	if err := CheckNetworkIsolation(); err != nil {
+		t.Skip(err)
+	}
+	host, err := os.Readlink("/proc/self/ns/net")
+	if err != nil {
+		t.Skipf("no network namespace to compare with: %v", err)
+	}
+
+	b := newTestBuilder(t, manifest.Recipe{
+		Build: []manifest.RecipeStep{
+			{Name: "Isolated", Command: "readlink /proc/self/ns/net > ns-isolated"},
+			{Name: "Online", Command: "readlink /proc/self/ns/net > ns-online", Network: true},
+		},
+	})
+	b.IsolateNetwork = true
+	if _, err := b.RunPhases(context.Background(), []string{PhaseBuild}); err != nil {
+		t.Fatalf("RunPhases failed: %v", err)
+	}
+
+	isolated, _ := os.ReadFile(filepath.Join(b.BuildDir, "ns-isolated"))
+	online, _ := os.ReadFile(filepath.Join(b.BuildDir, "ns-online"))
+	if got := strings.TrimSpace(string(isolated)); got == "" || got == host {
+		t.Errorf("expected the step to run in a network namespace of its own, got %q", got)
+	}
+	if got := strings.TrimSpace(string(online)); got != host {
+		t.Errorf("expected the network: true step to keep the host network %q, got %q", host, got)
+	}
+}
+
+func TestRunResumesFromCheckpoints(t *testing.T) {
+	b := newTestBuilder(t, manifest.Recipe{
+		Build: []manifest.RecipeStep{
+			{Name: "First", Command: "echo first >> runs.txt"},
+			{Name: "Second", Command: "test -f fixed && echo second >> runs.txt"},
+			{Name: "Third", Command: "echo third >> runs.txt"},
+		},
+	})
+	runs := filepath.Join(b.BuildDir, "runs.txt")
+
+	if _, err := b.RunPhases(context.Background(), []string{PhaseBuild}); err == nil {
+		t.Fatal("expected the second step to fail")
+	}
+	if err := os.WriteFile(filepath.Join(b.BuildDir, "fixed"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	b.Resume = true
+	result, err := b.RunPhases(context.Background(), []string{PhaseBuild})
+	if err != nil {
+		t.Fatalf("resumed run failed: %v", err)
+	}
+	if !result.Steps[0].Skipped || result.Steps[1].Skipped {
+		t.Errorf("expected only the first step to be resumed, got %+v", result.Steps)
+	}
+	data, _ := os.ReadFile(runs)
+	if got := string(data); got != "first\nsecond\nthird\n" {
+		t.Errorf("unexpected step output after resume: %q", got)
+	}
+
+	// A changed command invalidates its checkpoint and every later one
+	b.Manifest.Recipe.Build[1].Command = "echo changed >> runs.txt"
+	result, err = b.RunPhases(context.Background(), []string{PhaseBuild})
+	if err != nil {
+		t.Fatalf("second resumed run failed: %v", err)
+	}
+	data, _ = os.ReadFile(runs)
+	if got := string(data); got != "first\nsecond\nthird\nchanged\nthird\n" {
+		t.Errorf("unexpected step output after changing a step: %q", got)
+	}
+
+	b.FromPhase = PhaseBuild
+	b.FromStep = 3
+	result, err = b.RunPhases(context.Background(), []string{PhaseBuild})
+	if err != nil {
+		t.Fatalf("run from step 3 failed: %v", err)
+	}
+	if !result.Steps[0].Skipped || !result.Steps[1].Skipped || result.Steps[2].Skipped {
+		t.Errorf("expected only the third step to run, got %+v", result.Steps)
+	}
+
+	b.FromStep = 4
+	if _, err := b.RunPhases(context.Background(), []string{PhaseBuild}); err == nil {
+		t.Error("expected an error for a step out of range")
+	}
+}
+
+func TestTestRunsAgainstBuildDirectory(t *testing.T) {
+	b := newTestBuilder(t, manifest.Recipe{
+		Build: []manifest.RecipeStep{
+			{Name: "Compile", Command: "echo built > artifact"},
+		},
+		Test: []manifest.RecipeStep{
+			{Name: "Check", Command: "grep -q built artifact"},
+		},
+	})
+
+	if _, err := b.Test(context.Background()); err == nil {
+		t.Fatal("expected an error without a build directory")
+	}
+
+	if _, err := b.RunPhases(context.Background(), []string{PhaseBuild}); err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+	result, err := b.Test(context.Background())
+	if err != nil {
+		t.Fatalf("test phase failed: %v", err)
+	}
+	if len(result.Steps) != 1 || result.Steps[0].Phase != PhaseTest {
+		t.Errorf("expected the test step only, got %+v", result.Steps)
+	}
+
+	// Testing does not discard the checkpoints of the build
+	checkpoints, err := ReadCheckpoints(b.BuildDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(checkpoints) != 2 {
+		t.Errorf("expected build and test checkpoints, got %+v", checkpoints)
+	}
+}
+
+func TestInstallIsStaged(t *testing.T) {
+	b := newTestBuilder(t, manifest.Recipe{
+		Configuration: []manifest.RecipeStep{
+			{Name: "Configure", Set: map[string]string{"PREFIX": "${INSTALL_PREFIX}"}},
+		},
+		Install: []manifest.RecipeStep{
+			// Installs through DESTDIR like a build system configured with
+			// the real prefix
+			{Name: "Install", Command: "mkdir -p $DESTDIR$PREFIX/bin && echo v1 > $DESTDIR$PREFIX/bin/tool"},
+		},
+	})
+
+	if _, err := b.Run(context.Background()); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(b.InstallPrefix, "bin", "tool"))
+	if err != nil || string(data) != "v1\n" {
+		t.Fatalf("expected the DESTDIR install in the prefix, got %q (%v)", data, err)
+	}
+
+	// A failing reinstall keeps the previous install
+	b.Manifest.Recipe.Install = append(b.Manifest.Recipe.Install,
+		manifest.RecipeStep{Name: "Break", Command: "exit 1"})
+	if _, err := b.Run(context.Background()); err == nil {
+		t.Fatal("expected the install to fail")
+	}
+	data, err = os.ReadFile(filepath.Join(b.InstallPrefix, "bin", "tool"))
+	if err != nil || string(data) != "v1\n" {
+		t.Errorf("previous install was modified: %q (%v)", data, err)
+	}
+	if _, err := os.Stat(b.InstallPrefix + stagingSuffix); !os.IsNotExist(err) {
+		t.Errorf("staging directory was left behind: %v", err)
+	}
+
+	// An install step that installs nothing is an error
+	b.Manifest.Recipe.Install = []manifest.RecipeStep{{Name: "Nothing", Command: "true"}}
+	if _, err := b.Run(context.Background()); !errors.Is(err, ErrEmptyInstall) {
+		t.Errorf("expected ErrEmptyInstall, got %v", err)
+	}
+}
+
+func TestBuildHashIdentifiesVariants(t *testing.T) {
+	recipe := manifest.Recipe{Build: []manifest.RecipeStep{{Name: "Compile", Command: "make"}}}
+
+	first := newTestBuilder(t, recipe)
+	second := newTestBuilder(t, recipe)
+	second.Manifest.Description = "only the description differs"
+	for _, b := range []*Builder{first, second} {
+		if err := b.Identify(); err != nil {
+			t.Fatalf("Identify failed: %v", err)
+		}
+	}
+	if first.BuildHash != second.BuildHash {
+		t.Error("expected the build hash to ignore the description and the workspace location")
+	}
+	if first.Variant != "" || strings.Contains(first.InstallPrefix, "+") {
+		t.Errorf("default build should not be a variant, got %q in %s", first.Variant, first.InstallPrefix)
+	}
+
+	variant := newTestBuilder(t, recipe)
+	variant.Variables["BUILD_TYPE"] = "Debug"
+	if err := variant.Identify(); err != nil {
+		t.Fatalf("Identify failed: %v", err)
+	}
+	if variant.BuildHash == first.BuildHash {
+		t.Error("expected a variable to change the build hash")
+	}
+	if !strings.HasSuffix(variant.InstallPrefix, "+"+variant.Variant) || len(variant.Variant) != VariantLength {
+		t.Errorf("unexpected variant prefix %s", variant.InstallPrefix)
+	}
+	if variant.PackageVersion() != "1.0.0+"+variant.Variant {
+		t.Errorf("unexpected variant version %s", variant.PackageVersion())
+	}
+}
+
+func TestInstallFailsRelocatableAudit(t *testing.T) {
+	b := newTestBuilder(t, manifest.Recipe{
+		Install: []manifest.RecipeStep{
+			{Name: "Install", Command: "mkdir -p $INSTALL_PREFIX/lib/pkgconfig && echo \"libdir=$BUILD_DIR/lib\" > $INSTALL_PREFIX/lib/pkgconfig/hello.pc"},
+		},
+	})
+	b.CheckRelocatable = true
+
+	result, err := b.Run(context.Background())
+	if !errors.Is(err, ErrNotRelocatable) {
+		t.Fatalf("expected ErrNotRelocatable, got %v", err)
+	}
+	if result.Relocation == nil || len(result.Relocation.Findings) != 1 || result.Relocation.Findings[0].File != "lib/pkgconfig/hello.pc" {
+		t.Errorf("unexpected audit: %+v", result.Relocation)
+	}
+	if _, err := os.Stat(b.InstallPrefix); !os.IsNotExist(err) {
+		t.Errorf("expected the install not to be promoted: %v", err)
+	}
+}
@@ -0,0 +1,194 @@
+package builder
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/thisismeamir/hepsw/internal/manifest"
+	"gopkg.in/yaml.v3"
+)
+
+// CheckpointFileName is the file in the build directory recording the steps
+// completed by previous runs
+const CheckpointFileName = ".hepsw-checkpoints.yml"
+
+// Checkpoint records a successfully completed recipe step. The key hashes the
+// expanded command and everything it depends on, a step is only considered
+// done while its key is unchanged.
+type Checkpoint struct {
+	Phase       string `yaml:"phase"`
+	Index       int    `yaml:"index"`
+	Name        string `yaml:"name"`
+	Key         string `yaml:"key"`
+	CompletedAt string `yaml:"completedAt"`
+	// Captured is the variable set from the output of the step, restored
+	// when the step is skipped
+	Captured map[string]string `yaml:"captured,omitempty"`
+}
+
+// checkpoints is the checkpoint file of a build directory
+type checkpoints struct {
+	path    string
+	entries []Checkpoint
+}
+
+// ReadCheckpoints returns the checkpoints recorded in a build directory
+func ReadCheckpoints(buildDir string) ([]Checkpoint, error) {
+	store, err := loadCheckpoints(buildDir)
+	if err != nil {
+		return nil, err
+	}
+	return store.entries, nil
+}
+
+func loadCheckpoints(buildDir string) (*checkpoints, error) {
+	store := &checkpoints{path: filepath.Join(buildDir, CheckpointFileName), entries: []Checkpoint{}}
+
+	data, err := os.ReadFile(store.path)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoints: %w", err)
+	}
+	if err := yaml.Unmarshal(data, &store.entries); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoints: %w", err)
+	}
+	return store, nil
+}
+
+// completed returns the checkpoint of the step when it has one with the given
+// key
+func (c *checkpoints) completed(phase string, index int, key string) (Checkpoint, bool) {
+	entry, ok := c.find(phase, index)
+	return entry, ok && entry.Key == key
+}
+
+// find returns the checkpoint of a step, whatever its key
+func (c *checkpoints) find(phase string, index int) (Checkpoint, bool) {
+	for _, entry := range c.entries {
+		if entry.Phase == phase && entry.Index == index {
+			return entry, true
+		}
+	}
+	return Checkpoint{}, false
+}
+
+// record stores the checkpoint of a completed step
+func (c *checkpoints) record(checkpoint Checkpoint) error {
+	entries := c.entries[:0]
+	for _, entry := range c.entries {
+		if entry.Phase != checkpoint.Phase || entry.Index != checkpoint.Index {
+			entries = append(entries, entry)
+		}
+	}
+	c.entries = append(entries, checkpoint)
+	return c.save()
+}
+
+// invalidateFrom drops the checkpoints of the given step and every later one,
+// their results are stale once an earlier step runs again
+func (c *checkpoints) invalidateFrom(phase string, index int) error {
+	entries := c.entries[:0]
+	for _, entry := range c.entries {
+		if stepBefore(entry.Phase, entry.Index, phase, index) {
+			entries = append(entries, entry)
+		}
+	}
+	c.entries = entries
+	return c.save()
+}
+
+func (c *checkpoints) save() error {
+	data, err := yaml.Marshal(c.entries)
+	if err != nil {
+		return fmt.Errorf("failed to marshal checkpoints: %w", err)
+	}
+	if err := os.WriteFile(c.path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write checkpoints: %w", err)
+	}
+	return nil
+}
+
+// stepBefore reports whether step (phase, index) comes before step
+// (otherPhase, otherIndex) in recipe order
+func stepBefore(phase string, index int, otherPhase string, otherIndex int) bool {
+	if phase != otherPhase {
+		return phaseRank(phase) < phaseRank(otherPhase)
+	}
+	return index < otherIndex
+}
+
+// phaseRank is the position of a phase in recipe order
+func phaseRank(phase string) int {
+	for i, p := range phaseOrder {
+		if p == phase {
+			return i
+		}
+	}
+	return len(phaseOrder)
+}
+
+// stepKey hashes what a step executes and the inputs it sees: the expanded
+// command or script and arguments, the working directory, the variables, the
+// manifest build environment and the shell, environment and capture of the
+// step.
+func (b *Builder) stepKey(phase string, step manifest.RecipeStep, variables map[string]string) string {
+	hash := sha256.New()
+	write := func(parts ...string) {
+		for _, part := range parts {
+			hash.Write([]byte(part))
+			hash.Write([]byte{0})
+		}
+	}
+
+	write(phase, step.Name)
+	write(manifest.ExpandVariables(step.Command, variables), manifest.ExpandVariables(step.Script, variables))
+	for _, arg := range step.Args {
+		write(manifest.ExpandVariables(arg, variables))
+	}
+	write(manifest.ExpandVariables(step.WorkingDir, variables))
+	write(sortedPairs(variables, nil)...)
+	write(sortedPairs(b.Manifest.Specifications.Environment.Build, variables)...)
+	// Written only when set, keeping the checkpoints of existing steps valid
+	if step.Shell != "" || step.Capture != "" || len(step.Env) > 0 {
+		write(step.Shell, step.Capture)
+		write(sortedPairs(step.Env, variables)...)
+	}
+	// A step that ran with the network does not prove it builds without
+	if b.isolates(phase, step) {
+		write("network: isolated")
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// sortedPairs returns the key=value pairs of a map in key order, with values
+// expanded against variables when given
+func sortedPairs(values map[string]string, variables map[string]string) []string {
+	pairs := make([]string, 0, len(values))
+	for k, v := range values {
+		if variables != nil {
+			v = manifest.ExpandVariables(v, variables)
+		}
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return pairs
+}
+
+func newCheckpoint(phase string, index int, step manifest.RecipeStep, key string) Checkpoint {
+	return Checkpoint{
+		Phase:       phase,
+		Index:       index,
+		Name:        strings.TrimSpace(step.Name),
+		Key:         key,
+		CompletedAt: time.Now().Format(time.RFC3339),
+	}
+}
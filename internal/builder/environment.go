@@ -0,0 +1,239 @@
+package builder
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/thisismeamir/hepsw/internal/configuration"
+	"github.com/thisismeamir/hepsw/internal/manifest"
+	"github.com/thisismeamir/hepsw/internal/workspace"
+)
+
+// minimalPath is the PATH every step starts from, the toolchain and the
+// dependencies are added in front of it
+const minimalPath = "/usr/local/bin:/usr/bin:/bin:/usr/sbin:/sbin"
+
+// passthroughVariables are taken over from the environment of hepsw. They
+// describe the user and the terminal, not the software a build finds.
+var passthroughVariables = []string{"HOME", "USER", "LOGNAME", "TERM", "TMPDIR", "LANG", "LC_ALL", "TZ"}
+
+// Origins of the variables of an Environment
+const (
+	OriginMinimal   = "minimal"
+	OriginBuild     = "environment.build"
+	OriginToolchain = "toolchain"
+	OriginVariable  = "recipe variable"
+	OriginStep      = "step env"
+)
+
+// Environment is the process environment of recipe steps. It is built in
+// layers, and nothing from the environment of hepsw gets into it besides
+// passthroughVariables: a build only sees what its manifest declares.
+type Environment struct {
+	values map[string]string
+	// Origins records the layer that last set every variable
+	Origins map[string]string
+	// Warnings lists the dependencies and tools left out of the environment
+	Warnings []string
+}
+
+func newEnvironment() *Environment {
+	env := &Environment{values: make(map[string]string), Origins: make(map[string]string)}
+	for _, k := range passthroughVariables {
+		if v, ok := os.LookupEnv(k); ok {
+			env.values[k] = v
+			env.Origins[k] = OriginMinimal
+		}
+	}
+	env.values["PATH"] = minimalPath
+	env.values["SHELL"] = "/bin/sh"
+	env.Origins["PATH"] = OriginMinimal
+	env.Origins["SHELL"] = OriginMinimal
+	return env
+}
+
+// Get returns the value of a variable
+func (e *Environment) Get(key string) (string, bool) {
+	v, ok := e.values[key]
+	return v, ok
+}
+
+// List returns the environment as sorted key=value pairs
+func (e *Environment) List() []string {
+	env := make([]string, 0, len(e.values))
+	for _, k := range slices.Sorted(maps.Keys(e.values)) {
+		env = append(env, k+"="+e.values[k])
+	}
+	return env
+}
+
+// layer sets values in key order, expanding them with expand
+func (e *Environment) layer(origin string, values map[string]string, variables map[string]string) {
+	for _, k := range slices.Sorted(maps.Keys(values)) {
+		e.values[k] = e.expand(k, values[k], variables)
+		e.Origins[k] = origin
+	}
+}
+
+// expand expands the recipe variables in value, then the variables set by
+// the earlier layers. A list extending itself before it is set, like
+// "${INSTALL_PREFIX}/lib:${LD_LIBRARY_PATH}", loses its empty entry.
+func (e *Environment) expand(key, value string, variables map[string]string) string {
+	lookup := maps.Clone(e.values)
+	maps.Copy(lookup, variables)
+	if _, ok := lookup[key]; ok || !(strings.Contains(value, "${"+key+"}") || strings.Contains(value, "$"+key)) {
+		return manifest.ExpandVariables(value, lookup)
+	}
+
+	lookup[key] = ""
+	expanded := manifest.ExpandVariables(value, lookup)
+	for strings.Contains(expanded, "::") {
+		expanded = strings.ReplaceAll(expanded, "::", ":")
+	}
+	return strings.Trim(expanded, ": ")
+}
+
+// prependPath puts directories in front of PATH, skipping those already in it
+func (e *Environment) prependPath(origin string, dirs []string) {
+	path := filepath.SplitList(e.values["PATH"])
+	added := make([]string, 0, len(dirs))
+	for _, dir := range dirs {
+		if !slices.Contains(path, dir) && !slices.Contains(added, dir) {
+			added = append(added, dir)
+		}
+	}
+	if len(added) == 0 {
+		return
+	}
+	e.values["PATH"] = strings.Join(append(added, path...), string(filepath.ListSeparator))
+	e.Origins["PATH"] = origin
+}
+
+// dependencyEnvironment is the self environment of an installed build
+// dependency
+type dependencyEnvironment struct {
+	// origin names the installed package, e.g. "dependency zlib@1.3"
+	origin string
+	self   map[string]string
+	// variables expand self, with INSTALL_PREFIX set to the install
+	variables map[string]string
+}
+
+// dependencyEnvironments looks up the installed build dependencies in the
+// workspace state and returns their self environments, and warnings for the
+// dependencies left out
+func (b *Builder) dependencyEnvironments() ([]dependencyEnvironment, []string) {
+	envs := make([]dependencyEnvironment, 0)
+	warnings := make([]string, 0)
+	for _, dep := range manifest.NewManifestAccessor(b.Manifest).GetBuildDependenciesForOptions(b.Options) {
+		pkg, err := workspace.ResolveDependency(b.Config, dep, b.resolveOptions())
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("dependency %s is not fetched, its environment is left out", dep.Name))
+			continue
+		}
+		installed, ok := installedVersion(b.Config, dep.Name, pkg.Manifest.Version)
+		if !ok {
+			warnings = append(warnings, fmt.Sprintf("dependency %s@%s is not installed, its environment is left out", dep.Name, pkg.Manifest.Version))
+			continue
+		}
+
+		variables := make(map[string]string)
+		_ = manifest.InitializeDefaultVariables(variables, pkg.Manifest)
+		variables["INSTALL_PREFIX"] = installed.Path
+		envs = append(envs, dependencyEnvironment{
+			origin:    "dependency " + installed.PackageId,
+			self:      maps.Clone(pkg.Manifest.Specifications.Environment.Self),
+			variables: variables,
+		})
+	}
+	return envs, warnings
+}
+
+// BuildEnvironment returns the hermetic environment of the recipe: the
+// minimal environment, then the build environment of the manifest, the self
+// environments of the installed build dependencies and the directories of
+// the toolchain tools. variables are the recipe variables the manifest
+// environment is expanded with. The dependencies are those found by Identify.
+func (b *Builder) BuildEnvironment(variables map[string]string) *Environment {
+	env := newEnvironment()
+	env.layer(OriginBuild, b.Manifest.Specifications.Environment.Build, variables)
+
+	env.Warnings = append(env.Warnings, b.dependencyWarnings...)
+	for _, dep := range b.dependencies {
+		env.layer(dep.origin, dep.self, dep.variables)
+	}
+
+	dirs := make([]string, 0)
+	for _, tool := range b.Manifest.Specifications.Build.Toolchain {
+		path, err := exec.LookPath(tool.Name)
+		if err != nil {
+			env.Warnings = append(env.Warnings, fmt.Sprintf("toolchain tool %s is not found", tool.Name))
+			continue
+		}
+		dirs = append(dirs, filepath.Dir(path))
+	}
+	env.prependPath(OriginToolchain, dirs)
+
+	return env
+}
+
+// StepEnvironment returns the environment of a step: the build environment,
+// every recipe variable and the env of the step
+func (b *Builder) StepEnvironment(step manifest.RecipeStep, variables map[string]string) *Environment {
+	env := b.BuildEnvironment(variables)
+	for k, v := range variables {
+		env.values[k] = v
+		env.Origins[k] = OriginVariable
+	}
+	env.layer(OriginStep, step.Env, variables)
+	return env
+}
+
+// InitialEnvironment is the environment the first step of the recipe sees,
+// before any step sets variables
+func (b *Builder) InitialEnvironment() (*Environment, error) {
+	if err := b.Identify(); err != nil {
+		return nil, err
+	}
+	return b.StepEnvironment(manifest.RecipeStep{}, b.initialVariables()), nil
+}
+
+// installedVersion finds the install of a version of a package, preferring
+// the default variant and then the most recent install
+func installedVersion(config *configuration.Configuration, name, version string) (*configuration.WorkspacePackageState, bool) {
+	if installed, ok := config.FindPackage(name, version); ok {
+		return installed, true
+	}
+	var latest *configuration.WorkspacePackageState
+	for i, installed := range config.State.Packages {
+		if installed.Name == name && installed.Version == version &&
+			(latest == nil || installed.InstallTime >= latest.InstallTime) {
+			latest = &config.State.Packages[i]
+		}
+	}
+	return latest, latest != nil
+}
+
+// lookPath finds an executable in the directories of path, like
+// exec.LookPath does with the PATH of hepsw. Names with a slash are returned
+// as they are.
+func lookPath(name, path string) (string, error) {
+	if strings.Contains(name, "/") {
+		return name, nil
+	}
+	for _, dir := range filepath.SplitList(path) {
+		if dir == "" {
+			continue
+		}
+		candidate := filepath.Join(dir, name)
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() && info.Mode()&0111 != 0 {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("%s is not found in the build PATH %s, add it to the toolchain of the manifest", name, path)
+}
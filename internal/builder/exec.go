@@ -0,0 +1,94 @@
+package builder
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/thisismeamir/hepsw/internal/manifest"
+)
+
+// ExecStep runs a single step of a phase, counted from 0, in the environment
+// a full run would give it: the variables set by the earlier steps are
+// replayed and those they captured are restored from their checkpoints.
+// Checkpoints are left untouched and nothing is recorded in the workspace. An
+// install step runs against a fresh staging area next to the install prefix,
+// which is left in place for inspection and never promoted.
+func (b *Builder) ExecStep(ctx context.Context, phase string, index int) (StepResult, error) {
+	if err := b.Identify(); err != nil {
+		return StepResult{}, err
+	}
+	if b.IsolateNetwork {
+		if err := CheckNetworkIsolation(); err != nil {
+			return StepResult{}, err
+		}
+	}
+	if !containsPhase(phaseOrder, phase) {
+		return StepResult{}, fmt.Errorf("unknown recipe phase %q", phase)
+	}
+	steps := b.phaseSteps(phase)
+	if index < 0 || index >= len(steps) {
+		return StepResult{}, fmt.Errorf("%s phase has %d step(s), there is no step %d", phase, len(steps), index+1)
+	}
+
+	for _, dir := range []string{b.BuildDir, b.LogDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return StepResult{}, fmt.Errorf("failed to create %s: %w", dir, err)
+		}
+	}
+	store, err := loadCheckpoints(b.BuildDir)
+	if err != nil {
+		return StepResult{}, err
+	}
+
+	variables := b.initialVariables()
+	for _, earlier := range phaseOrder {
+		if earlier == phase {
+			break
+		}
+		if err := b.replaySteps(earlier, b.phaseSteps(earlier), variables, store); err != nil {
+			return StepResult{}, err
+		}
+	}
+
+	if phase == PhaseInstall {
+		stage, err := newStagedInstall(b.InstallPrefix)
+		if err != nil {
+			return StepResult{}, err
+		}
+		variables["INSTALL_PREFIX"] = stage.prefix
+		variables["DESTDIR"] = stage.destDir
+	}
+	if err := b.replaySteps(phase, steps[:index], variables, store); err != nil {
+		return StepResult{}, err
+	}
+
+	return b.runStep(ctx, phase, index, len(steps), steps[index], variables, nil)
+}
+
+// replaySteps applies the variables set by steps without running them. A
+// captured variable is restored from the checkpoint of its step, which has to
+// have completed in an earlier run.
+func (b *Builder) replaySteps(phase string, steps []manifest.RecipeStep, variables map[string]string, store *checkpoints) error {
+	for i, step := range steps {
+		if step.If != "" {
+			if willExecute, _ := manifest.EvaluateConditional(step.If, b.Options, variables); !willExecute {
+				continue
+			}
+		}
+		for k, v := range step.Set {
+			variables[k] = manifest.ExpandVariables(v, variables)
+		}
+		if step.Capture == "" {
+			continue
+		}
+
+		checkpoint, ok := store.find(phase, i)
+		value, captured := checkpoint.Captured[step.Capture]
+		if !ok || !captured {
+			return fmt.Errorf("%s is captured by step %d of the %s phase (%s), which has not completed yet", step.Capture, i+1, phase, step.Name)
+		}
+		variables[step.Capture] = value
+	}
+	return nil
+}
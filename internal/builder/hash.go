@@ -0,0 +1,266 @@
+package builder
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thisismeamir/hepsw/internal/configuration"
+	"github.com/thisismeamir/hepsw/internal/manifest"
+	"github.com/thisismeamir/hepsw/internal/workspace"
+	"gopkg.in/yaml.v3"
+)
+
+// VariantLength is the number of build hash characters naming a variant
+const VariantLength = 12
+
+// Stand-ins hashed for dependencies and tools that cannot be identified
+const (
+	dependencySystem   = "system"
+	dependencyNotBuilt = "not-installed"
+	toolNotFound       = "not found"
+	toolVersionUnknown = "unknown"
+)
+
+const (
+	toolVersionTimeout = 10 * time.Second
+	variantSeparator   = "+"
+)
+
+// locationVariables depend on where and how fast a package is built, not on
+// what is built, and are left out of the build hash
+var locationVariables = map[string]bool{
+	"NCORES":         true,
+	"DESTDIR":        true,
+	"BUILD_DIR":      true,
+	"SOURCE_DIR":     true,
+	"INSTALL_PREFIX": true,
+}
+
+// BuildHashInputs is everything a build hash is computed from
+type BuildHashInputs struct {
+	Manifest *manifest.Manifest
+	// Revision is the fetched source revision, when known
+	Revision  string
+	Options   []string
+	Variables map[string]string
+	// Toolchain maps the toolchain tools to their installed versions
+	Toolchain map[string]string
+	// Dependencies maps the dependencies to their build hashes
+	Dependencies map[string]string
+}
+
+// hashDocument is the normalized form of BuildHashInputs that gets hashed.
+// Maps are marshalled in key order, which keeps the document stable.
+type hashDocument struct {
+	Manifest     *manifest.Manifest `yaml:"manifest"`
+	Revision     string             `yaml:"revision"`
+	Options      []string           `yaml:"options"`
+	Variables    map[string]string  `yaml:"variables"`
+	Toolchain    map[string]string  `yaml:"toolchain"`
+	Dependencies map[string]string  `yaml:"dependencies"`
+}
+
+// ComputeBuildHash returns the build hash of the inputs. The manifest is
+// normalized first: fields that do not change what gets installed, like the
+// description, the metadata, the source mirrors and the test steps, are left
+// out.
+func ComputeBuildHash(inputs BuildHashInputs) (string, error) {
+	options := append([]string{}, inputs.Options...)
+	sort.Strings(options)
+
+	variables := make(map[string]string)
+	for k, v := range inputs.Variables {
+		if !locationVariables[k] {
+			variables[k] = v
+		}
+	}
+
+	data, err := yaml.Marshal(hashDocument{
+		Manifest:     normalizeManifest(inputs.Manifest),
+		Revision:     inputs.Revision,
+		Options:      options,
+		Variables:    variables,
+		Toolchain:    inputs.Toolchain,
+		Dependencies: inputs.Dependencies,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal build hash inputs: %w", err)
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func normalizeManifest(m *manifest.Manifest) *manifest.Manifest {
+	normalized := *m
+	normalized.Description = ""
+	normalized.Metadata = manifest.ManifestMetaData{}
+	normalized.Source.Mirrors = nil
+	normalized.Recipe.Test = nil
+	return &normalized
+}
+
+var (
+	toolVersionsLock sync.Mutex
+	toolVersions     = make(map[string]string)
+)
+
+// ToolchainVersions returns the version reported by each tool of the
+// toolchain, as the first line of '<tool> --version'. Versions are looked up
+// once per process.
+func ToolchainVersions(tools []manifest.Tool) map[string]string {
+	versions := make(map[string]string)
+	for _, tool := range tools {
+		versions[tool.Name] = toolVersion(tool.Name)
+	}
+	return versions
+}
+
+func toolVersion(name string) string {
+	toolVersionsLock.Lock()
+	defer toolVersionsLock.Unlock()
+
+	if version, ok := toolVersions[name]; ok {
+		return version
+	}
+
+	version := toolNotFound
+	if path, err := exec.LookPath(name); err == nil {
+		version = toolVersionUnknown
+		ctx, cancel := context.WithTimeout(context.Background(), toolVersionTimeout)
+		output, err := exec.CommandContext(ctx, path, "--version").CombinedOutput()
+		cancel()
+		if err == nil {
+			for _, line := range strings.Split(string(output), "\n") {
+				if line = strings.TrimSpace(line); line != "" {
+					version = line
+					break
+				}
+			}
+		}
+	}
+	toolVersions[name] = version
+	return version
+}
+
+// resolveOptions are the options the dependencies of the builder resolve with
+func (b *Builder) resolveOptions() workspace.ResolveOptions {
+	return workspace.ResolveOptions{AllowThirdParty: b.AllowThirdParty}
+}
+
+// DependencyHashes returns the build hash of every dependency enabled by the
+// options, resolved with resolveOptions. A dependency is matched to the
+// install of its fetched version, preferring the default variant and then the
+// most recent install.
+func DependencyHashes(config *configuration.Configuration, m *manifest.Manifest, options []string, resolveOptions workspace.ResolveOptions) map[string]string {
+	hashes := make(map[string]string)
+	for _, dep := range manifest.NewManifestAccessor(m).GetDependenciesForOptions(options) {
+		pkg, err := workspace.ResolveDependency(config, dep, resolveOptions)
+		if err != nil {
+			hashes[dep.Name] = dependencySystem
+			continue
+		}
+		version := pkg.Manifest.Version
+
+		hash := dependencyNotBuilt
+		if installed, ok := config.FindPackage(dep.Name, version); ok && installed.BuildHash != "" {
+			hash = installed.BuildHash
+		} else {
+			latest := ""
+			for _, installed := range config.State.Packages {
+				if installed.Name == dep.Name && installed.Version == version &&
+					installed.BuildHash != "" && installed.InstallTime >= latest {
+					latest = installed.InstallTime
+					hash = installed.BuildHash
+				}
+			}
+		}
+		hashes[dep.Name+"@"+version] = hash
+	}
+	return hashes
+}
+
+// Identify computes the build hash of the builder. A build selecting options
+// or setting variables of its own is a variant: its build directory, install
+// prefix and log directory get a +<hash prefix> suffix so that it never
+// replaces the default build. Callers that show the paths before the build
+// call it first, the builder identifies itself before running otherwise.
+// Identify is the only place the builder reads the workspace state, builders
+// running concurrently identify themselves under the lock of the state.
+func (b *Builder) Identify() error {
+	if b.BuildHash != "" {
+		return nil
+	}
+
+	revision := ""
+	if source, ok := b.Config.FindSource(b.Manifest.Name, b.Manifest.Version); ok {
+		revision = source.Commit
+	}
+
+	hash, err := ComputeBuildHash(BuildHashInputs{
+		Manifest:     b.Manifest,
+		Revision:     revision,
+		Options:      b.Options,
+		Variables:    b.initialVariables(),
+		Toolchain:    ToolchainVersions(b.Manifest.Specifications.Build.Toolchain),
+		Dependencies: DependencyHashes(b.Config, b.Manifest, b.Options, b.resolveOptions()),
+	})
+	if err != nil {
+		return err
+	}
+	b.BuildHash = hash
+	b.dependencies, b.dependencyWarnings = b.dependencyEnvironments()
+
+	if b.isVariant() {
+		b.Variant = hash[:VariantLength]
+		b.BuildDir += variantSeparator + b.Variant
+		b.InstallPrefix += variantSeparator + b.Variant
+		b.LogDir += variantSeparator + b.Variant
+	}
+	return nil
+}
+
+// isVariant reports whether the build differs from the default build of the
+// manifest
+func (b *Builder) isVariant() bool {
+	if len(b.Options) > 0 {
+		return true
+	}
+	for k := range b.Variables {
+		if !locationVariables[k] {
+			return true
+		}
+	}
+	return false
+}
+
+// PackageVersion is the version the install is recorded under, with the
+// variant appended as +<variant> when there is one
+func (b *Builder) PackageVersion() string {
+	if b.Variant == "" {
+		return b.Manifest.Version
+	}
+	return b.Manifest.Version + variantSeparator + b.Variant
+}
+
+// userVariables are the variables set for this build that are part of its
+// identity
+func (b *Builder) userVariables() map[string]string {
+	variables := make(map[string]string)
+	for k, v := range b.Variables {
+		if !locationVariables[k] {
+			variables[k] = v
+		}
+	}
+	if len(variables) == 0 {
+		return nil
+	}
+	return variables
+}
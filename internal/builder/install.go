@@ -0,0 +1,267 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/thisismeamir/hepsw/internal/workspace"
+)
+
+// Suffixes of the directories created beside an install prefix while a staged
+// install is promoted. They live next to the prefix so that renames stay on
+// the same file system.
+const (
+	stagingSuffix  = ".staging"
+	previousSuffix = ".previous"
+)
+
+// ErrEmptyInstall is returned when the install steps did not install anything
+var ErrEmptyInstall = errors.New("install steps did not install any file")
+
+// stagedInstall is an install in progress. The install steps run with
+// INSTALL_PREFIX pointing at a staging prefix and DESTDIR at a staging root,
+// the result only replaces the real prefix once every step succeeded.
+type stagedInstall struct {
+	// target is the real install prefix
+	target string
+	// root holds the whole staged install
+	root string
+	// prefix is INSTALL_PREFIX during the install steps
+	prefix string
+	// destDir is DESTDIR during the install steps. Build systems configured
+	// with the real prefix install to destDir/<target>.
+	destDir string
+}
+
+// StagingDir is the directory install steps run against before the install
+// is promoted
+func (b *Builder) StagingDir() string {
+	return b.InstallPrefix + stagingSuffix
+}
+
+// newStagedInstall creates an empty staging area for target, dropping the
+// leftovers of an interrupted install
+func newStagedInstall(target string) (*stagedInstall, error) {
+	root := target + stagingSuffix
+	s := &stagedInstall{
+		target:  target,
+		root:    root,
+		prefix:  filepath.Join(root, "prefix"),
+		destDir: filepath.Join(root, "destdir"),
+	}
+
+	if err := os.RemoveAll(root); err != nil {
+		return nil, fmt.Errorf("failed to clean staging directory: %w", err)
+	}
+	for _, dir := range []string{s.prefix, s.destDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create staging directory: %w", err)
+		}
+	}
+	return s, nil
+}
+
+// collect moves what was installed under DESTDIR into the staging prefix.
+// Files installed anywhere else than below the real prefix are an error.
+func (s *stagedInstall) collect() error {
+	installed := filepath.Join(s.destDir, s.target)
+	if _, err := os.Stat(installed); err == nil {
+		if err := mergeTree(installed, s.prefix); err != nil {
+			return fmt.Errorf("failed to collect DESTDIR install: %w", err)
+		}
+		if err := os.RemoveAll(installed); err != nil {
+			return fmt.Errorf("failed to collect DESTDIR install: %w", err)
+		}
+	}
+
+	stray := ""
+	err := filepath.WalkDir(s.destDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			stray = strings.TrimPrefix(path, s.destDir)
+			return fs.SkipAll
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to inspect DESTDIR: %w", err)
+	}
+	if stray != "" {
+		return fmt.Errorf("%s was installed outside of the install prefix %s", stray, s.target)
+	}
+	return nil
+}
+
+// verify checks that the staged prefix is not empty
+func (s *stagedInstall) verify() error {
+	entries, err := os.ReadDir(s.prefix)
+	if err != nil {
+		return fmt.Errorf("failed to read staged install: %w", err)
+	}
+	if len(entries) == 0 {
+		return ErrEmptyInstall
+	}
+	return nil
+}
+
+// promote renames the staged prefix into place. A previous install is moved
+// aside first and restored if the rename fails, then removed.
+func (s *stagedInstall) promote() error {
+	if err := os.MkdirAll(filepath.Dir(s.target), 0755); err != nil {
+		return fmt.Errorf("failed to create install root: %w", err)
+	}
+
+	previous := s.target + previousSuffix
+	if err := os.RemoveAll(previous); err != nil {
+		return fmt.Errorf("failed to clean previous install: %w", err)
+	}
+
+	replacing := false
+	if _, err := os.Lstat(s.target); err == nil {
+		if err := os.Rename(s.target, previous); err != nil {
+			return fmt.Errorf("failed to move previous install aside: %w", err)
+		}
+		replacing = true
+	}
+
+	if err := os.Rename(s.prefix, s.target); err != nil {
+		if replacing {
+			if restoreErr := os.Rename(previous, s.target); restoreErr != nil {
+				return fmt.Errorf("failed to promote staged install: %w (previous install left in %s: %v)", err, previous, restoreErr)
+			}
+		}
+		return fmt.Errorf("failed to promote staged install: %w", err)
+	}
+
+	s.discard()
+	if replacing {
+		if err := os.RemoveAll(previous); err != nil {
+			return fmt.Errorf("failed to remove previous install: %w", err)
+		}
+	}
+	return nil
+}
+
+// discard removes the staging area
+func (s *stagedInstall) discard() {
+	_ = os.RemoveAll(s.root)
+}
+
+// mergeTree moves the entries of src into dst, descending into directories
+// present in both. A file present in both is a conflict.
+func mergeTree(src, dst string) error {
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		from := filepath.Join(src, entry.Name())
+		to := filepath.Join(dst, entry.Name())
+
+		info, err := os.Lstat(to)
+		if os.IsNotExist(err) {
+			if err := os.Rename(from, to); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() || !info.IsDir() {
+			return fmt.Errorf("%s was installed twice", to)
+		}
+		if err := mergeTree(from, to); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InstallTree installs a tree that does not come from the install steps, like
+// a prebuilt artifact, the same way: fill writes the tree into a staging
+// prefix, which is promoted into target once it is complete and not empty.
+func InstallTree(target string, fill func(prefix string) error) error {
+	stage, err := newStagedInstall(target)
+	if err != nil {
+		return err
+	}
+	defer stage.discard()
+
+	if err := fill(stage.prefix); err != nil {
+		return err
+	}
+	if err := stage.verify(); err != nil {
+		return err
+	}
+	return stage.promote()
+}
+
+// runInstallPhase runs the install steps against a staging area and promotes
+// it into the install prefix once they all succeeded. A failed install leaves
+// the previous install untouched.
+func (b *Builder) runInstallPhase(ctx context.Context, result *Result, resume *resumeState) error {
+	steps := b.phaseSteps(PhaseInstall)
+	if len(steps) == 0 {
+		result.InstallTime = time.Now()
+		return nil
+	}
+
+	// The staging area does not outlive a run, install steps are never
+	// resumed
+	if err := resume.restart(PhaseInstall); err != nil {
+		return err
+	}
+
+	stage, err := newStagedInstall(b.InstallPrefix)
+	if err != nil {
+		return err
+	}
+	defer stage.discard()
+
+	result.Variables["INSTALL_PREFIX"] = stage.prefix
+	result.Variables["DESTDIR"] = stage.destDir
+	defer func() {
+		result.Variables["INSTALL_PREFIX"] = b.InstallPrefix
+		delete(result.Variables, "DESTDIR")
+	}()
+
+	if err := b.runSteps(ctx, PhaseInstall, steps, result, resume); err != nil {
+		return err
+	}
+
+	if err := stage.collect(); err != nil {
+		return err
+	}
+	if err := stage.verify(); err != nil {
+		return err
+	}
+	if b.CheckRelocatable {
+		if err := b.auditStagedInstall(stage, result); err != nil {
+			return err
+		}
+	}
+
+	files, err := workspace.ScanInstalledFiles(stage.prefix)
+	if err != nil {
+		return err
+	}
+	if err := workspace.WriteFileList(stage.prefix, files); err != nil {
+		return err
+	}
+	result.Files = files
+
+	if err := stage.promote(); err != nil {
+		return err
+	}
+	result.InstallTime = time.Now()
+	return nil
+}
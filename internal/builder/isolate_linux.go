@@ -0,0 +1,61 @@
+//go:build linux
+
+package builder
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+var (
+	isolationOnce sync.Once
+	isolationErr  error
+)
+
+// isolateNetwork makes cmd run in a user namespace of its own, mapping the
+// current user and group to themselves, and in an empty network namespace:
+// not even the loopback interface is up. cmd must already have its
+// SysProcAttr.
+func isolateNetwork(cmd *exec.Cmd) {
+	cmd.SysProcAttr.Cloneflags |= syscall.CLONE_NEWUSER | syscall.CLONE_NEWNET
+	cmd.SysProcAttr.UidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getuid(), HostID: os.Getuid(), Size: 1}}
+	cmd.SysProcAttr.GidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getgid(), HostID: os.Getgid(), Size: 1}}
+	cmd.SysProcAttr.GidMappingsEnableSetgroups = false
+}
+
+// CheckNetworkIsolation starts /bin/true in the namespaces of isolateNetwork,
+// once per process, and explains why it failed
+func CheckNetworkIsolation() error {
+	isolationOnce.Do(func() {
+		cmd := exec.Command("/bin/true")
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+		isolateNetwork(cmd)
+		if err := cmd.Run(); err != nil {
+			isolationErr = fmt.Errorf("%w: cannot create an unprivileged user and network namespace (%v)%s",
+				ErrNetworkIsolation, err, namespaceHint())
+		}
+	})
+	return isolationErr
+}
+
+// namespaceHint names the kernel setting that disables unprivileged user
+// namespaces, if any
+func namespaceHint() string {
+	settings := []struct {
+		path, disabled, hint string
+	}{
+		{"/proc/sys/user/max_user_namespaces", "0", "user.max_user_namespaces is 0"},
+		{"/proc/sys/kernel/unprivileged_userns_clone", "0", "kernel.unprivileged_userns_clone is 0"},
+		{"/proc/sys/kernel/apparmor_restrict_unprivileged_userns", "1", "AppArmor restricts unprivileged user namespaces (kernel.apparmor_restrict_unprivileged_userns is 1)"},
+	}
+	for _, setting := range settings {
+		if value, err := os.ReadFile(setting.path); err == nil && strings.TrimSpace(string(value)) == setting.disabled {
+			return ": " + setting.hint
+		}
+	}
+	return ""
+}
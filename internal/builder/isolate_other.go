@@ -0,0 +1,15 @@
+//go:build !linux
+
+package builder
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+func isolateNetwork(cmd *exec.Cmd) {}
+
+// CheckNetworkIsolation always fails, isolation needs Linux namespaces
+func CheckNetworkIsolation() error {
+	return fmt.Errorf("%w: it needs the user and network namespaces of Linux", ErrNetworkIsolation)
+}
@@ -0,0 +1,21 @@
+package builder
+
+import (
+	"errors"
+	"slices"
+
+	"github.com/thisismeamir/hepsw/internal/manifest"
+)
+
+// ErrNetworkIsolation is returned when a network isolated build cannot run on
+// this system
+var ErrNetworkIsolation = errors.New("network isolation is not available")
+
+// isolatedPhases run without network access in a network isolated build. The
+// test phase may need the network of the host.
+var isolatedPhases = []string{PhaseConfiguration, PhaseBuild, PhaseInstall}
+
+// isolates reports whether a step runs without network access
+func (b *Builder) isolates(phase string, step manifest.RecipeStep) bool {
+	return b.IsolateNetwork && !step.Network && slices.Contains(isolatedPhases, phase)
+}
@@ -0,0 +1,7 @@
+package builder
+
+import "time"
+
+// outputGracePeriod is how long a step may keep its output open after its
+// process group was killed or its shell exited
+const outputGracePeriod = 5 * time.Second
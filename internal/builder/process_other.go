@@ -0,0 +1,11 @@
+//go:build !unix
+
+package builder
+
+import "os/exec"
+
+// inProcessGroup only bounds the output of cmd, cancelling it kills the step
+// process but not its children
+func inProcessGroup(cmd *exec.Cmd) {
+	cmd.WaitDelay = outputGracePeriod
+}
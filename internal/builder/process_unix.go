@@ -0,0 +1,19 @@
+//go:build unix
+
+package builder
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// inProcessGroup starts cmd in a process group of its own. Cancelling the
+// context of cmd, on a timeout or Ctrl-C, kills the whole group so the make or
+// ninja children of a step do not outlive it.
+func inProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = outputGracePeriod
+}
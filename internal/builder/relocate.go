@@ -0,0 +1,55 @@
+package builder
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/thisismeamir/hepsw/internal/configuration"
+	"github.com/thisismeamir/hepsw/internal/manifest"
+	"github.com/thisismeamir/hepsw/internal/relocate"
+	"github.com/thisismeamir/hepsw/internal/workspace"
+)
+
+// ErrNotRelocatable is returned by an install that fails the relocatability
+// audit, the findings are in Result.Relocation
+var ErrNotRelocatable = errors.New("install is not relocatable")
+
+// relocationOptions are the audit options of the install of the builder: it
+// must not reference the build, source or staging directories
+func (b *Builder) relocationOptions() relocate.Options {
+	return relocate.Options{
+		BuildPaths:    []string{b.BuildDir, b.SourceDir, b.InstallPrefix + stagingSuffix},
+		Workspace:     b.Config.Workspace,
+		InstallPrefix: b.InstallPrefix,
+	}
+}
+
+// auditStagedInstall audits the staged tree of an install as if it was
+// installed already
+func (b *Builder) auditStagedInstall(stage *stagedInstall, result *Result) error {
+	report, err := relocate.Audit(stage.prefix, b.relocationOptions())
+	if err != nil {
+		return err
+	}
+	result.Relocation = report
+	if !report.OK() {
+		return fmt.Errorf("%w: %d issue(s) in %s", ErrNotRelocatable, len(report.Findings), b.InstallPrefix)
+	}
+	return nil
+}
+
+// AuditInstall audits a recorded install for references to the directories it
+// was built in, missing libraries and RPATH entries outside of the workspace
+func AuditInstall(config *configuration.Configuration, pkg configuration.WorkspacePackageState) (*relocate.Report, error) {
+	sourceDir := workspace.SourceRoot(config, pkg.Name, pkg.Version)
+	if source, ok := config.FindSource(pkg.Name, pkg.Version); ok && source.Path != "" {
+		sourceDir = source.Path
+	}
+
+	b := New(config, &manifest.Manifest{Name: pkg.Name, Version: pkg.Version}, sourceDir)
+	if pkg.Variant != "" {
+		b.BuildDir += variantSeparator + pkg.Variant
+	}
+	b.InstallPrefix = pkg.Path
+	return relocate.Audit(pkg.Path, b.relocationOptions())
+}
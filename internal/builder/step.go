@@ -0,0 +1,328 @@
+package builder
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/thisismeamir/hepsw/internal/manifest"
+)
+
+// StepStatus is the state of a recipe step during execution
+type StepStatus string
+
+const (
+	StepRunning  StepStatus = "running"
+	StepRetrying StepStatus = "retrying"
+	StepDone     StepStatus = "done"
+	StepSkipped  StepStatus = "skipped"
+	StepFailed   StepStatus = "failed"
+	// StepIgnored is a failed step allowed to fail by continue_on_error
+	StepIgnored StepStatus = "ignored"
+)
+
+// StepEvent reports the progress of a recipe step
+type StepEvent struct {
+	Phase    string
+	Index    int
+	Total    int
+	Name     string
+	Status   StepStatus
+	Reason   string
+	LogPath  string
+	Duration time.Duration
+}
+
+// StepResult is the outcome of a single executed (or skipped) step
+type StepResult struct {
+	Phase    string
+	Index    int
+	Name     string
+	Skipped  bool
+	Failed   bool
+	Reason   string
+	LogPath  string
+	Duration time.Duration
+	// Attempts is how many times the step ran, more than one when it was
+	// retried
+	Attempts int
+
+	// UserTime, SystemTime and PeakRSS (in bytes) are the resources used by
+	// the step process and the children it waited for, over every attempt
+	UserTime   time.Duration
+	SystemTime time.Duration
+	PeakRSS    int64
+}
+
+// StepError is returned when a recipe step fails
+type StepError struct {
+	Phase   string
+	Index   int
+	Name    string
+	LogPath string
+	Err     error
+}
+
+func (e *StepError) Error() string {
+	msg := fmt.Sprintf("%s phase failed at step %d (%s): %v", e.Phase, e.Index+1, e.Name, e.Err)
+	if e.LogPath != "" {
+		msg += fmt.Sprintf(" (see %s)", e.LogPath)
+	}
+	return msg
+}
+
+func (e *StepError) Unwrap() error {
+	return e.Err
+}
+
+// runStep runs a step of a phase. Without a resume state the step is run
+// regardless of its checkpoint, which is left untouched.
+func (b *Builder) runStep(ctx context.Context, phase string, index, total int, step manifest.RecipeStep, variables map[string]string, resume *resumeState) (StepResult, error) {
+	result := StepResult{Phase: phase, Index: index, Name: step.Name}
+	event := StepEvent{Phase: phase, Index: index, Total: total, Name: step.Name}
+
+	if step.If != "" {
+		willExecute, reason := manifest.EvaluateConditional(step.If, b.Options, variables)
+		if !willExecute {
+			result.Skipped = true
+			result.Reason = reason
+			event.Status = StepSkipped
+			event.Reason = reason
+			b.notify(event)
+			return result, nil
+		}
+	}
+
+	for k, v := range step.Set {
+		variables[k] = manifest.ExpandVariables(v, variables)
+	}
+
+	if step.Command == "" && step.Script == "" {
+		event.Status = StepDone
+		event.Reason = "sets variables"
+		b.notify(event)
+		return result, nil
+	}
+
+	key := b.stepKey(phase, step, variables)
+	if checkpoint, ok := resume.completed(phase, index, key); ok {
+		maps.Copy(variables, checkpoint.Captured)
+		result.Skipped = true
+		result.Reason = "completed in a previous run"
+		event.Status = StepSkipped
+		event.Reason = result.Reason
+		b.notify(event)
+		return result, nil
+	}
+	if resume != nil && resume.skipping {
+		// Every later step sees the effects of this one, their checkpoints
+		// no longer apply
+		resume.skipping = false
+		if err := resume.checkpoints.invalidateFrom(phase, index); err != nil {
+			return result, err
+		}
+	}
+
+	timeout, err := step.TimeoutDuration()
+	if err != nil {
+		return result, &StepError{Phase: phase, Index: index, Name: step.Name, Err: err}
+	}
+
+	result.LogPath = filepath.Join(b.LogDir, fmt.Sprintf("%s-%02d-%s.log", phase, index+1, slug(step.Name)))
+	event.LogPath = result.LogPath
+	event.Status = StepRunning
+	b.notify(event)
+
+	run := attempt{logPath: result.LogPath, total: max(step.Retries, 0) + 1, timeout: timeout, isolated: b.isolates(phase, step)}
+	if step.Capture != "" {
+		run.stdout = &bytes.Buffer{}
+	}
+	for {
+		result.Attempts++
+		run.number = result.Attempts
+		started := time.Now()
+		var state *os.ProcessState
+		state, err = b.execute(ctx, step, variables, run)
+		result.Duration += time.Since(started)
+		recordUsage(state, &result)
+
+		// An interrupted build is not retried
+		if err == nil || result.Attempts == run.total || ctx.Err() != nil {
+			break
+		}
+		event.Status = StepRetrying
+		event.Reason = fmt.Sprintf("attempt %d of %d failed: %v", result.Attempts, run.total, err)
+		b.notify(event)
+	}
+	event.Duration = result.Duration
+
+	if err != nil {
+		result.Failed = true
+		event.Reason = err.Error()
+		if step.ContinueOnError && ctx.Err() == nil {
+			event.Status = StepIgnored
+			b.notify(event)
+			return result, nil
+		}
+		event.Status = StepFailed
+		b.notify(event)
+		return result, &StepError{Phase: phase, Index: index, Name: step.Name, LogPath: result.LogPath, Err: err}
+	}
+
+	checkpoint := newCheckpoint(phase, index, step, key)
+	if step.Capture != "" {
+		value := strings.TrimSpace(run.stdout.String())
+		variables[step.Capture] = value
+		checkpoint.Captured = map[string]string{step.Capture: value}
+	}
+	if resume != nil {
+		if err := resume.checkpoints.record(checkpoint); err != nil {
+			return result, err
+		}
+	}
+
+	event.Status = StepDone
+	b.notify(event)
+	return result, nil
+}
+
+// attempt describes one run of the process of a step
+type attempt struct {
+	logPath string
+	// number counts the attempts from 1, out of total
+	number  int
+	total   int
+	timeout time.Duration
+	// stdout receives the standard output of the step when it is captured
+	stdout *bytes.Buffer
+	// isolated runs the step without network access
+	isolated bool
+}
+
+// execute runs an attempt of the command or script of a step, writing its
+// output to the log, and kills it after the timeout when set. The first
+// attempt truncates the log, later ones append to it. The state of the
+// finished process is returned when it was started.
+func (b *Builder) execute(ctx context.Context, step manifest.RecipeStep, variables map[string]string, run attempt) (*os.ProcessState, error) {
+	workingDir := b.BuildDir
+	if step.WorkingDir != "" {
+		workingDir = manifest.ExpandVariables(step.WorkingDir, variables)
+	}
+	if err := os.MkdirAll(workingDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create working directory: %w", err)
+	}
+
+	stepCtx := ctx
+	if run.timeout > 0 {
+		var cancel context.CancelFunc
+		stepCtx, cancel = context.WithTimeout(ctx, run.timeout)
+		defer cancel()
+	}
+
+	env := b.StepEnvironment(step, variables)
+	path, _ := env.Get("PATH")
+
+	var cmd *exec.Cmd
+	var description string
+	if step.Command != "" {
+		description = manifest.ExpandVariables(step.Command, variables)
+		interpreter, err := shellInterpreter(step.Shell)
+		if err != nil {
+			return nil, err
+		}
+		if interpreter, err = lookPath(interpreter, path); err != nil {
+			return nil, err
+		}
+		cmd = exec.CommandContext(stepCtx, interpreter, "-c", description)
+	} else {
+		script := manifest.ExpandVariables(step.Script, variables)
+		args := make([]string, len(step.Args))
+		for i, arg := range step.Args {
+			args[i] = manifest.ExpandVariables(arg, variables)
+		}
+		description = strings.TrimSpace(script + " " + strings.Join(args, " "))
+		executable, err := lookPath(script, path)
+		if err != nil {
+			return nil, err
+		}
+		cmd = exec.CommandContext(stepCtx, executable, args...)
+	}
+	cmd.Dir = workingDir
+	cmd.Env = env.List()
+	inProcessGroup(cmd)
+	if run.isolated {
+		isolateNetwork(cmd)
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if run.number > 1 {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	logFile, err := os.OpenFile(run.logPath, flags, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create log file: %w", err)
+	}
+	defer logFile.Close()
+
+	if run.number > 1 {
+		fmt.Fprintf(logFile, "\n# attempt %d of %d\n\n", run.number, run.total)
+	} else {
+		fmt.Fprintf(logFile, "# step: %s\n# command: %s\n# working dir: %s\n", step.Name, description, workingDir)
+		if run.isolated {
+			fmt.Fprintln(logFile, "# network: isolated")
+		}
+		fmt.Fprintln(logFile)
+	}
+
+	var output io.Writer = logFile
+	if b.Output != nil {
+		output = io.MultiWriter(logFile, b.Output)
+	}
+	cmd.Stdout = output
+	cmd.Stderr = output
+	if run.stdout != nil {
+		// Only the output of the last attempt is captured
+		run.stdout.Reset()
+		cmd.Stdout = io.MultiWriter(output, run.stdout)
+	}
+
+	err = cmd.Run()
+	if err != nil && run.timeout > 0 && errors.Is(stepCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+		err = fmt.Errorf("timed out after %s", run.timeout)
+	}
+	return cmd.ProcessState, err
+}
+
+// shellInterpreter returns the program running the command of a step with
+// the given shell
+func shellInterpreter(shell string) (string, error) {
+	switch shell {
+	case "", manifest.ShellSh:
+		return "/bin/sh", nil
+	case manifest.ShellBash:
+		return "bash", nil
+	case manifest.ShellPython:
+		return "python3", nil
+	}
+	return "", fmt.Errorf("unsupported shell %q", shell)
+}
+
+var slugPattern = regexp.MustCompile(`[^a-z0-9]+`)
+
+// slug turns a step name into something safe to use in a file name
+func slug(name string) string {
+	s := strings.Trim(slugPattern.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	if s == "" {
+		return "step"
+	}
+	return s
+}
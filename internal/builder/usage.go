@@ -0,0 +1,16 @@
+package builder
+
+import "os"
+
+// recordUsage adds the resource usage of a finished step process to the
+// result of the step
+func recordUsage(state *os.ProcessState, result *StepResult) {
+	if state == nil {
+		return
+	}
+	result.UserTime += state.UserTime()
+	result.SystemTime += state.SystemTime()
+	if peak, ok := peakRSS(state); ok {
+		result.PeakRSS = max(result.PeakRSS, peak)
+	}
+}
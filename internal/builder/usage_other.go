@@ -0,0 +1,10 @@
+//go:build !unix
+
+package builder
+
+import "os"
+
+// peakRSS is not available without getrusage
+func peakRSS(state *os.ProcessState) (int64, bool) {
+	return 0, false
+}
@@ -0,0 +1,23 @@
+//go:build unix
+
+package builder
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+)
+
+// peakRSS returns the peak resident memory of a finished process in bytes
+func peakRSS(state *os.ProcessState) (int64, bool) {
+	usage, ok := state.SysUsage().(*syscall.Rusage)
+	if !ok {
+		return 0, false
+	}
+	// ru_maxrss is in kilobytes on Linux and in bytes on macOS
+	peak := int64(usage.Maxrss)
+	if runtime.GOOS != "darwin" {
+		peak *= 1024
+	}
+	return peak, true
+}
@@ -0,0 +1,141 @@
+package checksum
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+)
+
+// DefaultAlgorithm is used when computing new checksums
+const DefaultAlgorithm = "sha256"
+
+// Algorithms lists the supported checksum algorithms
+var Algorithms = []string{"md5", "sha1", "sha256", "sha512"}
+
+// MismatchError is returned when a computed digest differs from the declared one
+type MismatchError struct {
+	Expected string
+	Actual   string
+}
+
+func (e *MismatchError) Error() string {
+	return fmt.Sprintf("checksum mismatch: expected %s, got %s", e.Expected, e.Actual)
+}
+
+// Parse splits an algorithm:hash checksum into its parts. The hash must be
+// the hex digest of the algorithm, it is used as a file name by the caches.
+func Parse(checksum string) (string, string, error) {
+	algorithm, digest, found := strings.Cut(checksum, ":")
+	if !found || digest == "" {
+		return "", "", fmt.Errorf("invalid checksum format %q (should be algorithm:hash)", checksum)
+	}
+	algorithm = strings.ToLower(algorithm)
+	h, err := newHash(algorithm)
+	if err != nil {
+		return "", "", err
+	}
+	digest = strings.ToLower(digest)
+	if _, err := hex.DecodeString(digest); err != nil || len(digest) != 2*h.Size() {
+		return "", "", fmt.Errorf("invalid checksum %q: a %s hash is %d hex digits", checksum, algorithm, 2*h.Size())
+	}
+	return algorithm, digest, nil
+}
+
+func newHash(algorithm string) (hash.Hash, error) {
+	switch algorithm {
+	case "md5":
+		return md5.New(), nil
+	case "sha1":
+		return sha1.New(), nil
+	case "sha256":
+		return sha256.New(), nil
+	case "sha512":
+		return sha512.New(), nil
+	default:
+		return nil, fmt.Errorf("unsupported checksum algorithm: %s (must be one of: %s)",
+			algorithm, strings.Join(Algorithms, ", "))
+	}
+}
+
+// Verifier is an io.Writer that hashes everything written to it, so a
+// download can be verified while it is streamed to disk.
+type Verifier struct {
+	algorithm string
+	expected  string
+	hash      hash.Hash
+}
+
+// NewVerifier creates a Verifier for an algorithm:hash checksum
+func NewVerifier(checksum string) (*Verifier, error) {
+	algorithm, digest, err := Parse(checksum)
+	if err != nil {
+		return nil, err
+	}
+	h, _ := newHash(algorithm)
+	return &Verifier{algorithm: algorithm, expected: digest, hash: h}, nil
+}
+
+func (v *Verifier) Write(p []byte) (int, error) {
+	return v.hash.Write(p)
+}
+
+// Sum returns the algorithm:hash checksum of everything written so far
+func (v *Verifier) Sum() string {
+	return v.algorithm + ":" + hex.EncodeToString(v.hash.Sum(nil))
+}
+
+// Verify compares the written data against the expected checksum
+func (v *Verifier) Verify() error {
+	actual := v.Sum()
+	if actual != v.algorithm+":"+v.expected {
+		return &MismatchError{Expected: v.algorithm + ":" + v.expected, Actual: actual}
+	}
+	return nil
+}
+
+// Compute returns the algorithm:hash checksum of the file at path
+func Compute(path, algorithm string) (string, error) {
+	h, err := newHash(strings.ToLower(algorithm))
+	if err != nil {
+		return "", err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	return strings.ToLower(algorithm) + ":" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// VerifyFile checks the file at path against an algorithm:hash checksum
+func VerifyFile(path, checksum string) error {
+	verifier, err := NewVerifier(checksum)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(verifier, f); err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	return verifier.Verify()
+}
@@ -0,0 +1,68 @@
+package checksum
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerifyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "source.tar.gz")
+	if err := os.WriteFile(path, []byte("hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	good := "sha256:5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03"
+	if err := VerifyFile(path, good); err != nil {
+		t.Errorf("expected checksum to match: %v", err)
+	}
+	if err := VerifyFile(path, "SHA256:5891B5B522D5DF086D0FF0B110FBD9D21BB4FC7163AF34D08286A2E846F6BE03"); err != nil {
+		t.Errorf("checksums should be case insensitive: %v", err)
+	}
+
+	var mismatch *MismatchError
+	err := VerifyFile(path, "md5:00000000000000000000000000000000")
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("expected a MismatchError, got %v", err)
+	}
+	if mismatch.Actual != "md5:b1946ac92492d2347c6235b4d2611184" {
+		t.Errorf("unexpected computed digest: %s", mismatch.Actual)
+	}
+
+	if err := VerifyFile(path, "crc32:abcd"); err == nil {
+		t.Error("expected unsupported algorithms to be rejected")
+	}
+}
+
+func TestParseRejectsMalformedDigests(t *testing.T) {
+	for _, sum := range []string{
+		"sha256:../../../../home/u/.bashrc",
+		"sha256:5891b5b522d5df086d0ff0b110fbd9d2",
+		"md5:zz946ac92492d2347c6235b4d2611184",
+	} {
+		if _, _, err := Parse(sum); err == nil {
+			t.Errorf("expected %q to be rejected", sum)
+		}
+	}
+
+	algorithm, digest, err := Parse("SHA1:F572D396FAE9206628714FB2CE00F72E94F2258F")
+	if err != nil || algorithm != "sha1" || digest != "f572d396fae9206628714fb2ce00f72e94f2258f" {
+		t.Errorf("unexpected parse: %s %s (%v)", algorithm, digest, err)
+	}
+}
+
+func TestCompute(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "source.tar.gz")
+	if err := os.WriteFile(path, []byte("hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	sum, err := Compute(path, "sha1")
+	if err != nil {
+		t.Fatalf("Compute failed: %v", err)
+	}
+	if sum != "sha1:f572d396fae9206628714fb2ce00f72e94f2258f" {
+		t.Errorf("unexpected checksum: %s", sum)
+	}
+}
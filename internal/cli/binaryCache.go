@@ -0,0 +1,347 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+	"github.com/thisismeamir/hepsw/internal/bincache"
+	"github.com/thisismeamir/hepsw/internal/builder"
+	"github.com/thisismeamir/hepsw/internal/configuration"
+	"github.com/thisismeamir/hepsw/internal/manifest"
+	"github.com/thisismeamir/hepsw/internal/manifest/loader"
+	"github.com/thisismeamir/hepsw/internal/workspace"
+)
+
+var (
+	cachePushManifest string
+	cachePushTo       string
+	cachePullManifest string
+	cachePullForce    bool
+)
+
+var cachePushCmd = &cobra.Command{
+	Use:   "push <install-prefix>",
+	Short: "Store an installed package in the binary cache",
+	Long: `Push packs an install prefix together with its metadata into the binary
+cache, keyed by the build hash of the package: its manifest, options, variables,
+toolchain versions and the build hashes of its dependencies. The options and
+variables the install was built with are taken from the workspace state.
+
+Artifacts are pushed to binaryCache from the configuration, or --to.
+
+Example:
+  hepsw cache push ~/.hepsw/installs/geant4/11.2.0 --manifest geant4.yaml`,
+	Args: cobra.ExactArgs(1),
+	RunE: runCachePush,
+}
+
+var cachePullCmd = &cobra.Command{
+	Use:   "pull <package[@version]>",
+	Short: "Install a package from the binary cache",
+	Long: `Pull computes the build hash of a package, from its fetched manifest or the
+one given with --manifest, and installs the matching artifact instead of
+building it. Cache locations are searched in order: binaryCache, the local
+directories of binaryCaches, then its http(s) endpoints, which can be served by
+any static file server. The hash of the artifact is verified before it is
+unpacked, and the install is staged like a build.
+
+The build hash is strict: besides the manifest, options and variables it
+covers the first line of '<tool> --version' of every toolchain tool, and the
+build hashes of the installed dependencies, or not-installed for those missing
+from the workspace. An artifact pushed from a machine with another compiler
+release, or against other dependency builds, is not used. When nothing
+matches, the inputs that differ from the artifacts of the same version in the
+local cache directories are listed.
+
+Example:
+  hepsw cache pull geant4@11.2.0
+  hepsw cache pull root --with with-python --manifest root.yaml`,
+	Args: cobra.ExactArgs(1),
+	RunE: runCachePull,
+}
+
+func init() {
+	cachePushCmd.Flags().StringVarP(&cachePushManifest, "manifest", "m", "",
+		"manifest the package was built from")
+	_ = cachePushCmd.MarkFlagRequired("manifest")
+	cachePushCmd.Flags().StringVar(&cachePushTo, "to", "",
+		"cache directory to push to (default: binaryCache)")
+
+	cachePullCmd.Flags().StringVarP(&cachePullManifest, "manifest", "m", "",
+		"manifest to compute the build hash from (default: the fetched manifest)")
+	cachePullCmd.Flags().BoolVarP(&cachePullForce, "force", "f", false,
+		"replace an install with the same build hash")
+	// The build hash depends on the options and variables
+	cachePullCmd.Flags().StringSliceVar(&buildOptions, "with", []string{},
+		"build options to enable (e.g., with-python,with-gui)")
+	cachePullCmd.Flags().StringToStringVarP(&buildVariables, "var", "V", map[string]string{},
+		"set recipe variables (e.g., BUILD_TYPE=Debug)")
+}
+
+func runCachePush(cmd *cobra.Command, args []string) error {
+	config, err := configuration.GetConfiguration()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	prefix, err := filepath.Abs(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", args[0], err)
+	}
+	if _, err := os.Stat(filepath.Join(prefix, workspace.FileListName)); err != nil {
+		return fmt.Errorf("%s is not an install prefix with a file list, install the package again first", prefix)
+	}
+
+	m, err := loader.LoadManifestFromFile(cachePushManifest)
+	if err != nil {
+		return fmt.Errorf("failed to load manifest: %w", err)
+	}
+
+	var installed *configuration.WorkspacePackageState
+	for i, pkg := range config.State.Packages {
+		if pkg.Path == prefix {
+			installed = &config.State.Packages[i]
+		}
+	}
+
+	b := builder.New(config, m, workspace.SourceDir(config, m.Name, m.Version))
+	if installed != nil {
+		b.Options = installed.Options
+		for k, v := range installed.Variables {
+			b.Variables[k] = v
+		}
+	} else {
+		PrintWarning(prefix + " is not recorded in the workspace, the default options are assumed")
+	}
+	if err := b.Identify(); err != nil {
+		return err
+	}
+	if installed != nil && installed.BuildHash != "" && installed.BuildHash != b.BuildHash {
+		return fmt.Errorf("%s was built with build hash %s but the manifest gives %s, it does not match the manifest",
+			prefix, installed.BuildHash, b.BuildHash)
+	}
+
+	entry := bincache.Entry{
+		Name:         m.Name,
+		Version:      m.Version,
+		BuildHash:    b.BuildHash,
+		Variant:      b.Variant,
+		Options:      b.Options,
+		Toolchain:    builder.ToolchainVersions(m.Specifications.Build.Toolchain),
+		Dependencies: builder.DependencyHashes(config, m, b.Options, workspace.ResolveOptions{AllowThirdParty: b.AllowThirdParty}),
+		Prefix:       prefix,
+	}
+	if installed != nil {
+		entry.Variables = installed.Variables
+		entry.BuildTime = installed.BuildTime
+	}
+
+	dir := cachePushTo
+	if dir == "" {
+		dir = config.BinaryCacheDir()
+	}
+	pushed, err := bincache.Push(dir, prefix, entry)
+	if err != nil {
+		return err
+	}
+
+	PrintSuccess(fmt.Sprintf("Pushed %s (%s) to %s", pushed.ID(), humanize.Bytes(uint64(pushed.Size)), dir))
+	PrintInfo("Build hash: " + pushed.BuildHash)
+	return nil
+}
+
+func runCachePull(cmd *cobra.Command, args []string) error {
+	config, err := configuration.GetConfiguration()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	var m *manifest.Manifest
+	sourceDir := ""
+	if cachePullManifest != "" {
+		if m, err = loader.LoadManifestFromFile(cachePullManifest); err != nil {
+			return fmt.Errorf("failed to load manifest: %w", err)
+		}
+		sourceDir = workspace.SourceDir(config, m.Name, m.Version)
+	} else {
+		pkg, err := workspace.Locate(config, args[0])
+		if err != nil {
+			return fmt.Errorf("%w, or give the manifest with --manifest", err)
+		}
+		m, sourceDir = pkg.Manifest, pkg.BuildFile.Src
+	}
+
+	b, err := newBuilder(config, m, sourceDir)
+	if err != nil {
+		return err
+	}
+	id := m.Name + "@" + b.PackageVersion()
+
+	if installed, ok := config.FindPackage(m.Name, b.PackageVersion()); ok && installed.BuildHash == b.BuildHash && !cachePullForce {
+		PrintInfo(fmt.Sprintf("%s is already installed with build hash %s", id, b.BuildHash))
+		return nil
+	}
+
+	entry, location, err := bincache.Find(bincache.Locations(config), m.Name, m.Version, b.BuildHash)
+	if errors.Is(err, bincache.ErrNotFound) {
+		explainCacheMiss(config, m, b)
+	}
+	if err != nil {
+		return err
+	}
+	PrintInfo(fmt.Sprintf("Found %s (%s) in %s", id, humanize.Bytes(uint64(entry.Size)), location))
+	if entry.Prefix != b.InstallPrefix {
+		PrintWarning(fmt.Sprintf("The artifact was built for %s, it may reference that location", entry.Prefix))
+	}
+
+	// The file list uninstall removes is rebuilt from what was unpacked, the
+	// one shipped in the artifact is not trusted
+	var files []workspace.InstalledFile
+	err = builder.InstallTree(b.InstallPrefix, func(prefix string) error {
+		if err := bincache.Extract(location, entry, prefix); err != nil {
+			return err
+		}
+		if files, err = workspace.ScanInstalledFiles(prefix); err != nil {
+			return err
+		}
+		return workspace.WriteFileList(prefix, files)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to install %s from the cache: %w", id, err)
+	}
+	buildTime, err := time.Parse(time.RFC3339, entry.BuildTime)
+	if err != nil {
+		buildTime = time.Now()
+	}
+	config.RecordPackage(b.PackageState(&builder.Result{
+		BuildTime:   buildTime,
+		InstallTime: time.Now(),
+		Files:       files,
+	}))
+	if err := config.Save(); err != nil {
+		return fmt.Errorf("failed to save configuration: %w", err)
+	}
+
+	PrintSuccess(fmt.Sprintf("Installed %s from the binary cache into %s", id, b.InstallPrefix))
+	return nil
+}
+
+// explainCacheMiss lists, for every artifact of the same version in the local
+// cache directories, the build hash inputs that differ from those of b
+func explainCacheMiss(config *configuration.Configuration, m *manifest.Manifest, b *builder.Builder) {
+	toolchain := builder.ToolchainVersions(m.Specifications.Build.Toolchain)
+	dependencies := builder.DependencyHashes(config, m, b.Options, workspace.ResolveOptions{AllowThirdParty: b.AllowThirdParty})
+	for _, dir := range localCacheDirs(config) {
+		entries, err := bincache.Entries(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if entry.Name != m.Name || entry.Version != m.Version {
+				continue
+			}
+			PrintWarning(fmt.Sprintf("%s in %s has build hash %s:", entry.ID(), dir, entry.BuildHash))
+			differences := cacheKeyDifferences(&entry, b.Options, toolchain, dependencies)
+			if len(differences) == 0 {
+				differences = []string{"the manifest, the source revision or the variables differ"}
+			}
+			for _, difference := range differences {
+				PrintBullet(difference)
+			}
+		}
+	}
+}
+
+// cacheKeyDifferences describes the options, toolchain versions and
+// dependency build hashes of an entry that differ from the given ones.
+// Entries pushed without toolchain versions are not compared on them.
+func cacheKeyDifferences(entry *bincache.Entry, options []string, toolchain, dependencies map[string]string) []string {
+	differences := make([]string, 0)
+	ours, theirs := slices.Sorted(slices.Values(options)), slices.Sorted(slices.Values(entry.Options))
+	if !slices.Equal(ours, theirs) {
+		differences = append(differences, fmt.Sprintf("options: [%s] here, [%s] in the artifact",
+			strings.Join(ours, ","), strings.Join(theirs, ",")))
+	}
+	if entry.Toolchain != nil {
+		differences = append(differences, mapDifferences("toolchain", toolchain, entry.Toolchain)...)
+	}
+	return append(differences, mapDifferences("dependency", dependencies, entry.Dependencies)...)
+}
+
+// mapDifferences describes the keys whose values differ between ours and
+// theirs, in key order
+func mapDifferences(kind string, ours, theirs map[string]string) []string {
+	keys := slices.Collect(maps.Keys(ours))
+	for key := range theirs {
+		if _, ok := ours[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+
+	differences := make([]string, 0)
+	for _, key := range keys {
+		here, ok := ours[key]
+		if !ok {
+			here = "none"
+		}
+		there, ok := theirs[key]
+		if !ok {
+			there = "none"
+		}
+		if here != there {
+			differences = append(differences, fmt.Sprintf("%s %s: %s here, %s in the artifact", kind, key, here, there))
+		}
+	}
+	return differences
+}
+
+// localCacheDirs returns binaryCache and the local directories of
+// binaryCaches
+func localCacheDirs(config *configuration.Configuration) []string {
+	dirs := []string{config.BinaryCacheDir()}
+	for _, location := range config.BinaryCaches {
+		if !bincache.IsRemote(location) && location != config.BinaryCacheDir() {
+			dirs = append(dirs, location)
+		}
+	}
+	return dirs
+}
+
+// printBinaryCache lists the artifacts of the local binary cache directories
+func printBinaryCache(config *configuration.Configuration) error {
+	for _, dir := range localCacheDirs(config) {
+		entries, err := bincache.Entries(dir)
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			PrintInfo("No prebuilt packages in " + dir)
+			continue
+		}
+
+		var total uint64
+		PrintSection("Prebuilt packages in " + dir)
+		for _, entry := range entries {
+			total += uint64(entry.Size)
+			PrintBullet(fmt.Sprintf("%s (%s, pushed %s)", entry.ID(), humanize.Bytes(uint64(entry.Size)), entry.PushedAt))
+			fmt.Printf("      %s\n", entry.BuildHash)
+		}
+		PrintInfo(fmt.Sprintf("%d package(s), %s", len(entries), humanize.Bytes(total)))
+	}
+
+	for _, location := range config.BinaryCaches {
+		if bincache.IsRemote(location) {
+			PrintInfo("Remote binary cache (not listed): " + location)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package cli
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/thisismeamir/hepsw/internal/bincache"
+)
+
+func TestCacheKeyDifferences(t *testing.T) {
+	entry := &bincache.Entry{
+		Options:      []string{"with-python"},
+		Toolchain:    map[string]string{"cmake": "cmake version 3.27.0"},
+		Dependencies: map[string]string{"zlib@1.3": "abc", "xz@5.4": "def"},
+	}
+	got := cacheKeyDifferences(entry, []string{"with-python"},
+		map[string]string{"cmake": "cmake version 3.28.1"},
+		map[string]string{"zlib@1.3": "not-installed", "xz@5.6": "def"})
+	want := []string{
+		"toolchain cmake: cmake version 3.28.1 here, cmake version 3.27.0 in the artifact",
+		"dependency xz@5.4: none here, def in the artifact",
+		"dependency xz@5.6: def here, none in the artifact",
+		"dependency zlib@1.3: not-installed here, abc in the artifact",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("cacheKeyDifferences() = %q, want %q", got, want)
+	}
+
+	// Entries pushed without toolchain versions only compare the rest
+	entry.Toolchain = nil
+	got = cacheKeyDifferences(entry, nil, map[string]string{"cmake": "cmake version 3.28.1"}, entry.Dependencies)
+	want = []string{"options: [] here, [with-python] in the artifact"}
+	if !slices.Equal(got, want) {
+		t.Errorf("cacheKeyDifferences() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,308 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/thisismeamir/hepsw/internal/builder"
+	"github.com/thisismeamir/hepsw/internal/configuration"
+	"github.com/thisismeamir/hepsw/internal/manifest"
+	"github.com/thisismeamir/hepsw/internal/workspace"
+)
+
+var (
+	buildOptions    []string
+	buildVariables  map[string]string
+	buildJobs       int
+	buildThirdParty bool
+	buildDeps       bool
+	buildFromIndex  bool
+	buildParallel   int
+	buildResume     bool
+	buildFromPhase  string
+	buildFromStep   int
+	// buildRelocatable gates installs on the relocatability audit
+	buildRelocatable bool
+	buildPrintEnv    bool
+	// buildIsolateNetwork runs the steps without network access
+	buildIsolateNetwork bool
+)
+
+var buildCmd = &cobra.Command{
+	Use:   "build [package[@version]...]",
+	Short: "Build and install a fetched package",
+	Long: `Build executes the configuration, build and install steps of the recipe
+of a fetched package. The output of every step is written to its own log file
+under ~/.hepsw/logs/<package-name>/<version>/, and the build stops at the first
+failing step.
+
+Dependencies are looked up among the fetched packages. Third-party packages
+imported with 'hepsw fetch --third-party' only satisfy dependencies when
+--third-party is given, but can always be built by naming them.
+
+Several packages, or a package with its fetched dependencies (--deps), are
+built in dependency order. Independent packages are built concurrently, up to
+parallelBuilds from the configuration or --parallel. When a package fails, the
+packages depending on it are skipped and the others are still built.
+--from-index takes the dependency tree resolved in the package index, as
+'hepsw fetch --deps-depth' does, instead of the manifests of the fetched
+packages; every package of the tree must be fetched.
+
+Builds selecting options (--with) or setting variables (--var) are variants:
+their build directory and install prefix are suffixed with +<build hash>, so
+they are installed next to the default build and recorded as
+<package>@<version>+<variant>.
+
+The wall time, CPU time and peak memory of every step are recorded in the
+build history of the workspace, see 'hepsw build-stats'.
+
+Every completed step is checkpointed in the build directory, keyed by a hash
+of its expanded command and inputs. --resume skips the steps whose checkpoint
+still matches and continues after the last one; --from-phase and --from-step
+force the build to restart at a given step. Without these flags a build
+starts from scratch.
+
+--verify-relocatable audits the staged install like 'hepsw verify
+--relocatable' and fails the install when the audit finds an issue.
+
+Steps run in a hermetic environment: a minimal environment, the build
+environment of the manifest, the self environments of the installed build
+dependencies and the directories of the toolchain tools, then the recipe
+variables. Nothing else from your shell is passed on. --print-env prints the
+environment the first step would see, with the layer setting each variable
+when --verbose is given, and exits without building; 'hepsw exec-step' runs a
+single step in it.
+
+--isolate-network, or isolateNetwork in the configuration, runs the
+configuration, build and install steps in an unprivileged user and network
+namespace of their own, where nothing can be downloaded: a build that fetches
+during CMake fails instead of depending on the network. Steps declaring
+network: true keep the network of the host, 'hepsw manifest lint' warns about
+them. It needs Linux with unprivileged user namespaces enabled.
+
+Example:
+  hepsw build root
+  hepsw build root@6.30.02 --with with-python -j 16
+  hepsw build geant4 --deps --parallel 4
+  hepsw build root --resume
+  hepsw build root --from-phase build --from-step 2
+  hepsw build root --print-env`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runBuild,
+}
+
+func init() {
+	buildCmd.Flags().StringSliceVar(&buildOptions, "with", []string{},
+		"build options to enable (e.g., with-python,with-gui)")
+	buildCmd.Flags().StringToStringVarP(&buildVariables, "var", "V", map[string]string{},
+		"set recipe variables (e.g., BUILD_TYPE=Debug)")
+	buildCmd.Flags().IntVarP(&buildJobs, "jobs", "j", 0,
+		"number of parallel jobs (default: number of CPUs)")
+	buildCmd.Flags().BoolVar(&buildThirdParty, "third-party", false,
+		"allow third-party packages to satisfy dependencies")
+	buildCmd.Flags().BoolVar(&buildDeps, "deps", false,
+		"also build the fetched dependencies of the packages")
+	buildCmd.Flags().BoolVar(&buildFromIndex, "from-index", false,
+		"take the dependencies from the package index instead of the fetched manifests (implies --deps)")
+	buildCmd.Flags().IntVarP(&buildParallel, "parallel", "P", 0,
+		"number of packages built concurrently (default: parallelBuilds)")
+	buildCmd.Flags().BoolVar(&buildResume, "resume", false,
+		"skip the steps completed by a previous build")
+	buildCmd.Flags().StringVar(&buildFromPhase, "from-phase", "",
+		"rerun the recipe from this phase, resuming the earlier steps")
+	buildCmd.Flags().IntVar(&buildFromStep, "from-step", 0,
+		"rerun the recipe from this step of --from-phase (counted from 1)")
+	buildCmd.Flags().BoolVar(&buildRelocatable, "verify-relocatable", false,
+		"fail the install when it is not relocatable (default: verifyRelocatable)")
+	buildCmd.Flags().BoolVar(&buildIsolateNetwork, "isolate-network", false,
+		"run the steps without network access (default: isolateNetwork)")
+	buildCmd.Flags().BoolVar(&buildPrintEnv, "print-env", false,
+		"print the environment of the recipe steps and exit")
+}
+
+func runBuild(cmd *cobra.Command, args []string) error {
+	config, err := configuration.GetConfiguration()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	if buildFromStep != 0 && buildFromPhase == "" {
+		return fmt.Errorf("--from-step requires --from-phase")
+	}
+	if buildFromStep < 0 {
+		return fmt.Errorf("--from-step counts from 1")
+	}
+
+	if len(args) > 1 || buildDeps || buildFromIndex {
+		if buildPrintEnv {
+			return fmt.Errorf("--print-env only applies to a single package")
+		}
+		if buildFromPhase != "" {
+			return fmt.Errorf("--from-phase only applies to a single package build")
+		}
+		if err := requireNetworkIsolation(config); err != nil {
+			return err
+		}
+		return runScheduledBuild(config, args)
+	}
+
+	pkg, err := workspace.Locate(config, args[0])
+	if err != nil {
+		return err
+	}
+	m := pkg.Manifest
+
+	if buildPrintEnv {
+		b, err := newBuilder(config, m, pkg.BuildFile.Src)
+		if err != nil {
+			return err
+		}
+		return printEnvironment(b)
+	}
+	if err := requireNetworkIsolation(config); err != nil {
+		return err
+	}
+
+	_, missing := workspace.ResolveDependencies(config, m, buildOptions,
+		workspace.ResolveOptions{AllowThirdParty: buildThirdParty})
+	missingNames := make([]string, 0, len(missing))
+	for name := range missing {
+		missingNames = append(missingNames, name)
+	}
+	sort.Strings(missingNames)
+	for _, name := range missingNames {
+		if reason := missing[name]; errors.Is(reason, workspace.ErrThirdParty) {
+			PrintWarning(fmt.Sprintf("Dependency %s is only available as a third-party package, use --third-party to use it", name))
+			continue
+		}
+		PrintWarning(fmt.Sprintf("Dependency %s is not in the workspace, it must be provided by the system", name))
+	}
+
+	b, err := newBuilder(config, m, pkg.BuildFile.Src)
+	if err != nil {
+		return err
+	}
+	if verbose {
+		b.Output = os.Stdout
+	}
+	b.Notify = printStepEvent
+
+	PrintSection(fmt.Sprintf("Building %s@%s", m.Name, m.Version))
+	PrintInfo("Source:  " + b.SourceDir)
+	PrintInfo("Build:   " + b.BuildDir)
+	PrintInfo("Install: " + b.InstallPrefix)
+	PrintInfo("Hash:    " + b.BuildHash)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	started := time.Now()
+	result, err := b.Run(ctx)
+	recordHistory(config, b, "build", started, result, err)
+	if err != nil {
+		if result != nil && result.Relocation != nil {
+			printRelocationReport(result.Relocation)
+		}
+		PrintError(err.Error())
+		return fmt.Errorf("build of %s@%s failed", m.Name, m.Version)
+	}
+
+	if err := config.Save(); err != nil {
+		return fmt.Errorf("failed to save configuration: %w", err)
+	}
+
+	PrintSuccess(fmt.Sprintf("Built and installed %s@%s", m.Name, b.PackageVersion()))
+	return nil
+}
+
+// newBuilder creates a builder with the options and variables of the command
+// line. The builder is identified, so its paths are final.
+func newBuilder(config *configuration.Configuration, m *manifest.Manifest, sourceDir string) (*builder.Builder, error) {
+	b := builder.New(config, m, sourceDir)
+	b.Options = buildOptions
+	for k, v := range buildVariables {
+		b.Variables[k] = v
+	}
+	if buildJobs > 0 {
+		b.Variables["NCORES"] = strconv.Itoa(buildJobs)
+	}
+	b.Resume = buildResume
+	b.FromPhase = buildFromPhase
+	b.FromStep = buildFromStep
+	b.CheckRelocatable = buildRelocatable || config.UserConfig.VerifyRelocatable
+	b.IsolateNetwork = isolateNetwork(config)
+	b.AllowThirdParty = buildThirdParty
+	if err := b.Identify(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// printEnvironment prints the environment of the first recipe step as
+// KEY=value lines, followed by the layer that set each variable when verbose.
+// Warnings go to stderr, keeping the output usable as it is.
+func printEnvironment(b *builder.Builder) error {
+	env, err := b.InitialEnvironment()
+	if err != nil {
+		return err
+	}
+	for _, warning := range env.Warnings {
+		fmt.Fprintln(os.Stderr, colorWarning("[WARN] "), warning)
+	}
+	for _, entry := range env.List() {
+		if verbose {
+			key, _, _ := strings.Cut(entry, "=")
+			entry += "  # " + env.Origins[key]
+		}
+		fmt.Println(entry)
+	}
+	return nil
+}
+
+// printStepEvent reports the progress of a recipe step
+func printStepEvent(event builder.StepEvent) {
+	position := fmt.Sprintf("[%s %d/%d] %s", event.Phase, event.Index+1, event.Total, event.Name)
+	switch event.Status {
+	case builder.StepRunning:
+		PrintBullet(position)
+	case builder.StepSkipped:
+		PrintInfo(position + " skipped: " + event.Reason)
+	case builder.StepRetrying:
+		PrintWarning(position + " " + event.Reason + ", retrying")
+	case builder.StepFailed:
+		PrintError(position + " failed")
+	case builder.StepIgnored:
+		PrintWarning(position + " failed, continuing: " + event.Reason)
+	case builder.StepDone:
+		if event.Duration > 0 {
+			PrintInfo(fmt.Sprintf("%s done in %s", position, event.Duration.Round(time.Millisecond)))
+		}
+	}
+}
+
+// isolateNetwork reports whether the configuration, build and install steps
+// run without network access, as asked by --isolate-network or the
+// configuration
+func isolateNetwork(config *configuration.Configuration) bool {
+	return buildIsolateNetwork || config.UserConfig.IsolateNetwork
+}
+
+// requireNetworkIsolation fails before anything is built when the steps
+// cannot be isolated from the network
+func requireNetworkIsolation(config *configuration.Configuration) error {
+	if !isolateNetwork(config) {
+		return nil
+	}
+	if err := builder.CheckNetworkIsolation(); err != nil {
+		return fmt.Errorf("%w; build without --isolate-network and isolateNetwork in the configuration to use the network of the host", err)
+	}
+	return nil
+}
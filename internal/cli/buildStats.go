@@ -0,0 +1,114 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+	"github.com/thisismeamir/hepsw/internal/configuration"
+	"github.com/thisismeamir/hepsw/internal/history"
+	"github.com/thisismeamir/hepsw/internal/workspace"
+)
+
+var (
+	buildStatsRuns int
+	buildStatsTop  int
+)
+
+var buildStatsCmd = &cobra.Command{
+	Use:   "build-stats [package...]",
+	Short: "Show build time trends, the slowest steps and the critical path",
+	Long: `Build-stats summarizes the build history recorded by 'hepsw build' and
+'hepsw run-recipe', for the named packages or all of them:
+
+  - the wall time of the latest successful run of every package, with the
+    earlier runs and the change against their average. Resumed runs, which
+    skipped steps completed before, are left out here and in the critical
+    path
+  - the recipe steps with the longest average wall time, with their CPU time
+    and peak resident memory
+  - the critical path: the chain of dependent packages whose latest runs add
+    up to the longest wall time, which bounds a parallel build of the stack.
+    With packages named, the path ends at one of them.
+
+Example:
+  hepsw build-stats
+  hepsw build-stats geant4 --top 20`,
+	RunE: runBuildStats,
+}
+
+func init() {
+	buildStatsCmd.Flags().IntVar(&buildStatsRuns, "runs", 10,
+		"number of recent runs per package to consider")
+	buildStatsCmd.Flags().IntVar(&buildStatsTop, "top", 10,
+		"number of slowest steps to show")
+}
+
+func runBuildStats(cmd *cobra.Command, args []string) error {
+	config, err := configuration.GetConfiguration()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	db, err := openHistory(config)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	names := make([]string, 0, len(args))
+	for _, arg := range args {
+		name, _ := workspace.ParseReference(arg)
+		names = append(names, name)
+	}
+
+	// The critical path follows dependencies that were not named
+	all, err := db.Runs(nil, buildStatsRuns)
+	if err != nil {
+		return err
+	}
+	runs := all
+	if len(names) > 0 {
+		if runs, err = db.Runs(names, buildStatsRuns); err != nil {
+			return err
+		}
+	}
+	if len(runs) == 0 {
+		PrintInfo("No builds recorded yet, run 'hepsw build' or 'hepsw run-recipe' first")
+		return nil
+	}
+
+	PrintSection("Build time trends")
+	for _, trend := range history.Trends(runs) {
+		earlier := make([]string, 0, len(trend.WallTimes)-1)
+		for _, wall := range trend.WallTimes[1:] {
+			earlier = append(earlier, formatDuration(wall))
+		}
+		line := fmt.Sprintf("%s@%s  %s", trend.Package, trend.Version, formatDuration(trend.Latest))
+		if len(earlier) > 0 {
+			line += fmt.Sprintf("  (%+.0f%%, earlier: %s)", trend.Change()*100, strings.Join(earlier, ", "))
+		}
+		PrintBullet(line)
+	}
+
+	PrintSection("Slowest steps")
+	fmt.Printf("  %-20s %-14s %-28s %10s %10s %10s %10s\n", "PACKAGE", "PHASE", "STEP", "AVG WALL", "MAX WALL", "AVG CPU", "PEAK RSS")
+	for _, stat := range history.SlowestSteps(runs, buildStatsTop) {
+		fmt.Printf("  %-20s %-14s %-28s %10s %10s %10s %10s\n", truncate(stat.Package, 20), stat.Phase, truncate(stat.Name, 28),
+			formatDuration(stat.AverageWall), formatDuration(stat.MaxWall), formatDuration(stat.AverageCPU),
+			humanize.IBytes(uint64(stat.PeakRSS)))
+	}
+
+	path, total := history.CriticalPath(all, names)
+	PrintSection("Critical path")
+	if len(path) == 0 {
+		PrintInfo("No successful builds recorded")
+		return nil
+	}
+	for _, node := range path {
+		PrintBullet(fmt.Sprintf("%s@%s  %s", node.Package, node.Version, formatDuration(node.WallTime)))
+	}
+	PrintInfo(fmt.Sprintf("%d package(s), %s", len(path), formatDuration(total)))
+	return nil
+}
@@ -0,0 +1,168 @@
+package cli
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+	"github.com/thisismeamir/hepsw/internal/configuration"
+	"github.com/thisismeamir/hepsw/internal/distfiles"
+)
+
+var (
+	cachePruneOlderThan time.Duration
+	cachePruneAll       bool
+	cacheVerifyRemove   bool
+)
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage the caches of source archives and prebuilt packages",
+	Long: `Source archives are downloaded once into a content-addressed cache keyed
+by their checksum (or by their URL when no checksum is declared). The cache
+location is set by 'distfiles' in hepsw.yaml and can be shared by several
+workspaces on the same machine.
+
+Installed packages can be pushed into a binary cache keyed by their build hash
+and pulled into another workspace instead of being built. The cache pushed to
+is set by 'binaryCache', further directories or http(s) endpoints to pull from
+by 'binaryCaches'.`,
+}
+
+var cacheLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "List cached source archives and prebuilt packages",
+	Args:  cobra.NoArgs,
+	RunE:  runCacheLs,
+}
+
+var cachePruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove source archives that have not been used recently",
+	Args:  cobra.NoArgs,
+	RunE:  runCachePrune,
+}
+
+var cacheVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Re-hash cached source archives and report corrupted ones",
+	Args:  cobra.NoArgs,
+	RunE:  runCacheVerify,
+}
+
+func init() {
+	cacheCmd.AddCommand(cacheLsCmd)
+	cacheCmd.AddCommand(cachePruneCmd)
+	cacheCmd.AddCommand(cacheVerifyCmd)
+	cacheCmd.AddCommand(cachePushCmd)
+	cacheCmd.AddCommand(cachePullCmd)
+
+	cachePruneCmd.Flags().DurationVar(&cachePruneOlderThan, "older-than", 30*24*time.Hour,
+		"remove archives not used for this long")
+	cachePruneCmd.Flags().BoolVar(&cachePruneAll, "all", false,
+		"remove every cached archive")
+	cacheVerifyCmd.Flags().BoolVar(&cacheVerifyRemove, "remove", false,
+		"remove corrupted archives so they are downloaded again")
+}
+
+func openDistfileCache() (*distfiles.Cache, error) {
+	config, err := configuration.GetConfiguration()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+	return distfiles.New(config.DistfilesDir()), nil
+}
+
+func runCacheLs(cmd *cobra.Command, args []string) error {
+	config, err := configuration.GetConfiguration()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	cache := distfiles.New(config.DistfilesDir())
+
+	entries, err := cache.Entries()
+	if err != nil {
+		return err
+	}
+
+	if len(entries) == 0 {
+		PrintInfo("No cached archives in " + cache.Dir)
+		return printBinaryCache(config)
+	}
+
+	var total uint64
+	PrintSection("Cached archives in " + cache.Dir)
+	for _, entry := range entries {
+		total += uint64(entry.Size)
+		PrintBullet(fmt.Sprintf("%s (%s, last used %s)", entry.Url, humanize.Bytes(uint64(entry.Size)), entry.LastUsed))
+		if entry.Checksum != "" {
+			fmt.Printf("      %s\n", entry.Checksum)
+		}
+	}
+	PrintInfo(fmt.Sprintf("%d archive(s), %s", len(entries), humanize.Bytes(total)))
+	return printBinaryCache(config)
+}
+
+func runCachePrune(cmd *cobra.Command, args []string) error {
+	cache, err := openDistfileCache()
+	if err != nil {
+		return err
+	}
+
+	unusedSince := time.Now().Add(-cachePruneOlderThan)
+	if cachePruneAll {
+		unusedSince = time.Now()
+	}
+
+	removed, err := cache.Prune(unusedSince)
+	if err != nil {
+		return err
+	}
+
+	var freed uint64
+	for _, entry := range removed {
+		freed += uint64(entry.Size)
+		PrintBullet("Removed " + entry.Url)
+	}
+	PrintSuccess(fmt.Sprintf("Pruned %d archive(s), freed %s", len(removed), humanize.Bytes(freed)))
+	return nil
+}
+
+func runCacheVerify(cmd *cobra.Command, args []string) error {
+	cache, err := openDistfileCache()
+	if err != nil {
+		return err
+	}
+
+	entries, err := cache.Entries()
+	if err != nil {
+		return err
+	}
+
+	corrupted := 0
+	for _, entry := range entries {
+		if err := cache.Verify(entry); err != nil {
+			corrupted++
+			PrintError(entry.Url + ": " + err.Error())
+			if cacheVerifyRemove {
+				if err := cache.Remove(entry); err != nil {
+					return err
+				}
+				PrintBullet("Removed " + entry.Url)
+			}
+			continue
+		}
+		PrintBullet("OK " + entry.Url)
+	}
+
+	if corrupted > 0 {
+		if cacheVerifyRemove {
+			PrintWarning(fmt.Sprintf("Removed %d corrupted archive(s)", corrupted))
+			return nil
+		}
+		return fmt.Errorf("%d of %d cached archive(s) are corrupted, remove them with 'hepsw cache verify --remove'", corrupted, len(entries))
+	}
+	PrintSuccess(fmt.Sprintf("All %d cached archive(s) are intact", len(entries)))
+	return nil
+}
@@ -0,0 +1,129 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"github.com/thisismeamir/hepsw/internal/builder"
+	"github.com/thisismeamir/hepsw/internal/configuration"
+	"github.com/thisismeamir/hepsw/internal/manifest"
+	"github.com/thisismeamir/hepsw/internal/manifest/loader"
+	"github.com/thisismeamir/hepsw/internal/workspace"
+)
+
+var execStepCmd = &cobra.Command{
+	Use:   "exec-step <manifest> <phase> <n>",
+	Short: "Run a single recipe step in the hermetic build environment",
+	Long: `Exec-step runs step n (counted from 1) of a recipe phase against the fetched
+source of the package, in the environment a build would give it, and streams
+its output.
+
+Recipe steps never see the environment of your shell. They start from a
+minimal environment (PATH=/usr/local/bin:/usr/bin:/bin:/usr/sbin:/sbin, HOME,
+USER, TERM, TMPDIR and the locale), to which the build environment of the
+manifest, the self environments of the installed build dependencies and the
+directories of the toolchain tools are added, then the recipe variables and
+the env of the step. 'hepsw build --print-env' prints it.
+
+The variables set by the earlier steps are replayed, those they captured are
+taken from the checkpoints of a previous build. Checkpoints are not updated
+and nothing is recorded in the workspace. Install steps run against a fresh
+staging area next to the install prefix, <prefix>.staging, which is left in
+place for inspection.
+
+Example:
+  hepsw exec-step root.yaml configuration 1
+  hepsw exec-step root@6.30.02 build 2 --with with-python`,
+	Args: cobra.ExactArgs(3),
+	RunE: runExecStep,
+}
+
+func init() {
+	execStepCmd.Flags().StringSliceVar(&buildOptions, "with", []string{},
+		"build options to enable (e.g., with-python,with-gui)")
+	execStepCmd.Flags().StringToStringVarP(&buildVariables, "var", "V", map[string]string{},
+		"set recipe variables (e.g., BUILD_TYPE=Debug)")
+	execStepCmd.Flags().IntVarP(&buildJobs, "jobs", "j", 0,
+		"number of parallel jobs (default: number of CPUs)")
+	execStepCmd.Flags().BoolVar(&buildIsolateNetwork, "isolate-network", false,
+		"run the step without network access (default: isolateNetwork)")
+}
+
+func runExecStep(cmd *cobra.Command, args []string) error {
+	config, err := configuration.GetConfiguration()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	phase := args[1]
+	n, err := strconv.Atoi(args[2])
+	if err != nil || n < 1 {
+		return fmt.Errorf("invalid step %q, steps are counted from 1", args[2])
+	}
+
+	m, err := loader.LoadManifest(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to load manifest: %w", err)
+	}
+	if !slices.Contains([]string{builder.PhaseConfiguration, builder.PhaseBuild, builder.PhaseTest, builder.PhaseInstall}, phase) {
+		return fmt.Errorf("unknown recipe phase %q", phase)
+	}
+	if steps := manifest.NewManifestAccessor(m).GetStepsByPhase(phase); n > len(steps) {
+		return fmt.Errorf("the %s phase of %s@%s has %d step(s)", phase, m.Name, m.Version, len(steps))
+	}
+
+	sourceDir := workspace.SourceDir(config, m.Name, m.Version)
+	if fetched, err := workspace.Locate(config, m.Name+"@"+m.Version); err == nil {
+		sourceDir = fetched.BuildFile.Src
+	} else {
+		PrintWarning(fmt.Sprintf("%s@%s is not fetched, the step runs against %s", m.Name, m.Version, sourceDir))
+	}
+
+	b, err := newBuilder(config, m, sourceDir)
+	if err != nil {
+		return err
+	}
+	if phase != builder.PhaseTest {
+		if err := requireNetworkIsolation(config); err != nil {
+			return err
+		}
+	}
+	b.Output = os.Stdout
+	b.Notify = printStepEvent
+
+	env, err := b.InitialEnvironment()
+	if err != nil {
+		return err
+	}
+	for _, warning := range env.Warnings {
+		PrintWarning(warning)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	result, err := b.ExecStep(ctx, phase, n-1)
+	if err != nil {
+		PrintError(err.Error())
+		return fmt.Errorf("step %d of the %s phase of %s@%s failed", n, phase, m.Name, m.Version)
+	}
+	if result.Failed {
+		return fmt.Errorf("step %d of the %s phase of %s@%s failed", n, phase, m.Name, m.Version)
+	}
+	if result.Skipped {
+		PrintWarning(fmt.Sprintf("Step %d of the %s phase did not run: %s", n, phase, result.Reason))
+		return nil
+	}
+	if result.LogPath != "" {
+		PrintInfo("Log: " + result.LogPath)
+	}
+	if phase == builder.PhaseInstall {
+		PrintInfo("Staged install: " + b.StagingDir())
+	}
+	return nil
+}
@@ -0,0 +1,263 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/thisismeamir/hepsw/internal/configuration"
+	"github.com/thisismeamir/hepsw/internal/fetch"
+	"github.com/thisismeamir/hepsw/internal/index"
+	"github.com/thisismeamir/hepsw/internal/manifest"
+	"github.com/thisismeamir/hepsw/internal/manifest/loader"
+	"github.com/thisismeamir/hepsw/internal/workspace"
+)
+
+var (
+	fetchPath   string
+	fetchForce  bool
+	fetchUpdate bool
+	fetchDepth  int
+	fetchJobs   int
+	fetchThird  string
+)
+
+var fetchCmd = &cobra.Command{
+	Use:   "fetch [package[@version]...]",
+	Short: "Fetch package sources into the workspace",
+	Long: `Fetch resolves the manifest of each package from the index and downloads,
+clones or copies its source into ~/.hepsw/sources/<package-name>/<version>/src.
+The manifest is stored beside the source together with a generated build.yml,
+so the build can be delayed.
+
+With --deps-depth the dependency tree of each package is resolved from the
+index and every package up to that depth is fetched as well, several at a time.
+
+With --third-party a manifest that is not in the index is imported from a local
+file. It is validated, stored under ~/.hepsw/thirdparty/<package-name>/<version>
+and marked as third-party, so it is only used as a dependency when explicitly
+allowed.
+
+Example:
+  hepsw fetch root
+  hepsw fetch root@6.30.02 pythia8
+  hepsw fetch geant4 --deps-depth 2
+  hepsw fetch --third-party ./my-analysis.yaml`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if fetchThird != "" {
+			return cobra.NoArgs(cmd, args)
+		}
+		return cobra.MinimumNArgs(1)(cmd, args)
+	},
+	RunE: runFetch,
+}
+
+func init() {
+	fetchCmd.Flags().StringVarP(&fetchPath, "path", "p", "",
+		"custom source path instead of the workspace (not recommended)")
+	fetchCmd.Flags().BoolVarP(&fetchForce, "force", "f", false,
+		"re-fetch even if the source is already present")
+	fetchCmd.Flags().IntVarP(&fetchDepth, "deps-depth", "d", 0,
+		"also fetch dependencies up to the specified depth")
+	fetchCmd.Flags().IntVarP(&fetchJobs, "jobs", "j", 0,
+		"number of concurrent fetches with --deps-depth (default: parallelBuilds)")
+	fetchCmd.Flags().StringVarP(&fetchThird, "third-party", "t", "",
+		"import a third-party manifest from a local path")
+	fetchCmd.Flags().BoolVar(&fetchUpdate, "update", false,
+		"resolve git tags and svn revisions again instead of reusing the recorded ones")
+}
+
+func runFetch(cmd *cobra.Command, args []string) error {
+	if fetchPath != "" && len(args) > 1 {
+		return fmt.Errorf("--path can only be used when fetching a single package")
+	}
+
+	if fetchPath != "" && fetchDepth > 0 {
+		return fmt.Errorf("--path cannot be combined with --deps-depth")
+	}
+
+	config, err := configuration.GetConfiguration()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	if fetchThird != "" {
+		return runFetchThirdParty(config, fetchThird)
+	}
+
+	if fetchDepth > 0 {
+		return runFetchTree(cmd.Context(), config, args)
+	}
+
+	for _, reference := range args {
+		PrintSection("Fetching: " + reference)
+
+		m, err := loader.LoadManifestFromIndex(reference)
+		if err != nil {
+			return fmt.Errorf("failed to fetch manifest: %w", err)
+		}
+		PrintInfo(fmt.Sprintf("Found %s@%s (%s source)", m.Name, m.Version, m.Source.Type))
+
+		result, err := fetch.FetchPackage(config, m, fetch.Options{
+			SourcePath: fetchPath,
+			Force:      fetchForce,
+			Update:     fetchUpdate,
+			Output:     os.Stdout,
+		})
+		if err != nil {
+			return err
+		}
+
+		if result.Skipped {
+			PrintWarning(fmt.Sprintf("%s@%s is already fetched, use --force to re-fetch", m.Name, m.Version))
+			continue
+		}
+
+		if err := config.Save(); err != nil {
+			return fmt.Errorf("failed to save configuration: %w", err)
+		}
+
+		printFetchResult(result)
+		PrintSuccess(fmt.Sprintf("Fetched %s@%s", m.Name, m.Version))
+	}
+
+	return nil
+}
+
+// runFetchThirdParty imports a local manifest that is not part of the index
+func runFetchThirdParty(config *configuration.Configuration, manifestPath string) error {
+	PrintSection("Importing third-party manifest: " + manifestPath)
+
+	m, err := loader.LoadManifestFromFile(manifestPath)
+	if err != nil {
+		return fmt.Errorf("failed to load manifest: %w", err)
+	}
+
+	validation := manifest.ValidateManifest(m)
+	for _, warning := range validation.Warnings {
+		PrintWarning(warning.String())
+	}
+	if !validation.Valid {
+		for _, validationError := range validation.Errors {
+			PrintError(validationError.String())
+		}
+		return fmt.Errorf("%s is not a valid manifest, see 'hepsw manifest validate %s'", manifestPath, manifestPath)
+	}
+	PrintInfo(fmt.Sprintf("Found %s@%s (%s source)", m.Name, m.Version, m.Source.Type))
+
+	manifestDir, err := filepath.Abs(filepath.Dir(manifestPath))
+	if err != nil {
+		return fmt.Errorf("failed to resolve path: %w", err)
+	}
+
+	result, err := fetch.FetchPackage(config, m, fetch.Options{
+		SourcePath:  fetchPath,
+		Force:       fetchForce,
+		Update:      fetchUpdate,
+		ManifestDir: manifestDir,
+		Output:      os.Stdout,
+		ThirdParty:  true,
+	})
+	if err != nil {
+		return err
+	}
+
+	if result.Skipped {
+		PrintWarning(fmt.Sprintf("%s@%s is already imported, use --force to re-import", m.Name, m.Version))
+		return nil
+	}
+
+	if err := config.Save(); err != nil {
+		return fmt.Errorf("failed to save configuration: %w", err)
+	}
+
+	printFetchResult(result)
+	PrintSuccess(fmt.Sprintf("Imported %s@%s as a third-party package", m.Name, m.Version))
+	return nil
+}
+
+// printFetchResult lists where a fetched package ended up
+func printFetchResult(result *fetch.Result) {
+	PrintBullet("Source:   " + result.Src)
+	PrintBullet("Manifest: " + result.Manifest)
+	PrintBullet("Build:    " + result.BuildFile)
+	for _, patch := range result.Patches {
+		PrintBullet("Patched:  " + patch.Name)
+	}
+	if result.Commit != "" {
+		PrintBullet("Commit:   " + result.Commit)
+	}
+	if result.Pinned {
+		PrintInfo("Checked out the recorded commit, use --update to resolve the tag again")
+	}
+}
+
+// runFetchTree fetches the packages and their dependencies up to --deps-depth
+func runFetchTree(ctx context.Context, config *configuration.Configuration, args []string) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	idx, err := index.New(&config.IndexConfig)
+	if err != nil {
+		return fmt.Errorf("failed to open the package index: %w", err)
+	}
+	defer idx.Close()
+
+	targets := make([]fetch.Target, 0)
+	for _, reference := range args {
+		name, version := workspace.ParseReference(reference)
+		tree, err := idx.ResolveDependencyTree(ctx, name, version, false)
+		if err != nil {
+			return fmt.Errorf("failed to resolve dependencies of %s: %w", reference, err)
+		}
+		targets = append(targets, fetch.TargetsFromTree(tree, fetchDepth)...)
+	}
+
+	workers := fetchJobs
+	if workers <= 0 {
+		workers = config.UserConfig.ParallelBuilds
+	}
+
+	PrintSection(fmt.Sprintf("Fetching %d package(s) up to depth %d", len(targets), fetchDepth))
+	load := func(name, version string) (*manifest.Manifest, error) {
+		return loader.LoadManifestFromIndex(name + "@" + version)
+	}
+	summary := fetch.FetchTree(ctx, config, targets, load, fetch.Options{
+		Force:  fetchForce,
+		Update: fetchUpdate,
+	}, workers)
+
+	if err := config.Save(); err != nil {
+		return fmt.Errorf("failed to save configuration: %w", err)
+	}
+
+	if len(summary.Fetched) > 0 {
+		PrintSection("Fetched")
+		for _, r := range summary.Fetched {
+			PrintBullet(fmt.Sprintf("%s (depth %d)", r.Target.ID(), r.Target.Depth))
+		}
+	}
+	if len(summary.Present) > 0 {
+		PrintSection("Already present")
+		for _, r := range summary.Present {
+			PrintBullet(fmt.Sprintf("%s (depth %d)", r.Target.ID(), r.Target.Depth))
+		}
+	}
+	if len(summary.Failed) > 0 {
+		PrintSection("Failed")
+		for _, r := range summary.Failed {
+			PrintError(fmt.Sprintf("%s: %v", r.Target.ID(), r.Err))
+		}
+	}
+
+	fmt.Println()
+	if len(summary.Failed) > 0 {
+		total := len(summary.Fetched) + len(summary.Present) + len(summary.Failed)
+		return fmt.Errorf("%d of %d package(s) failed to fetch", len(summary.Failed), total)
+	}
+	PrintSuccess(fmt.Sprintf("%d fetched, %d already present", len(summary.Fetched), len(summary.Present)))
+	return nil
+}
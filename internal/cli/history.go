@@ -0,0 +1,78 @@
+package cli
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/thisismeamir/hepsw/internal/builder"
+	"github.com/thisismeamir/hepsw/internal/configuration"
+	"github.com/thisismeamir/hepsw/internal/history"
+	"github.com/thisismeamir/hepsw/internal/manifest"
+)
+
+// openHistory opens the build history database of the workspace
+func openHistory(config *configuration.Configuration) (*history.DB, error) {
+	return history.Open(filepath.Join(config.Workspace, history.FileName))
+}
+
+// recordHistory stores the steps of a recipe run in the build history. A
+// history that cannot be written only produces a warning, it never fails the
+// build.
+func recordHistory(config *configuration.Configuration, b *builder.Builder, command string, started time.Time, result *builder.Result, runErr error) {
+	run := &history.Run{
+		Package:   b.Manifest.Name,
+		Version:   b.PackageVersion(),
+		BuildHash: b.BuildHash,
+		Command:   command,
+		StartedAt: started,
+		WallTime:  time.Since(started),
+		Succeeded: runErr == nil,
+		Steps:     make([]history.Step, 0),
+	}
+	for _, dep := range manifest.NewManifestAccessor(b.Manifest).GetDependenciesForOptions(b.Options) {
+		run.Dependencies = append(run.Dependencies, dep.Name)
+	}
+	if result != nil {
+		for _, step := range result.Steps {
+			// Steps only setting variables run no process
+			if step.LogPath == "" && !step.Skipped {
+				continue
+			}
+			status := history.StatusDone
+			if step.Skipped {
+				status = history.StatusSkipped
+				run.Partial = true
+			} else if step.Failed {
+				status = history.StatusFailed
+			}
+			run.Steps = append(run.Steps, history.Step{
+				Phase:      step.Phase,
+				Index:      step.Index,
+				Name:       step.Name,
+				Status:     status,
+				WallTime:   step.Duration,
+				UserTime:   step.UserTime,
+				SystemTime: step.SystemTime,
+				PeakRSS:    step.PeakRSS,
+			})
+		}
+	}
+
+	db, err := openHistory(config)
+	if err != nil {
+		PrintWarning("Build history not recorded: " + err.Error())
+		return
+	}
+	defer db.Close()
+	if err := db.Record(run); err != nil {
+		PrintWarning("Build history not recorded: " + err.Error())
+	}
+}
+
+// formatDuration rounds a duration for display
+func formatDuration(d time.Duration) string {
+	if d < 10*time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+	return d.Round(time.Second).String()
+}
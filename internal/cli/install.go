@@ -0,0 +1,96 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/spf13/cobra"
+	"github.com/thisismeamir/hepsw/internal/configuration"
+	"github.com/thisismeamir/hepsw/internal/workspace"
+)
+
+var installCmd = &cobra.Command{
+	Use:   "install <package[@version]>",
+	Short: "Install a built package",
+	Long: `Install runs the install steps of the recipe of a package against its
+existing build directory, so the package must have been built first.
+
+Installs are staged: the install steps run with INSTALL_PREFIX pointing at a
+staging directory beside the install prefix and DESTDIR exported, so that
+build systems configured with the real prefix install into the staging area
+as well. Once every step succeeded and the staged tree is not empty, it is
+renamed into ~/.hepsw/installs/<package-name>/<version>. A failed install
+leaves the previous install untouched. 'hepsw build' installs the same way.
+--verify-relocatable also fails the install when the staged tree does not pass
+the relocatability audit of 'hepsw verify --relocatable'.
+
+Example:
+  hepsw install root
+  hepsw install root@6.30.02 --with with-python`,
+	Args: cobra.ExactArgs(1),
+	RunE: runInstall,
+}
+
+func init() {
+	// The recipe variables must match the ones the package was built with
+	installCmd.Flags().StringSliceVar(&buildOptions, "with", []string{},
+		"build options to enable (e.g., with-python,with-gui)")
+	installCmd.Flags().StringToStringVarP(&buildVariables, "var", "V", map[string]string{},
+		"set recipe variables (e.g., BUILD_TYPE=Debug)")
+	installCmd.Flags().IntVarP(&buildJobs, "jobs", "j", 0,
+		"number of parallel jobs (default: number of CPUs)")
+	installCmd.Flags().BoolVar(&buildRelocatable, "verify-relocatable", false,
+		"fail the install when it is not relocatable (default: verifyRelocatable)")
+	installCmd.Flags().BoolVar(&buildIsolateNetwork, "isolate-network", false,
+		"run the steps without network access (default: isolateNetwork)")
+}
+
+func runInstall(cmd *cobra.Command, args []string) error {
+	config, err := configuration.GetConfiguration()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	pkg, err := workspace.Locate(config, args[0])
+	if err != nil {
+		return err
+	}
+	m := pkg.Manifest
+
+	b, err := newBuilder(config, m, pkg.BuildFile.Src)
+	if err != nil {
+		return err
+	}
+	if err := requireNetworkIsolation(config); err != nil {
+		return err
+	}
+	if verbose {
+		b.Output = os.Stdout
+	}
+	b.Notify = printStepEvent
+
+	PrintSection(fmt.Sprintf("Installing %s@%s", m.Name, m.Version))
+	PrintInfo("Build:   " + b.BuildDir)
+	PrintInfo("Install: " + b.InstallPrefix)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	result, err := b.Install(ctx)
+	if err != nil {
+		if result != nil && result.Relocation != nil {
+			printRelocationReport(result.Relocation)
+		}
+		PrintError(err.Error())
+		return fmt.Errorf("install of %s@%s failed", m.Name, m.Version)
+	}
+
+	if err := config.Save(); err != nil {
+		return fmt.Errorf("failed to save configuration: %w", err)
+	}
+
+	PrintSuccess(fmt.Sprintf("Installed %s@%s", m.Name, b.PackageVersion()))
+	return nil
+}
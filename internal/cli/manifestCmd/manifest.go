@@ -2,6 +2,7 @@ package manifestCmd
 
 import (
 	"github.com/spf13/cobra"
+	"github.com/thisismeamir/hepsw/internal/checksum"
 )
 
 // ManifestCmd represents the manifest command
@@ -32,6 +33,13 @@ var (
 	walkOptions         []string
 	walkVariables       map[string]string
 	showFormat          string
+	showOptions         []string
+	sourceVerify        bool
+	sourceDownload      bool
+	sourceCompute       bool
+	sourceArchive       string
+	sourceAlgorithm     string
+	checkSuggest        bool
 )
 
 // manifestFetchCmd fetches manifest from registry
@@ -145,9 +153,35 @@ Scopes:
 var manifestSourceCmd = &cobra.Command{
 	Use:   "source [manifest]",
 	Short: "Inspect and verify source metadata (URLs, checksums, SCM refs)",
-	Long:  `Display detailed information about the package source.`,
-	Args:  cobra.ExactArgs(1),
-	RunE:  runManifestSource,
+	Long: `Display detailed information about the package source.
+
+With --download the archive is downloaded into the distfile cache, trying the
+source URL, its mirrors and the configured mirror rewrites in the listed order.
+Each attempt is verified against the declared checksum.
+
+With --verify the source archive is downloaded (or read from --archive) and its
+digest is compared with the declared checksum. With --compute a missing
+checksum is computed and added to the source section of the manifest file,
+leaving its comments and layout untouched; when the file cannot be edited in
+place, the line to add is printed instead.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runManifestSource,
+}
+
+// manifestPrepareCmd applies source patches
+var manifestPrepareCmd = &cobra.Command{
+	Use:   "prepare [manifest] [src-dir]",
+	Short: "Apply the source patches of a manifest to a source directory",
+	Long: `Apply the patches listed in source.patches to a source directory, in order.
+
+Relative patch paths are resolved against the directory of the manifest file.
+Either all patches are applied or none, and the applied patches are recorded
+in the source directory so running prepare again does not re-apply them.
+
+Example:
+  hepsw manifest prepare geant4.yaml ~/.hepsw/sources/geant4/10.7.4/src`,
+	Args: cobra.ExactArgs(2),
+	RunE: runManifestPrepare,
 }
 
 // manifestRecipeCmd shows recipe steps
@@ -228,7 +262,13 @@ var manifestCheckCmd = &cobra.Command{
   - Dependency cycles
   - Incompatible options
   - Target mismatches
-  - Version conflicts`,
+  - Version conflicts
+  - Runtime dependencies: the DT_NEEDED libraries of the installed package are
+    resolved against the install prefixes of the other workspace packages, and
+    linked packages that are not runtime dependencies, or runtime dependencies
+    that are not linked against, are reported
+
+With --suggest the runtime dependency entries to add are printed.`,
 	Args: cobra.ExactArgs(1),
 	RunE: runManifestCheck,
 }
@@ -255,9 +295,13 @@ Checks include:
 var manifestShowCmd = &cobra.Command{
 	Use:   "show [manifest]",
 	Short: "Print a normalized, fully-resolved view of a manifest",
-	Long:  `Displays the manifest in a human-readable format with all fields resolved.`,
-	Args:  cobra.ExactArgs(1),
-	RunE:  runManifestShow,
+	Long: `Displays the manifest in a human-readable format with all fields resolved.
+
+The text and markdown formats end with the build hash the manifest has in the
+current workspace, for the options given with --with, and whether the matching
+install is up to date.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runManifestShow,
 }
 
 // manifestInspectCmd inspects specific fields
@@ -310,6 +354,7 @@ func init() {
 	ManifestCmd.AddCommand(manifestOptionsCmd)
 	ManifestCmd.AddCommand(manifestEnvCmd)
 	ManifestCmd.AddCommand(manifestSourceCmd)
+	ManifestCmd.AddCommand(manifestPrepareCmd)
 	ManifestCmd.AddCommand(manifestRecipeCmd)
 
 	manifestDepsCmd.Flags().StringVarP(&depsFormat, "format", "f", "tree",
@@ -320,6 +365,17 @@ func init() {
 	manifestEnvCmd.Flags().StringVarP(&envScope, "scope", "s", "all",
 		"Environment scope (build, runtime, self, all)")
 
+	manifestSourceCmd.Flags().BoolVar(&sourceDownload, "download", false,
+		"Download the source archive, trying the URL and its mirrors in order")
+	manifestSourceCmd.Flags().BoolVar(&sourceVerify, "verify", false,
+		"Download the source archive and verify it against the declared checksum")
+	manifestSourceCmd.Flags().BoolVar(&sourceCompute, "compute", false,
+		"Compute a missing checksum and write it into the manifest")
+	manifestSourceCmd.Flags().StringVar(&sourceArchive, "archive", "",
+		"Use an already downloaded copy of the source archive")
+	manifestSourceCmd.Flags().StringVar(&sourceAlgorithm, "algorithm", checksum.DefaultAlgorithm,
+		"Checksum algorithm used by --compute (md5, sha1, sha256, sha512)")
+
 	manifestRecipeCmd.Flags().StringSliceVarP(&walkOptions, "options", "o", []string{},
 		"Build options to enable")
 
@@ -330,6 +386,9 @@ func init() {
 	ManifestCmd.AddCommand(manifestLintCmd)
 	ManifestCmd.AddCommand(manifestCheckCmd)
 
+	manifestCheckCmd.Flags().BoolVar(&checkSuggest, "suggest", false,
+		"Print the runtime dependency entries to add to the manifest")
+
 	manifestFormatCmd.Flags().IntVar(&formatIndent, "indent", 2,
 		"Number of spaces for indentation")
 
@@ -356,6 +415,8 @@ func init() {
 
 	manifestShowCmd.Flags().StringVarP(&showFormat, "format", "f", "text",
 		"Output format (text, yaml, json)")
+	manifestShowCmd.Flags().StringSliceVar(&showOptions, "with", []string{},
+		"build options the build hash is computed for")
 
 	manifestWalkCmd.Flags().StringSliceVarP(&walkOptions, "options", "o", []string{},
 		"Build options to enable (e.g., with-ssl,with-gui)")
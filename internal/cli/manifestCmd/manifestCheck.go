@@ -5,8 +5,10 @@ import (
 	"strings"
 
 	"github.com/spf13/cobra"
+	"github.com/thisismeamir/hepsw/internal/configuration"
 	"github.com/thisismeamir/hepsw/internal/manifest"
 	"github.com/thisismeamir/hepsw/internal/manifest/loader"
+	"github.com/thisismeamir/hepsw/internal/workspace"
 )
 
 func runManifestCheck(cmd *cobra.Command, args []string) error {
@@ -27,6 +29,12 @@ func runManifestCheck(cmd *cobra.Command, args []string) error {
 	// Additional deep checks
 	deepIssues := performDeepChecks(m)
 
+	// Runtime dependencies against the shared libraries the install links
+	linkage, linkageNote := checkRuntimeLinkage(m)
+	if linkage != nil {
+		deepIssues = append(deepIssues, linkageIssues(linkage)...)
+	}
+
 	// Print all issues
 	hasIssues := false
 
@@ -60,10 +68,89 @@ func runManifestCheck(cmd *cobra.Command, args []string) error {
 	if !hasIssues {
 		fmt.Println("✓ All checks passed")
 	}
+	if linkageNote != "" {
+		fmt.Printf("ℹ %s\n", linkageNote)
+	}
+
+	if checkSuggest && linkage != nil {
+		fmt.Println()
+		printDependencySuggestions(linkage)
+	}
 
 	return nil
 }
 
+// checkRuntimeLinkage resolves the shared libraries the install of the
+// manifest links against to workspace packages. Without an install the
+// reason is returned instead.
+func checkRuntimeLinkage(m *manifest.Manifest) (*workspace.RuntimeLinkage, string) {
+	config, err := configuration.GetConfiguration()
+	if err != nil {
+		return nil, "Runtime linkage not checked: no workspace configuration"
+	}
+
+	pkg, ok := config.FindPackage(m.Name, m.Version)
+	if !ok {
+		for i := range config.State.Packages {
+			if config.State.Packages[i].Name == m.Name {
+				pkg, ok = &config.State.Packages[i], true
+				break
+			}
+		}
+	}
+	if !ok {
+		return nil, fmt.Sprintf("Runtime linkage not checked: %s is not installed", m.Name)
+	}
+
+	linkage, err := workspace.CheckRuntimeLinkage(config, m, *pkg)
+	if err != nil {
+		return nil, fmt.Sprintf("Runtime linkage not checked: %v", err)
+	}
+	return linkage, fmt.Sprintf("Runtime linkage checked against %s (%d workspace package(s) linked, %d library(ies) left to the system)",
+		pkg.PackageId, len(linkage.Linked), len(linkage.Unresolved))
+}
+
+func linkageIssues(linkage *workspace.RuntimeLinkage) []string {
+	issues := make([]string, 0)
+	for _, dep := range linkage.Undeclared {
+		reason := "is not a runtime dependency"
+		if dep.BuildOnly {
+			reason = "is only declared as a build dependency"
+		}
+		issues = append(issues, fmt.Sprintf("Install links against %s from %s@%s, which %s",
+			strings.Join(dep.Libraries, ", "), dep.Name, dep.Version, reason))
+	}
+	for _, dep := range linkage.Unused {
+		issues = append(issues, fmt.Sprintf("Runtime dependency %s provides shared libraries but the install does not link against any", dep.Name))
+	}
+	return issues
+}
+
+// printDependencySuggestions prints the runtime dependency entries to add to
+// the manifest, and the ones that look unused
+func printDependencySuggestions(linkage *workspace.RuntimeLinkage) {
+	if len(linkage.Undeclared) == 0 && len(linkage.Unused) == 0 {
+		fmt.Println("No runtime dependency changes to suggest")
+		return
+	}
+
+	if len(linkage.Undeclared) > 0 {
+		fmt.Println("Add to specifications.runtime.dependencies:")
+		fmt.Println()
+		for _, dep := range linkage.Undeclared {
+			fmt.Printf("    - name: %s\n", dep.Name)
+			fmt.Printf("      version: %q\n", dep.Version)
+		}
+		fmt.Println()
+	}
+	if len(linkage.Unused) > 0 {
+		fmt.Println("Consider removing from specifications.runtime.dependencies:")
+		for _, dep := range linkage.Unused {
+			fmt.Printf("    - %s\n", dep.Name)
+		}
+	}
+}
+
 func performDeepChecks(m *manifest.Manifest) []string {
 	issues := make([]string, 0)
 
@@ -67,7 +67,12 @@ func generateDependencyGraph(m *manifest.Manifest) string {
 
 	// Recipe flow
 	sb.WriteString("Recipe Flow:\n")
-	sb.WriteString("  Configuration --> Build --> Install --> Use\n")
+	flow := []string{"Configuration", "Build"}
+	if len(m.Recipe.Test) > 0 {
+		flow = append(flow, "Test")
+	}
+	flow = append(flow, "Install", "Use")
+	sb.WriteString("  " + strings.Join(flow, " --> ") + "\n")
 
 	return sb.String()
 }
@@ -72,5 +72,28 @@ func performLintChecks(m *manifest.Manifest) []manifest.ValidationError {
 		})
 	}
 
+	// Steps reaching the network make the build depend on what is online at
+	// build time
+	phases := []struct {
+		name  string
+		steps []manifest.RecipeStep
+	}{
+		{"configuration", m.Recipe.Configuration},
+		{"build", m.Recipe.Build},
+		{"test", m.Recipe.Test},
+		{"install", m.Recipe.Install},
+	}
+	for _, phase := range phases {
+		for i, step := range phase.steps {
+			if step.Network {
+				issues = append(issues, manifest.ValidationError{
+					Field:    fmt.Sprintf("recipe.%s[%d].network", phase.name, i),
+					Message:  fmt.Sprintf("Step '%s' requires network access, the build is not reproducible offline; consider shipping what it downloads with the source", step.Name),
+					Severity: "warning",
+				})
+			}
+		}
+	}
+
 	return issues
 }
@@ -0,0 +1,117 @@
+package manifestCmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/thisismeamir/hepsw/internal/checksum"
+	"github.com/thisismeamir/hepsw/internal/configuration"
+	"github.com/thisismeamir/hepsw/internal/distfiles"
+	"github.com/thisismeamir/hepsw/internal/fetch"
+	"github.com/thisismeamir/hepsw/internal/manifest"
+	"github.com/thisismeamir/hepsw/internal/manifest/loader"
+	"github.com/thisismeamir/hepsw/internal/utils"
+)
+
+func runManifestPrepare(cmd *cobra.Command, args []string) error {
+	manifestSource := args[0]
+	srcDir := args[1]
+
+	// Load manifest
+	m, err := loader.LoadManifest(manifestSource)
+	if err != nil {
+		return fmt.Errorf("failed to load manifest: %w", err)
+	}
+
+	info, err := os.Stat(srcDir)
+	if err != nil {
+		return fmt.Errorf("source directory not found: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", srcDir)
+	}
+
+	fmt.Printf("Preparing source of %s@%s in %s\n", m.Name, m.Version, srcDir)
+	fmt.Println()
+
+	if len(m.Source.Patches) == 0 {
+		fmt.Println("No patches to apply")
+		return nil
+	}
+
+	before, err := fetch.ReadAppliedPatches(srcDir)
+	if err != nil {
+		return err
+	}
+
+	applied, err := fetch.ApplyPatches(m, srcDir, patchOptions(manifestSource))
+	if err != nil {
+		fmt.Println("✗ Source was left unpatched")
+		return err
+	}
+
+	for i, patch := range applied {
+		if i < len(before) {
+			fmt.Printf("  - %s (already applied)\n", patch.Name)
+		} else {
+			fmt.Printf("  ✓ %s (-p%d)\n", patch.Name, patch.Strip)
+		}
+	}
+	fmt.Println()
+	fmt.Printf("✓ %d patch(es) applied, recorded in %s\n", len(applied)-len(before),
+		filepath.Join(srcDir, fetch.PatchRecordFile))
+	return nil
+}
+
+// patchOptions resolves relative patch paths against the manifest file and
+// downloads patches through the distfile cache when a workspace is configured
+func patchOptions(manifestSource string) fetch.PatchOptions {
+	opts := fetch.PatchOptions{}
+	if utils.IsFilePath(manifestSource) {
+		if abs, err := filepath.Abs(manifestSource); err == nil {
+			opts.BaseDir = filepath.Dir(abs)
+		}
+	}
+	if config, err := configuration.GetConfiguration(); err == nil {
+		opts.Cache = distfiles.New(config.DistfilesDir())
+	}
+	return opts
+}
+
+// checkPatchFiles verifies that the patch files of a manifest exist and match
+// their checksums. Downloaded patches are only checked once they are cached.
+func checkPatchFiles(m *manifest.Manifest, manifestSource string, result *manifest.ValidationResult) {
+	opts := patchOptions(manifestSource)
+
+	for i, patch := range m.Source.Patches {
+		field := fmt.Sprintf("source.patches[%d]", i)
+
+		if patch.Url != "" {
+			if opts.Cache == nil {
+				continue
+			}
+			path, ok := opts.Cache.Lookup(manifest.SourceSpec{Url: patch.Url, Checksum: patch.Checksum})
+			if !ok {
+				result.AddInfo(field, fmt.Sprintf("%s is not downloaded yet, checksum not verified", patch.Url))
+				continue
+			}
+			if patch.Checksum != "" {
+				if err := checksum.VerifyFile(path, patch.Checksum); err != nil {
+					result.AddError(field, err.Error())
+				}
+			}
+			continue
+		}
+
+		if patch.Path == "" {
+			continue
+		}
+		if _, cleanup, err := fetch.ResolvePatch(patch, opts); err != nil {
+			result.AddError(field, err.Error())
+		} else {
+			cleanup()
+		}
+	}
+}
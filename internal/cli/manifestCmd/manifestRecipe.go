@@ -2,6 +2,8 @@ package manifestCmd
 
 import (
 	"fmt"
+	"maps"
+	"slices"
 	"strings"
 
 	"github.com/spf13/cobra"
@@ -31,6 +33,7 @@ func runManifestRecipe(cmd *cobra.Command, args []string) error {
 	}{
 		{"Configuration", accessor.ConfigurationSteps()},
 		{"Build", accessor.BuildSteps()},
+		{"Test", accessor.TestSteps()},
 		{"Install", accessor.InstallSteps()},
 		{"Use", accessor.UseSteps()},
 	}
@@ -64,6 +67,37 @@ func runManifestRecipe(cmd *cobra.Command, args []string) error {
 				fmt.Printf("   Condition: %s\n", step.If)
 			}
 
+			if step.Shell != "" {
+				fmt.Printf("   Shell: %s\n", step.Shell)
+			}
+
+			if step.Env != nil {
+				fmt.Println("   Environment:")
+				for _, k := range slices.Sorted(maps.Keys(step.Env)) {
+					fmt.Printf("     %s = %s\n", k, step.Env[k])
+				}
+			}
+
+			if step.Capture != "" {
+				fmt.Printf("   Captures: %s\n", step.Capture)
+			}
+
+			if step.Timeout != "" {
+				fmt.Printf("   Timeout: %s\n", step.Timeout)
+			}
+
+			if step.Retries > 0 {
+				fmt.Printf("   Retries: %d\n", step.Retries)
+			}
+
+			if step.ContinueOnError {
+				fmt.Println("   On error: continue")
+			}
+
+			if step.Network {
+				fmt.Println("   Network: allowed")
+			}
+
 			if step.Set != nil {
 				fmt.Println("   Sets variables:")
 				for k, v := range step.Set {
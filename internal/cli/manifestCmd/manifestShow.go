@@ -2,10 +2,15 @@ package manifestCmd
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/spf13/cobra"
+	"github.com/thisismeamir/hepsw/internal/builder"
+	"github.com/thisismeamir/hepsw/internal/configuration"
+	"github.com/thisismeamir/hepsw/internal/manifest"
 	"github.com/thisismeamir/hepsw/internal/manifest/loader"
 	"github.com/thisismeamir/hepsw/internal/manifest/reporters"
+	"github.com/thisismeamir/hepsw/internal/workspace"
 )
 
 func runManifestShow(cmd *cobra.Command, args []string) error {
@@ -37,5 +42,48 @@ func runManifestShow(cmd *cobra.Command, args []string) error {
 	}
 
 	fmt.Print(output)
+
+	// Structured formats stay parseable
+	if showFormat == "text" || showFormat == "markdown" || showFormat == "md" {
+		fmt.Print(buildHashReport(m))
+	}
 	return nil
 }
+
+// buildHashReport shows the build hash the manifest has in the current
+// workspace, and how it compares with the matching install
+func buildHashReport(m *manifest.Manifest) string {
+	var sb strings.Builder
+	sb.WriteString("BUILD IDENTITY\n")
+	sb.WriteString(strings.Repeat("-", 80) + "\n")
+
+	config, err := configuration.GetConfiguration()
+	if err != nil {
+		sb.WriteString("Build hash:          unavailable (no workspace configuration)\n")
+		return sb.String()
+	}
+
+	b := builder.New(config, m, workspace.SourceDir(config, m.Name, m.Version))
+	b.Options = showOptions
+	if err := b.Identify(); err != nil {
+		sb.WriteString(fmt.Sprintf("Build hash:          unavailable (%v)\n", err))
+		return sb.String()
+	}
+
+	sb.WriteString(fmt.Sprintf("Build hash:          %s\n", b.BuildHash))
+	if b.Variant != "" {
+		sb.WriteString(fmt.Sprintf("Variant:             %s\n", b.Variant))
+	}
+	sb.WriteString(fmt.Sprintf("Install prefix:      %s\n", b.InstallPrefix))
+	if installed, ok := config.FindPackage(m.Name, b.PackageVersion()); ok {
+		status := "up to date"
+		if installed.BuildHash != b.BuildHash {
+			status = "outdated, installed " + installed.BuildHash
+		}
+		sb.WriteString(fmt.Sprintf("Installed:           %s\n", status))
+	} else {
+		sb.WriteString("Installed:           no\n")
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
@@ -1,12 +1,20 @@
 package manifestCmd
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"path"
 	"strings"
 
 	"github.com/spf13/cobra"
+	"github.com/thisismeamir/hepsw/internal/checksum"
+	"github.com/thisismeamir/hepsw/internal/configuration"
+	"github.com/thisismeamir/hepsw/internal/distfiles"
+	"github.com/thisismeamir/hepsw/internal/fetch"
 	"github.com/thisismeamir/hepsw/internal/manifest"
 	"github.com/thisismeamir/hepsw/internal/manifest/loader"
+	"github.com/thisismeamir/hepsw/internal/utils"
 )
 
 func runManifestSource(cmd *cobra.Command, args []string) error {
@@ -26,13 +34,43 @@ func runManifestSource(cmd *cobra.Command, args []string) error {
 
 	source := accessor.Source()
 
+	// The configuration is optional, it only adds the mirror table and the cache
+	config, configErr := configuration.GetConfiguration()
+	if configErr != nil {
+		config = nil
+	}
+
 	fmt.Printf("Type:     %s\n", source.Type)
 	fmt.Printf("URL:      %s\n", source.Url)
 
+	if source.Type == "tarball" {
+		if urls := fetch.SourceURLs(source, config); len(urls) > 1 {
+			fmt.Println("Download order:")
+			for i, url := range urls {
+				fmt.Printf("  %d. %s\n", i+1, url)
+			}
+		}
+	}
+
 	if source.Tag != "" {
 		fmt.Printf("Tag:      %s\n", source.Tag)
 	}
 
+	if source.StripComponents != nil {
+		fmt.Printf("Strip:    %d leading path component(s)\n", *source.StripComponents)
+	}
+
+	if len(source.Patches) > 0 {
+		fmt.Println("Patches:")
+		for _, patch := range source.Patches {
+			location := patch.Path
+			if location == "" {
+				location = patch.Url
+			}
+			fmt.Printf("  - %s\n", location)
+		}
+	}
+
 	if source.Checksum != "" {
 		fmt.Printf("Checksum: %s\n", source.Checksum)
 
@@ -47,5 +85,191 @@ func runManifestSource(cmd *cobra.Command, args []string) error {
 		fmt.Println("  Warning: Checksums are recommended for reproducibility")
 	}
 
+	if sourceDownload {
+		fmt.Println()
+		if err := downloadSource(source, config); err != nil {
+			return err
+		}
+	}
+
+	if sourceVerify {
+		fmt.Println()
+		if err := verifySourceChecksum(source, config); err != nil {
+			return err
+		}
+	}
+
+	if sourceCompute {
+		fmt.Println()
+		if err := computeSourceChecksum(m, manifestSource, config); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// downloadSource downloads the source archive, trying the manifest URL and its
+// mirrors in order. With a workspace the archive goes to the distfile cache,
+// otherwise to the current directory.
+func downloadSource(source manifest.SourceSpec, config *configuration.Configuration) error {
+	if source.Type != "tarball" {
+		return fmt.Errorf("only tarball sources can be downloaded, this is a %s source", source.Type)
+	}
+	if source.Checksum == "" {
+		fmt.Println("⚠ No checksum declared, downloads cannot be verified")
+	}
+
+	urls := fetch.SourceURLs(source, config)
+
+	if config == nil {
+		target := path.Base(source.Url)
+		used, err := fetch.DownloadFromMirrors(source, urls, target, os.Stdout)
+		if err != nil {
+			fmt.Println("✗ Download failed")
+			return err
+		}
+		fmt.Printf("✓ Downloaded %s from %s\n", target, used)
+		return nil
+	}
+
+	used := ""
+	download := func(source manifest.SourceSpec, target string) error {
+		var err error
+		used, err = fetch.DownloadFromMirrors(source, urls, target, os.Stdout)
+		return err
+	}
+	archivePath, hit, err := distfiles.New(config.DistfilesDir()).Fetch(source, download)
+	if err != nil {
+		fmt.Println("✗ Download failed")
+		return err
+	}
+	if hit {
+		fmt.Printf("✓ Already cached at %s\n", archivePath)
+		return nil
+	}
+	fmt.Printf("✓ Downloaded from %s to %s\n", used, archivePath)
+	return nil
+}
+
+func verifySourceChecksum(source manifest.SourceSpec, config *configuration.Configuration) error {
+	if source.Checksum == "" {
+		return fmt.Errorf("manifest declares no checksum, use --compute to add one")
+	}
+
+	algorithm, _, err := checksum.Parse(source.Checksum)
+	if err != nil {
+		return err
+	}
+
+	archivePath, cleanup, err := sourceArchivePath(source, config)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	computed, err := checksum.Compute(archivePath, algorithm)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Declared: %s\n", source.Checksum)
+	fmt.Printf("Computed: %s\n", computed)
+
+	if err := checksum.VerifyFile(archivePath, source.Checksum); err != nil {
+		fmt.Println("✗ Checksum does not match")
+		return err
+	}
+
+	fmt.Println("✓ Checksum matches")
 	return nil
 }
+
+func computeSourceChecksum(m *manifest.Manifest, manifestSource string, config *configuration.Configuration) error {
+	if m.Source.Checksum != "" {
+		fmt.Printf("Manifest already declares %s, use --verify to check it\n", m.Source.Checksum)
+		return nil
+	}
+
+	archivePath, cleanup, err := sourceArchivePath(m.Source, config)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	computed, err := checksum.Compute(archivePath, sourceAlgorithm)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Computed: %s\n", computed)
+
+	if !utils.IsFilePath(manifestSource) {
+		fmt.Println("Manifest is not a local file, add the checksum to its source section manually")
+		return nil
+	}
+
+	// Only the checksum line is written, the rest of the file is kept as is
+	err = loader.SetSourceChecksum(manifestSource, computed)
+	if errors.Is(err, loader.ErrNotPatchable) {
+		fmt.Printf("%s cannot be edited in place, add this line to its source section:\n", manifestSource)
+		fmt.Printf("  checksum: %s\n", computed)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("✓ Checksum written to %s\n", manifestSource)
+	return nil
+}
+
+// sourceArchivePath returns a local path to the source archive, preferring a
+// copy from the distfile cache and downloading it otherwise. The returned
+// cleanup function removes any temporary download.
+func sourceArchivePath(source manifest.SourceSpec, config *configuration.Configuration) (string, func(), error) {
+	noop := func() {}
+
+	if sourceArchive != "" {
+		return sourceArchive, noop, nil
+	}
+
+	switch source.Type {
+	case "local":
+		path := fetch.LocalPath(source.Url)
+		info, err := os.Stat(path)
+		if err != nil {
+			return "", noop, fmt.Errorf("local source not found: %w", err)
+		}
+		if info.IsDir() {
+			return "", noop, fmt.Errorf("checksums only apply to archives, %s is a directory", path)
+		}
+		return path, noop, nil
+
+	case "tarball":
+		if config != nil {
+			if path, ok := distfiles.New(config.DistfilesDir()).Lookup(source); ok {
+				fmt.Printf("Using cached archive %s\n", path)
+				return path, noop, nil
+			}
+		}
+
+		tmp, err := os.CreateTemp("", "hepsw-source-*")
+		if err != nil {
+			return "", noop, fmt.Errorf("failed to create temporary file: %w", err)
+		}
+		_ = tmp.Close()
+		cleanup := func() { _ = os.Remove(tmp.Name()) }
+
+		// Download without verification, the caller compares the digests itself
+		unverified := source
+		unverified.Checksum = ""
+		if _, err := fetch.DownloadFromMirrors(unverified, fetch.SourceURLs(source, config), tmp.Name(), os.Stdout); err != nil {
+			cleanup()
+			return "", noop, err
+		}
+		return tmp.Name(), cleanup, nil
+
+	default:
+		return "", noop, fmt.Errorf("checksums are not supported for %s sources", source.Type)
+	}
+}
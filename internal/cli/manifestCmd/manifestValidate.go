@@ -23,6 +23,9 @@ func runManifestValidate(cmd *cobra.Command, args []string) error {
 	// Validate
 	result := manifest.ValidateManifest(m)
 
+	// Patch files can only be checked here, where the manifest location is known
+	checkPatchFiles(m, manifestSource, result)
+
 	// Print results
 	if len(result.Errors) > 0 {
 		fmt.Println("ERRORS:")
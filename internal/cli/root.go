@@ -63,6 +63,18 @@ func init() {
 	rootCmd.AddCommand(syncCmd)
 	rootCmd.AddCommand(searchCmd)
 	rootCmd.AddCommand(infoCmd)
+	rootCmd.AddCommand(fetchCmd)
+	rootCmd.AddCommand(buildCmd)
+	rootCmd.AddCommand(testCmd)
+	rootCmd.AddCommand(installCmd)
+	rootCmd.AddCommand(uninstallCmd)
+	rootCmd.AddCommand(statusCmd)
+	rootCmd.AddCommand(verifyCmd)
+	rootCmd.AddCommand(runRecipeCmd)
+	rootCmd.AddCommand(execStepCmd)
+	rootCmd.AddCommand(buildStatsCmd)
+	rootCmd.AddCommand(cacheCmd)
+	rootCmd.AddCommand(sourceCmd)
 	rootCmd.AddCommand(manifestCmd.ManifestCmd)
 }
 
@@ -0,0 +1,145 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+	"github.com/thisismeamir/hepsw/internal/builder"
+	"github.com/thisismeamir/hepsw/internal/configuration"
+	"github.com/thisismeamir/hepsw/internal/manifest/loader"
+	"github.com/thisismeamir/hepsw/internal/workspace"
+)
+
+var runRecipePhases []string
+
+var runRecipeCmd = &cobra.Command{
+	Use:   "run-recipe <manifest>",
+	Short: "Execute the recipe of a manifest and measure every step",
+	Long: `Run-recipe executes the recipe steps that 'hepsw manifest walk' only
+simulates, against the fetched source of the package, and reports the wall
+time, user and system CPU time and peak resident memory of every step, taken
+from the resource usage of the step process and the children it waited for.
+
+Every run is recorded in the build history database of the workspace, like the
+runs of 'hepsw build'; 'hepsw build-stats' summarizes it. When the install
+phase runs, the package is recorded as installed.
+
+With --isolate-network the configuration, build and install steps run without
+network access, see 'hepsw build --help'.
+
+Example:
+  hepsw run-recipe root.yaml
+  hepsw run-recipe root@6.30.02 --phases configuration,build,test`,
+	Args: cobra.ExactArgs(1),
+	RunE: runRunRecipe,
+}
+
+func init() {
+	runRecipeCmd.Flags().StringSliceVar(&buildOptions, "with", []string{},
+		"build options to enable (e.g., with-python,with-gui)")
+	runRecipeCmd.Flags().StringToStringVarP(&buildVariables, "var", "V", map[string]string{},
+		"set recipe variables (e.g., BUILD_TYPE=Debug)")
+	runRecipeCmd.Flags().IntVarP(&buildJobs, "jobs", "j", 0,
+		"number of parallel jobs (default: number of CPUs)")
+	runRecipeCmd.Flags().StringSliceVar(&runRecipePhases, "phases", builder.DefaultPhases,
+		"recipe phases to run, in order (configuration, build, test, install)")
+	runRecipeCmd.Flags().BoolVar(&buildIsolateNetwork, "isolate-network", false,
+		"run the steps without network access (default: isolateNetwork)")
+}
+
+func runRunRecipe(cmd *cobra.Command, args []string) error {
+	config, err := configuration.GetConfiguration()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	for _, phase := range runRecipePhases {
+		if !slices.Contains([]string{builder.PhaseConfiguration, builder.PhaseBuild, builder.PhaseTest, builder.PhaseInstall}, phase) {
+			return fmt.Errorf("unknown recipe phase %q", phase)
+		}
+	}
+
+	m, err := loader.LoadManifest(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to load manifest: %w", err)
+	}
+
+	sourceDir := workspace.SourceDir(config, m.Name, m.Version)
+	if fetched, err := workspace.Locate(config, m.Name+"@"+m.Version); err == nil {
+		sourceDir = fetched.BuildFile.Src
+	} else {
+		PrintWarning(fmt.Sprintf("%s@%s is not fetched, the recipe runs against %s", m.Name, m.Version, sourceDir))
+	}
+
+	b, err := newBuilder(config, m, sourceDir)
+	if err != nil {
+		return err
+	}
+	if slices.ContainsFunc(runRecipePhases, func(phase string) bool { return phase != builder.PhaseTest }) {
+		if err := requireNetworkIsolation(config); err != nil {
+			return err
+		}
+	}
+	if verbose {
+		b.Output = os.Stdout
+	}
+	b.Notify = printStepEvent
+
+	PrintSection(fmt.Sprintf("Running the recipe of %s@%s", m.Name, m.Version))
+	PrintInfo("Build:   " + b.BuildDir)
+	PrintInfo("Install: " + b.InstallPrefix)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	started := time.Now()
+	result, runErr := b.RunPhases(ctx, runRecipePhases)
+	recordHistory(config, b, "run-recipe", started, result, runErr)
+	printStepUsage(result)
+
+	if runErr != nil {
+		PrintError(runErr.Error())
+		return fmt.Errorf("recipe of %s@%s failed", m.Name, m.Version)
+	}
+
+	if slices.Contains(runRecipePhases, builder.PhaseInstall) {
+		config.RecordPackage(b.PackageState(result))
+		if err := config.Save(); err != nil {
+			return fmt.Errorf("failed to save configuration: %w", err)
+		}
+	}
+	PrintSuccess(fmt.Sprintf("Ran the recipe of %s@%s in %s", m.Name, b.PackageVersion(), formatDuration(time.Since(started))))
+	return nil
+}
+
+// printStepUsage prints the resources used by the executed steps
+func printStepUsage(result *builder.Result) {
+	if result == nil || len(result.Steps) == 0 {
+		return
+	}
+
+	PrintSection("Resource usage")
+	fmt.Printf("  %-14s %-28s %10s %10s %10s %10s\n", "PHASE", "STEP", "WALL", "USER", "SYS", "PEAK RSS")
+	for _, step := range result.Steps {
+		if step.LogPath == "" {
+			continue
+		}
+		fmt.Printf("  %-14s %-28s %10s %10s %10s %10s\n", step.Phase, truncate(step.Name, 28),
+			formatDuration(step.Duration), formatDuration(step.UserTime), formatDuration(step.SystemTime),
+			humanize.IBytes(uint64(step.PeakRSS)))
+	}
+}
+
+// truncate shortens s to n characters
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n-1] + "…"
+}
@@ -0,0 +1,179 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	gosync "sync"
+	"time"
+
+	"github.com/thisismeamir/hepsw/internal/builder"
+	"github.com/thisismeamir/hepsw/internal/configuration"
+	"github.com/thisismeamir/hepsw/internal/index"
+	"github.com/thisismeamir/hepsw/internal/index/resolver"
+	"github.com/thisismeamir/hepsw/internal/scheduler"
+	"github.com/thisismeamir/hepsw/internal/workspace"
+)
+
+// runScheduledBuild builds several packages in dependency order, independent
+// ones concurrently
+func runScheduledBuild(config *configuration.Configuration, args []string) error {
+	var graph *scheduler.Graph
+	if buildFromIndex {
+		trees, err := resolveBuildTrees(config, args)
+		if err != nil {
+			return err
+		}
+		if graph, err = scheduler.FromDependencyTree(config, trees...); err != nil {
+			return fmt.Errorf("%w (fetch the dependencies with 'hepsw fetch --deps-depth')", err)
+		}
+	} else {
+		packages, err := collectBuildPackages(config, args)
+		if err != nil {
+			return err
+		}
+		if graph, err = scheduler.FromPackages(packages, buildOptions); err != nil {
+			return err
+		}
+	}
+
+	jobs := buildParallel
+	if jobs <= 0 {
+		jobs = config.UserConfig.ParallelBuilds
+	}
+
+	// The workspace state is shared by all builds
+	var stateLock gosync.Mutex
+	build := func(ctx context.Context, node *scheduler.Node) error {
+		// Identifying the builder reads the state of its dependencies
+		stateLock.Lock()
+		b, err := newBuilder(config, node.Manifest, node.SourceDir)
+		stateLock.Unlock()
+		if err != nil {
+			return err
+		}
+		if jobs == 1 && verbose {
+			b.Output = os.Stdout
+		}
+		started := time.Now()
+		result, err := b.RunPhases(ctx, builder.DefaultPhases)
+
+		stateLock.Lock()
+		defer stateLock.Unlock()
+		recordHistory(config, b, "build", started, result, err)
+		if err != nil {
+			return err
+		}
+		config.RecordPackage(b.PackageState(result))
+		return nil
+	}
+
+	s := scheduler.New(jobs, build)
+	s.Notify = printSchedulerEvent
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	PrintSection(fmt.Sprintf("Building %d package(s), %d at a time", graph.Len(), max(jobs, 1)))
+	summary, err := s.Run(ctx, graph)
+	if err != nil {
+		return err
+	}
+
+	if err := config.Save(); err != nil {
+		return fmt.Errorf("failed to save configuration: %w", err)
+	}
+
+	printBuildSummary(summary)
+	if len(summary.Failed) > 0 || len(summary.Skipped) > 0 {
+		return fmt.Errorf("%d package(s) failed, %d skipped", len(summary.Failed), len(summary.Skipped))
+	}
+	return nil
+}
+
+// resolveBuildTrees resolves the dependency trees of the packages in the
+// package index, like 'hepsw fetch --deps-depth' does
+func resolveBuildTrees(config *configuration.Configuration, args []string) ([]*resolver.DependencyNode, error) {
+	idx, err := index.New(&config.IndexConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the package index: %w", err)
+	}
+	defer idx.Close()
+
+	trees := make([]*resolver.DependencyNode, 0, len(args))
+	for _, reference := range args {
+		name, version := workspace.ParseReference(reference)
+		tree, err := idx.ResolveDependencyTree(context.Background(), name, version, false)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve dependencies of %s: %w", reference, err)
+		}
+		trees = append(trees, tree)
+	}
+	return trees, nil
+}
+
+// collectBuildPackages locates the requested packages and, with --deps, the
+// fetched packages they depend on, recursively
+func collectBuildPackages(config *configuration.Configuration, args []string) ([]*workspace.FetchedPackage, error) {
+	packages := make([]*workspace.FetchedPackage, 0)
+	seen := make(map[string]bool)
+	resolveOptions := workspace.ResolveOptions{AllowThirdParty: buildThirdParty}
+
+	var add func(pkg *workspace.FetchedPackage)
+	add = func(pkg *workspace.FetchedPackage) {
+		id := pkg.Manifest.Name + "@" + pkg.Manifest.Version
+		if seen[id] {
+			return
+		}
+		seen[id] = true
+		packages = append(packages, pkg)
+
+		if !buildDeps {
+			return
+		}
+		deps, _ := workspace.ResolveDependencies(config, pkg.Manifest, buildOptions, resolveOptions)
+		for _, dep := range deps {
+			add(dep)
+		}
+	}
+
+	for _, reference := range args {
+		pkg, err := workspace.Locate(config, reference)
+		if err != nil {
+			return nil, err
+		}
+		add(pkg)
+	}
+	return packages, nil
+}
+
+// printSchedulerEvent reports the progress of a package in a scheduled build
+func printSchedulerEvent(event scheduler.Event) {
+	switch event.Status {
+	case scheduler.StatusRunning:
+		PrintBullet("Building " + event.Node.ID)
+	case scheduler.StatusBuilt:
+		PrintSuccess(fmt.Sprintf("Built %s in %s", event.Node.ID, event.Duration.Round(time.Second)))
+	case scheduler.StatusFailed:
+		PrintError(fmt.Sprintf("%s failed: %v", event.Node.ID, event.Err))
+	case scheduler.StatusSkipped:
+		PrintWarning(fmt.Sprintf("Skipping %s: %s", event.Node.ID, event.Reason))
+	}
+}
+
+// printBuildSummary lists the built, skipped and failed packages
+func printBuildSummary(summary *scheduler.Summary) {
+	PrintSection("Summary")
+	for _, outcome := range summary.Built {
+		PrintBullet(fmt.Sprintf("built    %s (%s)", outcome.Node.ID, outcome.Duration.Round(time.Second)))
+	}
+	for _, outcome := range summary.Skipped {
+		PrintBullet(fmt.Sprintf("skipped  %s: %s", outcome.Node.ID, outcome.Reason))
+	}
+	for _, outcome := range summary.Failed {
+		PrintBullet(fmt.Sprintf("failed   %s", outcome.Node.ID))
+	}
+	fmt.Println()
+	fmt.Printf("%d built, %d skipped, %d failed\n", len(summary.Built), len(summary.Skipped), len(summary.Failed))
+}
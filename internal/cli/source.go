@@ -0,0 +1,56 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/thisismeamir/hepsw/internal/archive"
+)
+
+var sourceUnpackStrip int
+
+var sourceCmd = &cobra.Command{
+	Use:   "source",
+	Short: "Source tree utilities",
+	Long:  `Commands for working with package sources outside of the fetch process.`,
+}
+
+var sourceUnpackCmd = &cobra.Command{
+	Use:   "unpack [archive] [dir]",
+	Short: "Safely extract a source archive",
+	Long: `Extract a source archive into a directory.
+
+The format is detected from the file content: tar, .tar.gz/.tgz, .tar.xz,
+.tar.bz2, .tar.zst and .zip are supported. Permissions and symlinks are
+preserved, entries with absolute paths or paths escaping the directory are
+rejected.
+
+Example:
+  hepsw source unpack root_v6.30.02.source.tar.gz ./src --strip-components 1`,
+	Args: cobra.ExactArgs(2),
+	RunE: runSourceUnpack,
+}
+
+func init() {
+	sourceCmd.AddCommand(sourceUnpackCmd)
+
+	sourceUnpackCmd.Flags().IntVar(&sourceUnpackStrip, "strip-components", 0,
+		"remove this many leading path components from every entry")
+}
+
+func runSourceUnpack(cmd *cobra.Command, args []string) error {
+	archivePath, dest := args[0], args[1]
+
+	format, err := archive.DetectFormat(archivePath)
+	if err != nil {
+		return fmt.Errorf("%s: %w", archivePath, err)
+	}
+	PrintInfo(fmt.Sprintf("Detected %s archive", format))
+
+	if err := archive.Extract(archivePath, dest, archive.Options{StripComponents: sourceUnpackStrip}); err != nil {
+		return err
+	}
+
+	PrintSuccess("Unpacked to " + dest)
+	return nil
+}
@@ -0,0 +1,117 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+	"github.com/thisismeamir/hepsw/internal/builder"
+	"github.com/thisismeamir/hepsw/internal/configuration"
+	"github.com/thisismeamir/hepsw/internal/workspace"
+)
+
+var statusCmd = &cobra.Command{
+	Use:   "status [package...]",
+	Short: "Show the installed packages and whether they are up to date",
+	Long: `Status lists the installed packages with their build hash. The build hash
+identifies what was built: the normalized manifest, the selected options, the
+recipe variables, the toolchain versions and the build hashes of the
+dependencies. Each install is compared with the hash its fetched manifest would
+build now, with the options and variables it was built with, and reported as
+outdated when they differ.
+
+Example:
+  hepsw status
+  hepsw status root geant4`,
+	RunE: runStatus,
+}
+
+// Install states reported by hepsw status
+const (
+	statusUpToDate = "up to date"
+	statusOutdated = "outdated"
+	statusUnknown  = "no build hash recorded"
+	statusNoSource = "manifest not fetched"
+)
+
+func runStatus(cmd *cobra.Command, args []string) error {
+	config, err := configuration.GetConfiguration()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	wanted := make(map[string]bool)
+	for _, arg := range args {
+		name, _ := workspace.ParseReference(arg)
+		wanted[name] = true
+	}
+
+	shown := 0
+	outdated := 0
+	PrintSection("Installed packages")
+	for _, pkg := range config.State.Packages {
+		if len(wanted) > 0 && !wanted[pkg.Name] {
+			continue
+		}
+		shown++
+
+		status, current := installStatus(config, pkg)
+		if status == statusOutdated {
+			outdated++
+		}
+
+		hash := pkg.BuildHash
+		if len(hash) > builder.VariantLength && !verbose {
+			hash = hash[:builder.VariantLength]
+		}
+		if hash == "" {
+			hash = "-"
+		}
+		PrintBullet(fmt.Sprintf("%s  %s  %s (%s)", pkg.PackageId, hash, status, humanize.Bytes(uint64(pkg.Size))))
+		if verbose {
+			fmt.Printf("      path:    %s\n", pkg.Path)
+			if status == statusOutdated {
+				fmt.Printf("      current: %s\n", current)
+			}
+			if len(pkg.Options) > 0 {
+				fmt.Printf("      options: %v\n", pkg.Options)
+			}
+		}
+	}
+
+	if shown == 0 {
+		PrintInfo("No installed packages")
+		return nil
+	}
+	if outdated > 0 {
+		PrintWarning(fmt.Sprintf("%d of %d package(s) are outdated, rebuild them with 'hepsw build'", outdated, shown))
+	}
+	return nil
+}
+
+// installStatus compares the build hash of an install with the one its
+// manifest would build now, which is returned as well
+func installStatus(config *configuration.Configuration, pkg configuration.WorkspacePackageState) (string, string) {
+	if pkg.BuildHash == "" {
+		return statusUnknown, ""
+	}
+
+	fetched, err := workspace.Locate(config, pkg.Name+"@"+pkg.Version)
+	if err != nil {
+		return statusNoSource, ""
+	}
+
+	b := builder.New(config, fetched.Manifest, fetched.BuildFile.Src)
+	b.Options = pkg.Options
+	for k, v := range pkg.Variables {
+		b.Variables[k] = v
+	}
+	if err := b.Identify(); err != nil {
+		return statusUnknown, ""
+	}
+
+	if b.BuildHash != pkg.BuildHash {
+		return statusOutdated, b.BuildHash
+	}
+	return statusUpToDate, b.BuildHash
+}
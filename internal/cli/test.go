@@ -0,0 +1,133 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/thisismeamir/hepsw/internal/builder"
+	"github.com/thisismeamir/hepsw/internal/configuration"
+	"github.com/thisismeamir/hepsw/internal/workspace"
+)
+
+var testJSON bool
+
+var testCmd = &cobra.Command{
+	Use:   "test <package[@version]>",
+	Short: "Run the test phase of a built package",
+	Long: `Test runs the test steps of the recipe of a package against its existing
+build directory, so the package must have been built first. The output of every
+step is logged like a build, and the run stops at the first failing step.
+
+The pass/fail result is saved in the workspace state with the installed
+package, or with its source when it is not installed. --json prints the same
+result on stdout for scripts.
+
+Example:
+  hepsw test root
+  hepsw test root@6.30.02 --json`,
+	Args: cobra.ExactArgs(1),
+	RunE: runTest,
+}
+
+func init() {
+	// The recipe variables must match the ones the package was built with
+	testCmd.Flags().StringSliceVar(&buildOptions, "with", []string{},
+		"build options to enable (e.g., with-python,with-gui)")
+	testCmd.Flags().StringToStringVarP(&buildVariables, "var", "V", map[string]string{},
+		"set recipe variables (e.g., BUILD_TYPE=Debug)")
+	testCmd.Flags().IntVarP(&buildJobs, "jobs", "j", 0,
+		"number of parallel jobs (default: number of CPUs)")
+	testCmd.Flags().BoolVar(&testJSON, "json", false,
+		"print the test result as JSON")
+}
+
+func runTest(cmd *cobra.Command, args []string) error {
+	config, err := configuration.GetConfiguration()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	pkg, err := workspace.Locate(config, args[0])
+	if err != nil {
+		return err
+	}
+	m := pkg.Manifest
+
+	if len(m.Recipe.Test) == 0 {
+		PrintWarning(fmt.Sprintf("%s@%s has no test steps", m.Name, m.Version))
+		return nil
+	}
+
+	b, err := newBuilder(config, m, pkg.BuildFile.Src)
+	if err != nil {
+		return err
+	}
+	if verbose && !testJSON {
+		b.Output = os.Stdout
+	}
+	if !testJSON {
+		b.Notify = printStepEvent
+		PrintSection(fmt.Sprintf("Testing %s@%s", m.Name, m.Version))
+		PrintInfo("Build: " + b.BuildDir)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	started := time.Now()
+	result, runErr := b.Test(ctx)
+	testResult := configuration.TestResult{
+		Passed:   runErr == nil,
+		Time:     started.Format(time.RFC3339),
+		Duration: time.Since(started).Seconds(),
+	}
+	if result != nil {
+		for _, step := range result.Steps {
+			if !step.Skipped {
+				testResult.Steps++
+			}
+		}
+	}
+	var stepErr *builder.StepError
+	if errors.As(runErr, &stepErr) {
+		testResult.FailedStep = stepErr.Name
+		testResult.LogPath = stepErr.LogPath
+	}
+	if runErr != nil {
+		testResult.Error = runErr.Error()
+	}
+
+	if result != nil {
+		if !config.RecordTestResult(m.Name, b.PackageVersion(), testResult) {
+			PrintWarning(fmt.Sprintf("%s@%s is not recorded in the workspace, the result is not saved", m.Name, m.Version))
+		} else if err := config.Save(); err != nil {
+			return fmt.Errorf("failed to save configuration: %w", err)
+		}
+	}
+
+	if testJSON {
+		data, err := json.MarshalIndent(testResult, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal test result: %w", err)
+		}
+		fmt.Println(string(data))
+	}
+
+	if runErr != nil {
+		if !testJSON {
+			PrintError(runErr.Error())
+		}
+		return fmt.Errorf("tests of %s@%s failed", m.Name, m.Version)
+	}
+
+	if !testJSON {
+		PrintSuccess(fmt.Sprintf("Tests of %s@%s passed", m.Name, m.Version))
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/thisismeamir/hepsw/internal/configuration"
+	"github.com/thisismeamir/hepsw/internal/workspace"
+)
+
+var (
+	uninstallForce   bool
+	uninstallCascade bool
+)
+
+var uninstallCmd = &cobra.Command{
+	Use:   "uninstall <package[@version]>",
+	Short: "Remove an installed package",
+	Long: `Uninstall removes the files an install wrote, as recorded in the file list of
+the install prefix, and drops the package from the workspace state. Files that
+were added to the prefix afterwards are left in place.
+
+A package used by other installed packages is only removed with --cascade,
+which uninstalls those packages first, or --force, which leaves them with a
+missing dependency. --force also removes a whole install prefix that has no
+file list.
+
+Example:
+  hepsw uninstall root@6.30.02
+  hepsw uninstall zlib --cascade`,
+	Args: cobra.ExactArgs(1),
+	RunE: runUninstall,
+}
+
+func init() {
+	uninstallCmd.Flags().BoolVarP(&uninstallForce, "force", "f", false,
+		"uninstall even if other packages use it")
+	uninstallCmd.Flags().BoolVar(&uninstallCascade, "cascade", false,
+		"also uninstall the packages using it")
+}
+
+func runUninstall(cmd *cobra.Command, args []string) error {
+	config, err := configuration.GetConfiguration()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	pkg, err := findInstalledPackage(config, args[0])
+	if err != nil {
+		return err
+	}
+
+	targets := []configuration.WorkspacePackageState{*pkg}
+	if len(pkg.IsUsedBy) > 0 {
+		users := strings.Join(pkg.IsUsedBy, ", ")
+		switch {
+		case uninstallCascade:
+			targets = cascadeOrder(config, pkg)
+			PrintInfo(fmt.Sprintf("%s is used by %s, they are uninstalled first", pkg.PackageId, users))
+		case uninstallForce:
+			PrintWarning(fmt.Sprintf("%s is used by %s, they will miss a dependency", pkg.PackageId, users))
+		default:
+			return fmt.Errorf("%s is used by %s, use --cascade to uninstall them too or --force", pkg.PackageId, users)
+		}
+	}
+
+	var uninstallErr error
+	for _, target := range targets {
+		if uninstallErr = uninstallPackage(config, target); uninstallErr != nil {
+			break
+		}
+	}
+
+	// Record what was removed even when a later package failed
+	if err := config.Save(); err != nil {
+		return fmt.Errorf("failed to save configuration: %w", err)
+	}
+	return uninstallErr
+}
+
+// findInstalledPackage looks up an installed package by a name[@version]
+// reference. Without a version the package must be installed only once.
+func findInstalledPackage(config *configuration.Configuration, reference string) (*configuration.WorkspacePackageState, error) {
+	name, version := workspace.ParseReference(reference)
+	if version != "" {
+		pkg, ok := config.FindPackage(name, version)
+		if !ok {
+			return nil, fmt.Errorf("%s@%s is not installed", name, version)
+		}
+		return pkg, nil
+	}
+
+	versions := make([]string, 0)
+	for _, pkg := range config.State.Packages {
+		if pkg.Name == name {
+			_, version := workspace.ParseReference(pkg.PackageId)
+			versions = append(versions, version)
+		}
+	}
+	switch len(versions) {
+	case 0:
+		return nil, fmt.Errorf("%s is not installed", name)
+	case 1:
+		pkg, _ := config.FindPackage(name, versions[0])
+		return pkg, nil
+	default:
+		sort.Strings(versions)
+		return nil, fmt.Errorf("several versions of %s are installed (%s), choose one with %s@<version>",
+			name, strings.Join(versions, ", "), name)
+	}
+}
+
+// cascadeOrder returns the package and every installed package using it,
+// directly or not, with users before the packages they use
+func cascadeOrder(config *configuration.Configuration, pkg *configuration.WorkspacePackageState) []configuration.WorkspacePackageState {
+	order := make([]configuration.WorkspacePackageState, 0)
+	visited := make(map[string]bool)
+
+	var visit func(configuration.WorkspacePackageState)
+	visit = func(current configuration.WorkspacePackageState) {
+		if visited[current.PackageId] {
+			return
+		}
+		visited[current.PackageId] = true
+		for _, user := range current.IsUsedBy {
+			name, version := workspace.ParseReference(user)
+			if userPkg, ok := config.FindPackage(name, version); ok {
+				visit(*userPkg)
+			}
+		}
+		order = append(order, current)
+	}
+	visit(*pkg)
+	return order
+}
+
+// uninstallPackage removes the recorded files of a package and drops it from
+// the workspace state
+func uninstallPackage(config *configuration.Configuration, pkg configuration.WorkspacePackageState) error {
+	if _, err := os.Stat(pkg.Path); os.IsNotExist(err) {
+		PrintWarning(fmt.Sprintf("%s is already gone, removing it from the workspace state", pkg.Path))
+		config.RemovePackage(pkg.Name, pkg.InstalledVersion())
+		return nil
+	}
+
+	if _, err := os.Stat(filepath.Join(pkg.Path, workspace.FileListName)); os.IsNotExist(err) {
+		if !uninstallForce {
+			return fmt.Errorf("%s has no file list, reinstall it or use --force to remove %s entirely", pkg.PackageId, pkg.Path)
+		}
+		if err := os.RemoveAll(pkg.Path); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", pkg.Path, err)
+		}
+		config.RemovePackage(pkg.Name, pkg.InstalledVersion())
+		PrintSuccess(fmt.Sprintf("Uninstalled %s (removed %s)", pkg.PackageId, pkg.Path))
+		return nil
+	}
+
+	removed, err := workspace.RemoveInstalledFiles(pkg.Path)
+	if err != nil {
+		return fmt.Errorf("failed to uninstall %s: %w", pkg.PackageId, err)
+	}
+	config.RemovePackage(pkg.Name, pkg.InstalledVersion())
+	// Drop the <installs>/<name> directory once its last version is gone
+	_ = os.Remove(filepath.Dir(pkg.Path))
+
+	for _, path := range removed.Modified {
+		PrintWarning("Removed modified file " + path)
+	}
+	for _, path := range removed.Outside {
+		PrintWarning("Left " + path + " alone, it is outside of the install prefix or behind a symlink")
+	}
+	if len(removed.Missing) > 0 {
+		PrintWarning(fmt.Sprintf("%d recorded file(s) were already missing", len(removed.Missing)))
+	}
+	if len(removed.Kept) > 0 {
+		PrintInfo(fmt.Sprintf("Kept %d file(s) not written by the install in %s", len(removed.Kept), pkg.Path))
+		if verbose {
+			for _, path := range removed.Kept {
+				PrintBullet(path)
+			}
+		}
+	}
+	PrintSuccess(fmt.Sprintf("Uninstalled %s (%d file(s) removed)", pkg.PackageId, removed.Removed))
+	return nil
+}
@@ -0,0 +1,55 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/thisismeamir/hepsw/internal/configuration"
+	"github.com/thisismeamir/hepsw/internal/workspace"
+)
+
+func TestUninstallVariantKeepsDefault(t *testing.T) {
+	root := t.TempDir()
+	config := &configuration.Configuration{Workspace: root, Installs: filepath.Join(root, "installs")}
+	install := func(variant string) configuration.WorkspacePackageState {
+		pkg := configuration.WorkspacePackageState{
+			PackageId: "hello@1.0.0", Name: "hello", Version: "1.0.0", Variant: variant,
+			Path: workspace.InstallDir(config, "hello", "1.0.0"),
+		}
+		if variant != "" {
+			pkg.PackageId += "+" + variant
+			pkg.Path += "+" + variant
+		}
+		if err := os.MkdirAll(filepath.Join(pkg.Path, "bin"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(pkg.Path, "bin", "hello"), []byte(variant), 0755); err != nil {
+			t.Fatal(err)
+		}
+		files, err := workspace.ScanInstalledFiles(pkg.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := workspace.WriteFileList(pkg.Path, files); err != nil {
+			t.Fatal(err)
+		}
+		config.RecordPackage(pkg)
+		return pkg
+	}
+	defaultInstall := install("")
+	variant := install("abc123")
+
+	if err := uninstallPackage(config, variant); err != nil {
+		t.Fatalf("uninstallPackage failed: %v", err)
+	}
+	if _, ok := config.FindPackage("hello", "1.0.0+abc123"); ok {
+		t.Error("the variant is still recorded")
+	}
+	if _, ok := config.FindPackage("hello", "1.0.0"); !ok {
+		t.Error("uninstalling the variant dropped the default install")
+	}
+	if _, err := os.Stat(filepath.Join(defaultInstall.Path, "bin", "hello")); err != nil {
+		t.Errorf("the files of the default install were removed: %v", err)
+	}
+}
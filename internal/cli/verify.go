@@ -0,0 +1,136 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/thisismeamir/hepsw/internal/builder"
+	"github.com/thisismeamir/hepsw/internal/configuration"
+	"github.com/thisismeamir/hepsw/internal/relocate"
+	"github.com/thisismeamir/hepsw/internal/workspace"
+)
+
+var verifyRelocatable bool
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify [package[@version]...]",
+	Short: "Check installed packages against their file lists",
+	Long: `Verify compares the files of installed packages, all of them when none is
+named, with the file list recorded at install time and reports missing and
+modified files.
+
+--relocatable also audits the installs for relocatability: ELF binaries and
+shared libraries are checked for references to the build and source
+directories, DT_NEEDED libraries that cannot be found and RPATH entries
+outside of the workspace, and *.cmake, *.pc, *.la and *-config files for
+references to the build and source directories. The same audit runs before an
+install is promoted with 'hepsw build --verify-relocatable', or for every
+install when verifyRelocatable is set in the configuration.
+
+Example:
+  hepsw verify
+  hepsw verify root@6.30.02 --relocatable`,
+	RunE: runVerify,
+}
+
+func init() {
+	verifyCmd.Flags().BoolVar(&verifyRelocatable, "relocatable", false,
+		"also audit the installs for hardcoded build paths and broken RPATHs")
+}
+
+func runVerify(cmd *cobra.Command, args []string) error {
+	config, err := configuration.GetConfiguration()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	packages := config.State.Packages
+	if len(args) > 0 {
+		packages = make([]configuration.WorkspacePackageState, 0, len(args))
+		for _, arg := range args {
+			pkg, err := findInstalledPackage(config, arg)
+			if err != nil {
+				return err
+			}
+			packages = append(packages, *pkg)
+		}
+	}
+	if len(packages) == 0 {
+		PrintInfo("No installed packages")
+		return nil
+	}
+
+	failed := 0
+	for _, pkg := range packages {
+		if !verifyPackage(config, pkg) {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d package(s) failed verification", failed, len(packages))
+	}
+	PrintSuccess(fmt.Sprintf("All %d package(s) verified", len(packages)))
+	return nil
+}
+
+// verifyPackage prints the problems of an install and reports whether it
+// has none
+func verifyPackage(config *configuration.Configuration, pkg configuration.WorkspacePackageState) bool {
+	PrintSection(pkg.PackageId)
+	if _, err := os.Stat(pkg.Path); err != nil {
+		PrintError(fmt.Sprintf("Install prefix %s is missing", pkg.Path))
+		return false
+	}
+
+	ok := true
+	changes, err := workspace.CheckInstalledFiles(pkg.Path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		PrintWarning("No file list recorded, reinstall the package to verify its files")
+	case err != nil:
+		PrintError(err.Error())
+		return false
+	default:
+		for _, path := range changes.Missing {
+			PrintError("Missing " + path)
+		}
+		for _, path := range changes.Modified {
+			PrintWarning("Modified " + path)
+		}
+		if len(changes.Missing) > 0 || len(changes.Modified) > 0 {
+			ok = false
+		} else {
+			PrintInfo("Files match the file list")
+		}
+	}
+
+	if verifyRelocatable {
+		report, err := builder.AuditInstall(config, pkg)
+		if err != nil {
+			PrintError(err.Error())
+			return false
+		}
+		if !printRelocationReport(report) {
+			ok = false
+		}
+	}
+	return ok
+}
+
+// printRelocationReport prints the findings of a relocatability audit and
+// reports whether there were none
+func printRelocationReport(report *relocate.Report) bool {
+	for _, finding := range report.Findings {
+		PrintError(fmt.Sprintf("[%s] %s", finding.Kind, finding))
+	}
+	scanned := fmt.Sprintf("%d ELF file(s), %d text file(s)", report.ELFFiles, report.TextFiles)
+	if !report.OK() {
+		PrintWarning(fmt.Sprintf("Not relocatable: %d issue(s) in %s", len(report.Findings), scanned))
+		return false
+	}
+	PrintInfo("Relocatable: no issue in " + scanned)
+	return true
+}
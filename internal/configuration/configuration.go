@@ -11,18 +11,24 @@ import (
 )
 
 type Configuration struct {
-	Workspace   string         `yaml:"workspace"`
-	Sources     string         `yaml:"sources"`
-	Builds      string         `yaml:"builds"`
-	Installs    string         `yaml:"installs"`
-	Envs        string         `yaml:"envs"`
-	Logs        string         `yaml:"logs"`
-	Toolchains  string         `yaml:"toolchains"`
-	Manifests   string         `yaml:"manifests"`
-	Thirdparty  string         `yaml:"thirdparty"`
-	IndexConfig IndexConfig    `yaml:"indexConfig"`
-	State       WorkspaceState `yaml:"state"`
-	UserConfig  UserConfig     `yaml:"userConfig"`
+	Workspace  string          `yaml:"workspace"`
+	Sources    string          `yaml:"sources"`
+	Builds     string          `yaml:"builds"`
+	Installs   string          `yaml:"installs"`
+	Envs       string          `yaml:"envs"`
+	Logs       string          `yaml:"logs"`
+	Toolchains string          `yaml:"toolchains"`
+	Manifests  string          `yaml:"manifests"`
+	Thirdparty string          `yaml:"thirdparty"`
+	Distfiles  string          `yaml:"distfiles"`
+	Mirrors    []MirrorRewrite `yaml:"mirrors,omitempty"`
+	// BinaryCache is the directory installs are pushed to, BinaryCaches are
+	// more directories or http(s) URLs prebuilt installs are pulled from
+	BinaryCache  string         `yaml:"binaryCache,omitempty"`
+	BinaryCaches []string       `yaml:"binaryCaches,omitempty"`
+	IndexConfig  IndexConfig    `yaml:"indexConfig"`
+	State        WorkspaceState `yaml:"state"`
+	UserConfig   UserConfig     `yaml:"userConfig"`
 }
 
 type WorkspaceState struct {
@@ -40,15 +46,45 @@ type WorkspacePackageState struct {
 	InstallTime string   `yaml:"installTime"`
 	IsUsedBy    []string `yaml:"isUsedBy"`
 	IsUsing     []string `yaml:"isUsing"`
+	// BuildHash identifies the build configuration of the install. Variant
+	// is its prefix for installs built with options or variables, such an
+	// install is recorded under version <version>+<variant>.
+	BuildHash string            `yaml:"buildHash,omitempty"`
+	Variant   string            `yaml:"variant,omitempty"`
+	Options   []string          `yaml:"options,omitempty"`
+	Variables map[string]string `yaml:"variables,omitempty"`
+	// Files and Size describe the file list recorded in the install prefix
+	Files int   `yaml:"files,omitempty"`
+	Size  int64 `yaml:"size,omitempty"`
+	// Test is the outcome of the last test phase run against the build
+	Test *TestResult `yaml:"test,omitempty"`
+}
+
+// TestResult is the outcome of a run of the test phase of a recipe
+type TestResult struct {
+	Passed bool   `yaml:"passed" json:"passed"`
+	Time   string `yaml:"time" json:"time"`
+	// Duration is the total run time of the test steps, in seconds
+	Duration float64 `yaml:"duration" json:"duration"`
+	Steps    int     `yaml:"steps" json:"steps"`
+	// FailedStep and LogPath point at the failing step
+	FailedStep string `yaml:"failedStep,omitempty" json:"failedStep,omitempty"`
+	LogPath    string `yaml:"logPath,omitempty" json:"logPath,omitempty"`
+	Error      string `yaml:"error,omitempty" json:"error,omitempty"`
 }
 
 type WorkspaceSourceState struct {
-	SourceId string   `yaml:"sourceId"`
-	Name     string   `yaml:"name"`
-	Path     string   `yaml:"path"`
-	Version  string   `yaml:"version"`
-	IsUsedBy []string `yaml:"isUsedBy"`
-	IsUsing  []string `yaml:"isUsing"`
+	SourceId   string   `yaml:"sourceId"`
+	Name       string   `yaml:"name"`
+	Path       string   `yaml:"path"`
+	Version    string   `yaml:"version"`
+	Commit     string   `yaml:"commit,omitempty"`
+	ThirdParty bool     `yaml:"thirdParty,omitempty"`
+	IsUsedBy   []string `yaml:"isUsedBy"`
+	IsUsing    []string `yaml:"isUsing"`
+	// Test is the outcome of the last test phase run of a package that is
+	// not installed
+	Test *TestResult `yaml:"test,omitempty"`
 }
 
 type WorkspaceEnvironmentState struct {
@@ -62,6 +98,11 @@ type WorkspaceEnvironmentState struct {
 type UserConfig struct {
 	Verbosity      string `yaml:"verbosity"`
 	ParallelBuilds int    `yaml:"parallelBuilds"`
+	// VerifyRelocatable fails every install that does not pass the
+	// relocatability audit
+	VerifyRelocatable bool `yaml:"verifyRelocatable,omitempty"`
+	// IsolateNetwork runs every build without network access
+	IsolateNetwork bool `yaml:"isolateNetwork,omitempty"`
 }
 
 // Config holds the configuration for the HepSW index client
@@ -76,6 +117,34 @@ type IndexConfig struct {
 	LastSeenIDs map[string]int64 `yaml:"lastSyncId"`
 }
 
+// DistfilesDir returns the location of the downloaded source archive cache.
+// The cache can live outside the workspace so several workspaces on the same
+// machine share it; configurations predating it use <workspace>/distfiles.
+func (c *Configuration) DistfilesDir() string {
+	if c.Distfiles != "" {
+		return c.Distfiles
+	}
+	return path.Join(c.Workspace, "distfiles")
+}
+
+// BinaryCacheDir returns the binary cache directory installs are pushed to,
+// <workspace>/bincache for configurations that do not set it.
+func (c *Configuration) BinaryCacheDir() string {
+	if c.BinaryCache != "" {
+		return c.BinaryCache
+	}
+	return path.Join(c.Workspace, "bincache")
+}
+
+// ThirdPartyDir returns the location of imported third-party packages,
+// <workspace>/thirdparty for configurations that do not set it.
+func (c *Configuration) ThirdPartyDir() string {
+	if c.Thirdparty != "" {
+		return c.Thirdparty
+	}
+	return path.Join(c.Workspace, "thirdparty")
+}
+
 // Validate checks if the configuration is valid
 func (c *Configuration) ValidateRemote() error {
 
@@ -107,6 +176,7 @@ func RestoreDefaultConfiguration() error {
 			Envs:       path.Join(hepswPath, "envs"),
 			Toolchains: path.Join(hepswPath, "toolchains"),
 			Thirdparty: path.Join(hepswPath, "thirdparty"),
+			Distfiles:  path.Join(hepswPath, "distfiles"),
 			Logs:       path.Join(hepswPath, "logs"),
 			Manifests:  path.Join(hepswPath, "manifests"),
 			IndexConfig: IndexConfig{
@@ -163,6 +233,7 @@ func SaveDefaultConfiguration() error {
 		Envs:       path.Join(hepswPath, "envs"),
 		Toolchains: path.Join(hepswPath, "toolchains"),
 		Thirdparty: path.Join(hepswPath, "thirdparty"),
+		Distfiles:  path.Join(hepswPath, "distfiles"),
 		Logs:       path.Join(hepswPath, "logs"),
 		Manifests:  path.Join(hepswPath, "manifests"),
 		IndexConfig: IndexConfig{
@@ -0,0 +1,23 @@
+package configuration
+
+import "strings"
+
+// MirrorRewrite maps a URL prefix to a mirror serving the same files, e.g. an
+// internal copy of https://root.cern/download/
+type MirrorRewrite struct {
+	Prefix string `yaml:"prefix"`
+	Mirror string `yaml:"mirror"`
+}
+
+// MirrorsFor returns the mirror URLs for url from the rewrite table, in table
+// order. URLs that match no prefix have no mirrors.
+func (c *Configuration) MirrorsFor(url string) []string {
+	mirrors := make([]string, 0)
+	for _, rewrite := range c.Mirrors {
+		if rewrite.Prefix == "" || !strings.HasPrefix(url, rewrite.Prefix) {
+			continue
+		}
+		mirrors = append(mirrors, rewrite.Mirror+strings.TrimPrefix(url, rewrite.Prefix))
+	}
+	return mirrors
+}
@@ -0,0 +1,138 @@
+package configuration
+
+import "strings"
+
+// RecordSource adds a source to the workspace state, replacing any existing
+// entry for the same package version.
+func (c *Configuration) RecordSource(source WorkspaceSourceState) {
+	for i, existing := range c.State.Sources {
+		if existing.Name == source.Name && existing.Version == source.Version {
+			c.State.Sources[i] = source
+			return
+		}
+	}
+	c.State.Sources = append(c.State.Sources, source)
+}
+
+// FindSource looks up the state of a fetched source
+func (c *Configuration) FindSource(name, version string) (*WorkspaceSourceState, bool) {
+	for i, existing := range c.State.Sources {
+		if existing.Name == name && existing.Version == version {
+			return &c.State.Sources[i], true
+		}
+	}
+	return nil, false
+}
+
+// RecordPackage adds an installed package to the workspace state, replacing any
+// existing entry for the same package version. The IsUsedBy links between the
+// package and the already recorded packages are kept in sync in both directions.
+func (c *Configuration) RecordPackage(pkg WorkspacePackageState) {
+	if pkg.IsUsedBy == nil {
+		pkg.IsUsedBy = []string{}
+	}
+	for _, other := range c.State.Packages {
+		if other.PackageId != pkg.PackageId && containsString(other.IsUsing, pkg.Name) {
+			pkg.IsUsedBy = appendUnique(pkg.IsUsedBy, other.PackageId)
+		}
+	}
+
+	replaced := false
+	for i, existing := range c.State.Packages {
+		if existing.Name == pkg.Name && existing.Version == pkg.Version && existing.Variant == pkg.Variant {
+			c.State.Packages[i] = pkg
+			replaced = true
+			continue
+		}
+		if containsString(pkg.IsUsing, existing.Name) {
+			c.State.Packages[i].IsUsedBy = appendUnique(existing.IsUsedBy, pkg.PackageId)
+		}
+	}
+	if !replaced {
+		c.State.Packages = append(c.State.Packages, pkg)
+	}
+}
+
+// FindPackage looks up the state of an installed package. A variant install is
+// found with a <version>+<variant> version, a plain version only matches the
+// default install.
+func (c *Configuration) FindPackage(name, version string) (*WorkspacePackageState, bool) {
+	version, variant, _ := strings.Cut(version, "+")
+	for i, existing := range c.State.Packages {
+		if existing.Name == name && existing.Version == version && existing.Variant == variant {
+			return &c.State.Packages[i], true
+		}
+	}
+	return nil, false
+}
+
+// InstalledVersion is the version the package is recorded under, as
+// FindPackage and RemovePackage take it: <version>+<variant> for a variant
+func (p WorkspacePackageState) InstalledVersion() string {
+	if p.Variant == "" {
+		return p.Version
+	}
+	return p.Version + "+" + p.Variant
+}
+
+// RemovePackage drops an installed package from the workspace state and from
+// the IsUsedBy lists of the other packages. The version follows FindPackage.
+// It reports false when the package is not recorded.
+func (c *Configuration) RemovePackage(name, version string) bool {
+	target, ok := c.FindPackage(name, version)
+	if !ok {
+		return false
+	}
+	id := target.PackageId
+
+	packages := make([]WorkspacePackageState, 0, len(c.State.Packages))
+	for _, pkg := range c.State.Packages {
+		if pkg.PackageId != id {
+			packages = append(packages, pkg)
+		}
+	}
+
+	for i, pkg := range packages {
+		usedBy := make([]string, 0, len(pkg.IsUsedBy))
+		for _, user := range pkg.IsUsedBy {
+			if user != id {
+				usedBy = append(usedBy, user)
+			}
+		}
+		packages[i].IsUsedBy = usedBy
+	}
+	c.State.Packages = packages
+	return true
+}
+
+// RecordTestResult stores the outcome of a test run with the installed
+// package, or with its fetched source when the package is not installed yet.
+// It reports false when the package is unknown to the workspace.
+func (c *Configuration) RecordTestResult(name, version string, result TestResult) bool {
+	if pkg, ok := c.FindPackage(name, version); ok {
+		pkg.Test = &result
+		return true
+	}
+	version, _, _ = strings.Cut(version, "+")
+	if source, ok := c.FindSource(name, version); ok {
+		source.Test = &result
+		return true
+	}
+	return false
+}
+
+func containsString(slice []string, item string) bool {
+	for _, s := range slice {
+		if s == item {
+			return true
+		}
+	}
+	return false
+}
+
+func appendUnique(slice []string, item string) []string {
+	if containsString(slice, item) {
+		return slice
+	}
+	return append(slice, item)
+}
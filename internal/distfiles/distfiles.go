@@ -0,0 +1,295 @@
+package distfiles
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/thisismeamir/hepsw/internal/checksum"
+	"github.com/thisismeamir/hepsw/internal/manifest"
+	"gopkg.in/yaml.v3"
+)
+
+// Layout of the distfile cache:
+//
+//	<dir>/by-checksum/<algorithm>/<digest>   archives with a declared checksum
+//	<dir>/by-url/<sha256 of the url>         archives without one
+//
+// Every archive has a <file>.meta.yaml sidecar describing where it came from.
+
+const metaSuffix = ".meta.yaml"
+
+// Downloader downloads the archive of a source into path
+type Downloader func(source manifest.SourceSpec, path string) error
+
+// Cache is a content-addressed store of downloaded source archives. It may be
+// shared by several workspaces, all writes are done through atomic renames.
+type Cache struct {
+	Dir string
+}
+
+// Entry describes a cached archive
+type Entry struct {
+	Path      string `yaml:"-"`
+	Url       string `yaml:"url"`
+	Checksum  string `yaml:"checksum,omitempty"`
+	Sha256    string `yaml:"sha256"`
+	Size      int64  `yaml:"size"`
+	FetchedAt string `yaml:"fetchedAt"`
+	LastUsed  string `yaml:"lastUsed"`
+}
+
+// New creates a cache rooted at dir
+func New(dir string) *Cache {
+	return &Cache{Dir: dir}
+}
+
+// Path returns where the archive of a source is stored in the cache. Sources
+// are keyed by their checksum, falling back to a hash of the URL when there is
+// none or it is malformed.
+func (c *Cache) Path(source manifest.SourceSpec) string {
+	if source.Checksum != "" {
+		if algorithm, digest, err := checksum.Parse(source.Checksum); err == nil {
+			return filepath.Join(c.Dir, "by-checksum", algorithm, digest)
+		}
+	}
+	sum := sha256.Sum256([]byte(source.Url))
+	return filepath.Join(c.Dir, "by-url", hex.EncodeToString(sum[:]))
+}
+
+// Lookup returns the cached archive of a source without downloading it
+func (c *Cache) Lookup(source manifest.SourceSpec) (string, bool) {
+	path := c.Path(source)
+	if _, err := os.Stat(path); err != nil {
+		return "", false
+	}
+	return path, true
+}
+
+// Fetch returns the path of the archive of a source, downloading it into the
+// cache first when it is not present. Cached archives with a declared checksum
+// are verified before use and downloaded again if they are corrupted.
+func (c *Cache) Fetch(source manifest.SourceSpec, download Downloader) (string, bool, error) {
+	path := c.Path(source)
+
+	if _, err := os.Stat(path); err == nil {
+		valid := true
+		if source.Checksum != "" {
+			valid = checksum.VerifyFile(path, source.Checksum) == nil
+		}
+		if valid {
+			c.touch(path)
+			return path, true, nil
+		}
+		_ = c.remove(path)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", false, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".part-*")
+	if err != nil {
+		return "", false, fmt.Errorf("failed to create cache file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	_ = tmp.Close()
+
+	if err := download(source, tmpPath); err != nil {
+		_ = os.Remove(tmpPath)
+		return "", false, err
+	}
+
+	entry, err := newEntry(tmpPath, source)
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return "", false, err
+	}
+	// Temporary files are private, cached archives are shared like the rest
+	// of the workspace
+	if err := os.Chmod(tmpPath, 0644); err != nil {
+		_ = os.Remove(tmpPath)
+		return "", false, fmt.Errorf("failed to store archive in cache: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+		return "", false, fmt.Errorf("failed to store archive in cache: %w", err)
+	}
+	if err := writeEntry(path, entry); err != nil {
+		return "", false, err
+	}
+
+	return path, false, nil
+}
+
+// Entries lists every archive in the cache
+func (c *Cache) Entries() ([]Entry, error) {
+	entries := make([]Entry, 0)
+
+	err := filepath.Walk(c.Dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == c.Dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if info.IsDir() || !strings.HasSuffix(path, metaSuffix) {
+			return nil
+		}
+
+		entry, err := readEntry(strings.TrimSuffix(path, metaSuffix))
+		if err != nil {
+			return err
+		}
+		entries = append(entries, *entry)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cache: %w", err)
+	}
+
+	return entries, nil
+}
+
+// Verify re-hashes a cached archive and compares it with the digest recorded
+// when it was downloaded.
+func (c *Cache) Verify(entry Entry) error {
+	if _, err := os.Stat(entry.Path); err != nil {
+		return fmt.Errorf("archive is missing: %w", err)
+	}
+	if entry.Checksum != "" {
+		if err := checksum.VerifyFile(entry.Path, entry.Checksum); err != nil {
+			return err
+		}
+	}
+	return checksum.VerifyFile(entry.Path, "sha256:"+entry.Sha256)
+}
+
+// Prune removes archives that were not used since the given time, together
+// with leftovers of interrupted downloads. It returns the removed entries.
+func (c *Cache) Prune(unusedSince time.Time) ([]Entry, error) {
+	entries, err := c.Entries()
+	if err != nil {
+		return nil, err
+	}
+
+	removed := make([]Entry, 0)
+	for _, entry := range entries {
+		lastUsed, err := time.Parse(time.RFC3339, entry.LastUsed)
+		if err == nil && lastUsed.After(unusedSince) {
+			continue
+		}
+		if err := c.remove(entry.Path); err != nil {
+			return removed, err
+		}
+		removed = append(removed, entry)
+	}
+
+	// Leftovers of interrupted downloads and sidecar writes
+	var partials []string
+	for _, pattern := range []string{"*.part-*", "*.meta-*"} {
+		matches, _ := filepath.Glob(filepath.Join(c.Dir, "*", "*", pattern))
+		urlMatches, _ := filepath.Glob(filepath.Join(c.Dir, "by-url", pattern))
+		partials = append(append(partials, matches...), urlMatches...)
+	}
+	for _, partial := range partials {
+		info, err := os.Stat(partial)
+		if err == nil && info.ModTime().Before(unusedSince) {
+			_ = os.Remove(partial)
+		}
+	}
+
+	return removed, nil
+}
+
+// Remove deletes a cached archive and its sidecar
+func (c *Cache) Remove(entry Entry) error {
+	return c.remove(entry.Path)
+}
+
+func (c *Cache) remove(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove %s: %w", path, err)
+	}
+	if err := os.Remove(path + metaSuffix); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove %s: %w", path+metaSuffix, err)
+	}
+	return nil
+}
+
+// touch records that a cached archive was used
+func (c *Cache) touch(path string) {
+	entry, err := readEntry(path)
+	if err != nil {
+		return
+	}
+	entry.LastUsed = time.Now().Format(time.RFC3339)
+	_ = writeEntry(path, entry)
+}
+
+func newEntry(path string, source manifest.SourceSpec) (*Entry, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	sum, err := checksum.Compute(path, "sha256")
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Format(time.RFC3339)
+	return &Entry{
+		Url:       source.Url,
+		Checksum:  source.Checksum,
+		Sha256:    strings.TrimPrefix(sum, "sha256:"),
+		Size:      info.Size(),
+		FetchedAt: now,
+		LastUsed:  now,
+	}, nil
+}
+
+func readEntry(path string) (*Entry, error) {
+	data, err := os.ReadFile(path + metaSuffix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache entry: %w", err)
+	}
+	entry := &Entry{}
+	if err := yaml.Unmarshal(data, entry); err != nil {
+		return nil, fmt.Errorf("failed to parse cache entry: %w", err)
+	}
+	entry.Path = path
+	return entry, nil
+}
+
+// writeEntry writes the sidecar of a cached archive atomically
+func writeEntry(path string, entry *Entry) error {
+	data, err := yaml.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal cache entry: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".meta-*")
+	if err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	_ = tmp.Close()
+
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path+metaSuffix); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package distfiles
+
+import (
+	"os"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/thisismeamir/hepsw/internal/manifest"
+)
+
+func TestFetchUsesCache(t *testing.T) {
+	cache := New(t.TempDir())
+	source := manifest.SourceSpec{
+		Type:     "tarball",
+		Url:      "https://example.org/hello-1.0.0.tar.gz",
+		Checksum: "sha256:5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03",
+	}
+
+	downloads := 0
+	download := func(source manifest.SourceSpec, path string) error {
+		downloads++
+		return os.WriteFile(path, []byte("hello\n"), 0644)
+	}
+
+	path, hit, err := cache.Fetch(source, download)
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if hit || downloads != 1 {
+		t.Fatalf("expected a download on first fetch (hit=%v, downloads=%d)", hit, downloads)
+	}
+
+	again, hit, err := cache.Fetch(source, download)
+	if err != nil {
+		t.Fatalf("second Fetch failed: %v", err)
+	}
+	if !hit || again != path || downloads != 1 {
+		t.Errorf("expected the second fetch to be served from the cache")
+	}
+
+	// A corrupted archive is detected and downloaded again
+	if err := os.WriteFile(path, []byte("corrupted"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, hit, err := cache.Fetch(source, download); err != nil || hit || downloads != 2 {
+		t.Errorf("expected corrupted archive to be re-downloaded (hit=%v, downloads=%d, err=%v)", hit, downloads, err)
+	}
+
+	entries, err := cache.Entries()
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("expected one cache entry, got %d (%v)", len(entries), err)
+	}
+	if err := cache.Verify(entries[0]); err != nil {
+		t.Errorf("entry should verify: %v", err)
+	}
+}
+
+func TestFetchKeysByURLWithoutChecksum(t *testing.T) {
+	cache := New(t.TempDir())
+	a := manifest.SourceSpec{Url: "https://example.org/a.tar.gz"}
+	b := manifest.SourceSpec{Url: "https://example.org/b.tar.gz"}
+
+	if cache.Path(a) == cache.Path(b) {
+		t.Error("different URLs must map to different cache paths")
+	}
+}
+
+func TestPathIgnoresMalformedChecksums(t *testing.T) {
+	cache := New(t.TempDir())
+	source := manifest.SourceSpec{Url: "https://example.org/a.tar.gz", Checksum: "sha256:../../../../home/u/.bashrc"}
+
+	if got, want := cache.Path(source), cache.Path(manifest.SourceSpec{Url: source.Url}); got != want {
+		t.Errorf("expected a malformed checksum to fall back to the URL key %s, got %s", want, got)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	cache := New(t.TempDir())
+	download := func(source manifest.SourceSpec, path string) error {
+		return os.WriteFile(path, []byte(source.Url), 0644)
+	}
+	source := manifest.SourceSpec{Url: "https://example.org/old.tar.gz"}
+	path, _, err := cache.Fetch(source, download)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" {
+		for _, file := range []string{path, path + metaSuffix} {
+			if info, err := os.Stat(file); err != nil || info.Mode().Perm() != 0644 {
+				t.Errorf("expected %s to be readable by everyone, got %v (%v)", file, info.Mode(), err)
+			}
+		}
+	}
+
+	// Leftovers of an interrupted download and sidecar write
+	leftovers := []string{path + ".part-123", path + ".meta-456"}
+	for _, leftover := range leftovers {
+		if err := os.WriteFile(leftover, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removed, err := cache.Prune(time.Now().Add(-time.Hour))
+	if err != nil || len(removed) != 0 {
+		t.Fatalf("recently used archives must be kept (removed=%d, err=%v)", len(removed), err)
+	}
+
+	removed, err = cache.Prune(time.Now().Add(time.Minute))
+	if err != nil || len(removed) != 1 {
+		t.Fatalf("expected the archive to be pruned (removed=%d, err=%v)", len(removed), err)
+	}
+	if _, ok := cache.Lookup(source); ok {
+		t.Error("pruned archive is still in the cache")
+	}
+	for _, leftover := range leftovers {
+		if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be pruned", leftover)
+		}
+	}
+}
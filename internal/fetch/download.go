@@ -0,0 +1,39 @@
+package fetch
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+)
+
+// downloadFile downloads url into the file at path. The content is also
+// streamed to the given writers, e.g. to hash it while downloading.
+func downloadFile(url, path string, writers ...io.Writer) error {
+	resp, err := http.Get(url)
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			fmt.Printf("Error closing response body: %v\n", err)
+		}
+	}(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download %s: %s", url, resp.Status)
+	}
+
+	out, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+
+	if _, err := io.Copy(io.MultiWriter(append([]io.Writer{out}, writers...)...), resp.Body); err != nil {
+		_ = out.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	return out.Close()
+}
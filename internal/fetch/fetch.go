@@ -0,0 +1,82 @@
+package fetch
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/thisismeamir/hepsw/internal/configuration"
+	"github.com/thisismeamir/hepsw/internal/distfiles"
+	"github.com/thisismeamir/hepsw/internal/manifest"
+	"github.com/thisismeamir/hepsw/internal/remote"
+)
+
+// DefaultGitDepth is the clone depth used when a git source does not set one
+const DefaultGitDepth = 1
+
+// SourceOptions holds the workspace facilities FetchSource uses
+type SourceOptions struct {
+	// Cache stores downloaded archives
+	Cache *distfiles.Cache
+	// Config provides the mirror rewrite table, it may be nil
+	Config *configuration.Configuration
+	// Output receives download and clone progress, nil keeps quiet
+	Output io.Writer
+}
+
+// FetchSource materializes the source described by the manifest into dest.
+// The destination directory must not exist or be empty. Archives are
+// downloaded through the distfile cache, from the manifest URL or one of its
+// mirrors. For version controlled sources the resolved revision is returned,
+// otherwise the revision is empty.
+func FetchSource(m *manifest.Manifest, dest string, opts SourceOptions) (string, error) {
+	if err := prepareDestination(dest); err != nil {
+		return "", err
+	}
+
+	switch m.Source.Type {
+	case "git":
+		return fetchGit(m.Source, dest, opts.Output)
+	case "svn":
+		return remote.ExportSvnSource(dest, remote.SvnExportOptions{
+			URL:      m.Source.Url,
+			Revision: m.Source.Tag,
+			Progress: opts.Output,
+		})
+	case "tarball":
+		return "", fetchTarball(m.Source, dest, opts.Cache, SourceURLs(m.Source, opts.Config), opts.Output)
+	case "local":
+		return "", fetchLocal(m.Source, dest)
+	default:
+		return "", fmt.Errorf("unsupported source type: %s", m.Source.Type)
+	}
+}
+
+// fetchGit clones a git source at its tag, branch or commit and returns the
+// hash of the checked out commit
+func fetchGit(source manifest.SourceSpec, dest string, output io.Writer) (string, error) {
+	depth := DefaultGitDepth
+	if source.Depth != nil {
+		depth = *source.Depth
+	}
+
+	return remote.CheckoutSource(dest, remote.CheckoutOptions{
+		URL:        source.Url,
+		Ref:        source.Tag,
+		Depth:      depth,
+		Submodules: source.Submodules,
+		Progress:   output,
+	})
+}
+
+// prepareDestination ensures the destination is an empty directory
+func prepareDestination(dest string) error {
+	entries, err := os.ReadDir(dest)
+	if err == nil && len(entries) > 0 {
+		return fmt.Errorf("destination is not empty: %s", dest)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read destination: %w", err)
+	}
+	return os.MkdirAll(dest, 0755)
+}
@@ -0,0 +1,61 @@
+package fetch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/thisismeamir/hepsw/internal/configuration"
+	"github.com/thisismeamir/hepsw/internal/manifest"
+	"github.com/thisismeamir/hepsw/internal/workspace"
+)
+
+func TestFetchPackageLocal(t *testing.T) {
+	upstream := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(upstream, "include"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(upstream, "include", "hello.h"), []byte("#pragma once\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := &configuration.Configuration{Sources: t.TempDir()}
+	m := &manifest.Manifest{
+		Name:    "hello",
+		Version: "1.0.0",
+		Source:  manifest.SourceSpec{Type: "local", Url: "file://" + upstream},
+	}
+
+	result, err := FetchPackage(config, m, Options{})
+	if err != nil {
+		t.Fatalf("FetchPackage failed: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(result.Src, "include", "hello.h")); err != nil {
+		t.Errorf("source was not copied: %v", err)
+	}
+
+	bf, err := workspace.ReadBuildFile(result.BuildFile)
+	if err != nil {
+		t.Fatalf("ReadBuildFile failed: %v", err)
+	}
+	if bf.Src != workspace.SourceDir(config, "hello", "1.0.0") {
+		t.Errorf("unexpected src in build.yml: %s", bf.Src)
+	}
+
+	if _, ok := config.FindSource("hello", "1.0.0"); !ok {
+		t.Error("source state was not recorded")
+	}
+
+	// A second fetch without --force leaves the source alone
+	again, err := FetchPackage(config, m, Options{})
+	if err != nil {
+		t.Fatalf("second FetchPackage failed: %v", err)
+	}
+	if !again.Skipped {
+		t.Error("expected already fetched source to be skipped")
+	}
+	if len(config.State.Sources) != 1 {
+		t.Errorf("expected one source state entry, got %d", len(config.State.Sources))
+	}
+}
@@ -0,0 +1,93 @@
+package fetch
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/thisismeamir/hepsw/internal/checksum"
+	"github.com/thisismeamir/hepsw/internal/manifest"
+)
+
+// fetchLocal copies a source from the local filesystem into dest. A local
+// directory is copied as is, a local archive is verified against the declared
+// checksum and unpacked.
+func fetchLocal(source manifest.SourceSpec, dest string) error {
+	path := LocalPath(source.Url)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("local source not found: %w", err)
+	}
+
+	if !info.IsDir() {
+		if source.Checksum != "" {
+			if err := checksum.VerifyFile(path, source.Checksum); err != nil {
+				return fmt.Errorf("refusing to use %s: %w", path, err)
+			}
+		}
+		return unpackArchive(path, source, dest)
+	}
+
+	return copyTree(path, dest)
+}
+
+// LocalPath turns a file:// URL or a ~-prefixed path into a filesystem path
+func LocalPath(url string) string {
+	path := strings.TrimPrefix(url, "file://")
+	if strings.HasPrefix(path, "~/") {
+		if homeDir, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(homeDir, path[2:])
+		}
+	}
+	return path
+}
+
+// copyTree recursively copies the directory src into dst, keeping permissions
+// and symlinks.
+func copyTree(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case info.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm())
+		default:
+			return copyFile(path, target, info.Mode().Perm())
+		}
+	})
+}
+
+func copyFile(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,83 @@
+package fetch
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/thisismeamir/hepsw/internal/configuration"
+	"github.com/thisismeamir/hepsw/internal/distfiles"
+	"github.com/thisismeamir/hepsw/internal/manifest"
+)
+
+// SourceURLs returns the URLs a source is downloaded from, in the order they
+// are tried: the manifest URL and then its mirrors, each preceded by the
+// mirrors the configuration rewrite table maps it to. Internal mirrors are
+// preferred since they are usually closer and more reliable.
+func SourceURLs(source manifest.SourceSpec, config *configuration.Configuration) []string {
+	urls := make([]string, 0)
+	seen := make(map[string]bool)
+	add := func(url string) {
+		if url != "" && !seen[url] {
+			seen[url] = true
+			urls = append(urls, url)
+		}
+	}
+
+	for _, url := range append([]string{source.Url}, source.Mirrors...) {
+		if config != nil {
+			for _, mirror := range config.MirrorsFor(url) {
+				add(mirror)
+			}
+		}
+		add(url)
+	}
+	return urls
+}
+
+// MirrorDownloader returns a distfile downloader that tries each URL in order.
+// Every attempt is verified against the checksum of the source, so a mirror
+// serving a different file is skipped like an unreachable one. Attempts are
+// logged to log when it is not nil.
+func MirrorDownloader(urls []string, log io.Writer) distfiles.Downloader {
+	return func(source manifest.SourceSpec, path string) error {
+		_, err := DownloadFromMirrors(source, urls, path, log)
+		return err
+	}
+}
+
+// DownloadFromMirrors downloads the archive of a source into path from the
+// first URL that works and returns that URL
+func DownloadFromMirrors(source manifest.SourceSpec, urls []string, path string, log io.Writer) (string, error) {
+	if len(urls) == 0 {
+		urls = []string{source.Url}
+	}
+
+	var errs []error
+	for _, url := range urls {
+		attempt := source
+		attempt.Url = url
+
+		logf(log, "Downloading %s\n", url)
+		err := DownloadArchive(attempt, path)
+		if err == nil {
+			if len(urls) > 1 {
+				logf(log, "Downloaded from %s\n", url)
+			}
+			return url, nil
+		}
+
+		_ = os.Remove(path)
+		logf(log, "  failed: %v\n", err)
+		errs = append(errs, err)
+	}
+
+	return "", fmt.Errorf("all %d source URL(s) failed: %w", len(urls), errors.Join(errs...))
+}
+
+func logf(log io.Writer, format string, args ...any) {
+	if log != nil {
+		_, _ = fmt.Fprintf(log, format, args...)
+	}
+}
@@ -0,0 +1,71 @@
+package fetch
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/thisismeamir/hepsw/internal/configuration"
+	"github.com/thisismeamir/hepsw/internal/manifest"
+)
+
+func TestSourceURLs(t *testing.T) {
+	config := &configuration.Configuration{Mirrors: []configuration.MirrorRewrite{
+		{Prefix: "https://root.cern/download/", Mirror: "https://mirror.example.org/root/"},
+	}}
+	source := manifest.SourceSpec{
+		Url:     "https://root.cern/download/root_v6.30.02.source.tar.gz",
+		Mirrors: []string{"https://backup.example.org/root_v6.30.02.source.tar.gz"},
+	}
+
+	want := []string{
+		"https://mirror.example.org/root/root_v6.30.02.source.tar.gz",
+		"https://root.cern/download/root_v6.30.02.source.tar.gz",
+		"https://backup.example.org/root_v6.30.02.source.tar.gz",
+	}
+	if got := SourceURLs(source, config); !reflect.DeepEqual(got, want) {
+		t.Errorf("SourceURLs = %v, want %v", got, want)
+	}
+}
+
+func TestDownloadFromMirrors(t *testing.T) {
+	content := []byte("source archive")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/good":
+			_, _ = w.Write(content)
+		case "/tampered":
+			_, _ = w.Write([]byte("something else"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	source := manifest.SourceSpec{
+		Url:      server.URL + "/missing",
+		Checksum: fmt.Sprintf("sha256:%x", sha256.Sum256(content)),
+	}
+	urls := []string{server.URL + "/missing", server.URL + "/tampered", server.URL + "/good"}
+	target := filepath.Join(t.TempDir(), "archive")
+
+	used, err := DownloadFromMirrors(source, urls, target, nil)
+	if err != nil {
+		t.Fatalf("DownloadFromMirrors: %v", err)
+	}
+	if used != server.URL+"/good" {
+		t.Errorf("downloaded from %s, want the last mirror", used)
+	}
+	if data, _ := os.ReadFile(target); string(data) != string(content) {
+		t.Errorf("unexpected content %q", data)
+	}
+
+	if _, err := DownloadFromMirrors(source, urls[:2], target, nil); err == nil {
+		t.Error("expected an error when no mirror serves the archive")
+	}
+}
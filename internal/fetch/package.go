@@ -0,0 +1,197 @@
+package fetch
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/thisismeamir/hepsw/internal/configuration"
+	"github.com/thisismeamir/hepsw/internal/distfiles"
+	"github.com/thisismeamir/hepsw/internal/manifest"
+	"github.com/thisismeamir/hepsw/internal/manifest/loader"
+	"github.com/thisismeamir/hepsw/internal/workspace"
+)
+
+// Options controls how a package is fetched into the workspace
+type Options struct {
+	// SourcePath overrides the default <sources>/<name>/<version>/src location
+	SourcePath string
+	// Force re-fetches a source that is already present
+	Force bool
+	// Update ignores a previously recorded git commit or svn revision and
+	// resolves the manifest tag again. Without it a re-fetch checks out the
+	// recorded one.
+	Update bool
+	// ManifestDir resolves relative patch paths of the manifest
+	ManifestDir string
+	// Output receives download and clone progress, nil keeps quiet
+	Output io.Writer
+	// ThirdParty imports the package into the third-party area. Third-party
+	// packages are only used for dependencies when explicitly allowed.
+	ThirdParty bool
+}
+
+// Result describes where a fetched package ended up
+type Result struct {
+	Root      string
+	Src       string
+	Manifest  string
+	BuildFile string
+	Skipped   bool
+	// Commit is the resolved git commit or svn revision, empty for other source types
+	Commit string
+	// Pinned is set when the recorded commit was used instead of the tag
+	Pinned bool
+	// Patches lists the patches applied to the source
+	Patches []AppliedPatch
+	// ThirdParty is set for imported third-party packages
+	ThirdParty bool
+}
+
+// FetchPackage fetches the source of a manifest into the workspace, stores the
+// manifest beside it, writes build.yml and records the source in the workspace
+// state. The configuration is modified but not saved.
+func FetchPackage(config *configuration.Configuration, m *manifest.Manifest, opts Options) (*Result, error) {
+	result, err := fetchPackage(config, m, opts, recordedRevision(config, m, opts))
+	if err != nil {
+		return nil, err
+	}
+	if !result.Skipped {
+		config.RecordSource(sourceState(m, result))
+	}
+	return result, nil
+}
+
+// recordedRevision returns the revision a version controlled source was
+// fetched at before, so a re-fetch stays at it even if the tag has been moved
+// upstream since. It is empty when the manifest tag should be resolved.
+func recordedRevision(config *configuration.Configuration, m *manifest.Manifest, opts Options) string {
+	if opts.Update || (m.Source.Type != "git" && m.Source.Type != "svn") {
+		return ""
+	}
+	if state, ok := config.FindSource(m.Name, m.Version); ok && state.Commit != m.Source.Tag {
+		return state.Commit
+	}
+	return ""
+}
+
+// sourceState is the workspace state entry of a fetched source
+func sourceState(m *manifest.Manifest, result *Result) configuration.WorkspaceSourceState {
+	return configuration.WorkspaceSourceState{
+		SourceId:   fmt.Sprintf("%s@%s", m.Name, m.Version),
+		Name:       m.Name,
+		Path:       result.Root,
+		Version:    m.Version,
+		Commit:     result.Commit,
+		ThirdParty: result.ThirdParty,
+		IsUsedBy:   []string{},
+		IsUsing:    dependencyNames(m),
+	}
+}
+
+// fetchPackage does the work of FetchPackage without touching the workspace
+// state, so several packages can be fetched concurrently
+func fetchPackage(config *configuration.Configuration, m *manifest.Manifest, opts Options, revision string) (*Result, error) {
+	root := workspace.SourceRoot(config, m.Name, m.Version)
+	if opts.ThirdParty {
+		root = workspace.ThirdPartyRoot(config, m.Name, m.Version)
+	}
+	result := &Result{
+		Root:       root,
+		Src:        filepath.Join(root, workspace.SourceDirName),
+		Manifest:   filepath.Join(root, workspace.ManifestFileName),
+		BuildFile:  filepath.Join(root, workspace.BuildFileName),
+		ThirdParty: opts.ThirdParty,
+	}
+	if opts.SourcePath != "" {
+		absPath, err := filepath.Abs(opts.SourcePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve path: %w", err)
+		}
+		result.Src = absPath
+	}
+
+	if isPopulated(result.Src) {
+		if !opts.Force {
+			result.Skipped = true
+			return result, nil
+		}
+		if err := os.RemoveAll(result.Src); err != nil {
+			return nil, fmt.Errorf("failed to remove existing source: %w", err)
+		}
+	}
+
+	if err := os.MkdirAll(result.Root, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create source directory: %w", err)
+	}
+
+	fetched := m
+	if revision != "" {
+		pinned := *m
+		pinned.Source.Tag = revision
+		fetched = &pinned
+		result.Pinned = true
+	}
+
+	cache := distfiles.New(config.DistfilesDir())
+	commit, err := FetchSource(fetched, result.Src, SourceOptions{Cache: cache, Config: config, Output: opts.Output})
+	result.Commit = commit
+	if err != nil {
+		// Do not leave a half-fetched tree behind, it would be mistaken for a complete one.
+		_ = os.RemoveAll(result.Src)
+		return nil, fmt.Errorf("failed to fetch source of %s@%s: %w", m.Name, m.Version, err)
+	}
+
+	result.Patches, err = ApplyPatches(m, result.Src, PatchOptions{BaseDir: opts.ManifestDir, Cache: cache})
+	if err != nil {
+		_ = os.RemoveAll(result.Src)
+		return nil, fmt.Errorf("failed to patch source of %s@%s: %w", m.Name, m.Version, err)
+	}
+
+	if err := loader.SaveManifest(m, result.Manifest); err != nil {
+		return nil, err
+	}
+
+	buildFile := &workspace.BuildFile{
+		Name:       m.Name,
+		Version:    m.Version,
+		Src:        result.Src,
+		Manifest:   result.Manifest,
+		SourceType: m.Source.Type,
+		SourceUrl:  m.Source.Url,
+		SourceTag:  m.Source.Tag,
+		Commit:     result.Commit,
+		Patches:    patchNames(result.Patches),
+		FetchedAt:  time.Now().Format(time.RFC3339),
+		ThirdParty: opts.ThirdParty,
+	}
+	if err := workspace.WriteBuildFile(result.BuildFile, buildFile); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// isPopulated reports whether dir exists and has at least one entry
+func isPopulated(dir string) bool {
+	entries, err := os.ReadDir(dir)
+	return err == nil && len(entries) > 0
+}
+
+func patchNames(applied []AppliedPatch) []string {
+	names := make([]string, 0, len(applied))
+	for _, patch := range applied {
+		names = append(names, patch.Name)
+	}
+	return names
+}
+
+func dependencyNames(m *manifest.Manifest) []string {
+	names := make([]string, 0)
+	for _, dep := range manifest.NewManifestAccessor(m).AllDependencies() {
+		names = append(names, dep.Name)
+	}
+	return names
+}
@@ -0,0 +1,250 @@
+package fetch
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thisismeamir/hepsw/internal/checksum"
+	"github.com/thisismeamir/hepsw/internal/distfiles"
+	"github.com/thisismeamir/hepsw/internal/manifest"
+	"gopkg.in/yaml.v3"
+)
+
+// PatchRecordFile is written into the source directory and lists the patches
+// that were applied to it
+const PatchRecordFile = ".hepsw-patches.yml"
+
+// DefaultPatchStrip is the strip level used when a patch does not set one
+const DefaultPatchStrip = 1
+
+// ErrPatchNotFound is returned when the patch command is not installed
+var ErrPatchNotFound = errors.New("patch command not found in PATH")
+
+// AppliedPatch records a patch applied to a source directory
+type AppliedPatch struct {
+	Name      string `yaml:"name"`
+	Source    string `yaml:"source"`
+	Checksum  string `yaml:"checksum"`
+	Strip     int    `yaml:"strip"`
+	AppliedAt string `yaml:"appliedAt"`
+}
+
+// PatchOptions controls where patches are looked up
+type PatchOptions struct {
+	// BaseDir resolves relative patch paths, usually the manifest directory
+	BaseDir string
+	// Cache stores downloaded patches, nil downloads into a temporary file
+	Cache *distfiles.Cache
+}
+
+// PatchName returns a short name for a patch, its file name
+func PatchName(p manifest.PatchSpec) string {
+	if p.Path != "" {
+		return filepath.Base(p.Path)
+	}
+	return path.Base(p.Url)
+}
+
+// ResolvePatch returns the local path of a patch, downloading it if needed,
+// and verifies its checksum. The cleanup function removes temporary files.
+func ResolvePatch(p manifest.PatchSpec, opts PatchOptions) (string, func(), error) {
+	noop := func() {}
+
+	if p.Path != "" {
+		patchPath := LocalPath(p.Path)
+		if !filepath.IsAbs(patchPath) {
+			if opts.BaseDir == "" {
+				return "", noop, fmt.Errorf("patch %s has a relative path but the manifest location is unknown", p.Path)
+			}
+			patchPath = filepath.Join(opts.BaseDir, patchPath)
+		}
+		if _, err := os.Stat(patchPath); err != nil {
+			return "", noop, fmt.Errorf("patch not found: %w", err)
+		}
+		if p.Checksum != "" {
+			if err := checksum.VerifyFile(patchPath, p.Checksum); err != nil {
+				return "", noop, fmt.Errorf("patch %s: %w", p.Path, err)
+			}
+		}
+		return patchPath, noop, nil
+	}
+
+	// Downloaded patches share the distfile cache with source archives.
+	source := manifest.SourceSpec{Type: "tarball", Url: p.Url, Checksum: p.Checksum}
+	if opts.Cache != nil {
+		patchPath, _, err := opts.Cache.Fetch(source, DownloadArchive)
+		return patchPath, noop, err
+	}
+
+	tmp, err := os.CreateTemp("", "hepsw-patch-*")
+	if err != nil {
+		return "", noop, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	_ = tmp.Close()
+	cleanup := func() { _ = os.Remove(tmp.Name()) }
+	if err := DownloadArchive(source, tmp.Name()); err != nil {
+		cleanup()
+		return "", noop, err
+	}
+	return tmp.Name(), cleanup, nil
+}
+
+// ApplyPatches applies the patches of a manifest to srcDir in order. Either all
+// patches are applied or none: each patch is dry-run before it is applied, and
+// when one does not apply the patches applied before it are reverted. Patches
+// listed in the record file of srcDir are not applied again. The returned list
+// contains every patch applied to srcDir, including earlier ones.
+func ApplyPatches(m *manifest.Manifest, srcDir string, opts PatchOptions) ([]AppliedPatch, error) {
+	applied, err := ReadAppliedPatches(srcDir)
+	if err != nil {
+		return nil, err
+	}
+	if len(m.Source.Patches) == 0 {
+		return applied, nil
+	}
+
+	patchCmd, err := exec.LookPath("patch")
+	if err != nil {
+		return nil, ErrPatchNotFound
+	}
+
+	type pending struct {
+		path   string
+		strip  int
+		record AppliedPatch
+	}
+	var done []pending
+	rollback := func() error {
+		for i := len(done) - 1; i >= 0; i-- {
+			if err := runPatch(patchCmd, srcDir, done[i].path, done[i].strip, "--reverse"); err != nil {
+				return fmt.Errorf("failed to revert %s: %w", done[i].record.Name, err)
+			}
+		}
+		return nil
+	}
+
+	for _, p := range m.Source.Patches {
+		name := PatchName(p)
+		if isApplied(applied, p) {
+			continue
+		}
+
+		patchPath, cleanup, err := ResolvePatch(p, opts)
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("failed to resolve patch %s: %w", name, err), rollback())
+		}
+		defer cleanup()
+
+		strip := DefaultPatchStrip
+		if p.Strip != nil {
+			strip = *p.Strip
+		}
+
+		if err := runPatch(patchCmd, srcDir, patchPath, strip, "--forward", "--dry-run"); err != nil {
+			return nil, errors.Join(fmt.Errorf("patch %s does not apply: %w", name, err), rollback())
+		}
+		if err := runPatch(patchCmd, srcDir, patchPath, strip, "--forward"); err != nil {
+			return nil, errors.Join(fmt.Errorf("failed to apply patch %s: %w", name, err), rollback())
+		}
+
+		digest := p.Checksum
+		if digest == "" {
+			if digest, err = checksum.Compute(patchPath, checksum.DefaultAlgorithm); err != nil {
+				return nil, errors.Join(err, rollback())
+			}
+		}
+		source := p.Path
+		if source == "" {
+			source = p.Url
+		}
+		done = append(done, pending{
+			path:  patchPath,
+			strip: strip,
+			record: AppliedPatch{
+				Name:      name,
+				Source:    source,
+				Checksum:  digest,
+				Strip:     strip,
+				AppliedAt: time.Now().Format(time.RFC3339),
+			},
+		})
+	}
+
+	for _, d := range done {
+		applied = append(applied, d.record)
+	}
+	if err := writeAppliedPatches(srcDir, applied); err != nil {
+		return nil, errors.Join(err, rollback())
+	}
+	return applied, nil
+}
+
+// ReadAppliedPatches returns the patches recorded in srcDir, or an empty list
+// if no patch has been applied
+func ReadAppliedPatches(srcDir string) ([]AppliedPatch, error) {
+	data, err := os.ReadFile(filepath.Join(srcDir, PatchRecordFile))
+	if os.IsNotExist(err) {
+		return []AppliedPatch{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read applied patches: %w", err)
+	}
+
+	applied := []AppliedPatch{}
+	if err := yaml.Unmarshal(data, &applied); err != nil {
+		return nil, fmt.Errorf("failed to parse applied patches: %w", err)
+	}
+	return applied, nil
+}
+
+func writeAppliedPatches(srcDir string, applied []AppliedPatch) error {
+	data, err := yaml.Marshal(applied)
+	if err != nil {
+		return fmt.Errorf("failed to marshal applied patches: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(srcDir, PatchRecordFile), data, 0644); err != nil {
+		return fmt.Errorf("failed to record applied patches: %w", err)
+	}
+	return nil
+}
+
+// isApplied reports whether the patch is already listed in the record. Patches
+// with a checksum are matched on it, others on their location.
+func isApplied(applied []AppliedPatch, p manifest.PatchSpec) bool {
+	for _, a := range applied {
+		if p.Checksum != "" && strings.EqualFold(a.Checksum, p.Checksum) {
+			return true
+		}
+		if p.Checksum == "" && (a.Source == p.Path || a.Source == p.Url) {
+			return true
+		}
+	}
+	return false
+}
+
+// runPatch runs patch in srcDir. The output is only shown when it fails.
+func runPatch(patchCmd, srcDir, patchPath string, strip int, extra ...string) error {
+	args := []string{"--batch", "--no-backup-if-mismatch",
+		"-p" + strconv.Itoa(strip), "-d", srcDir, "-i", patchPath}
+	args = append(args, extra...)
+
+	var output bytes.Buffer
+	cmd := exec.Command(patchCmd, args...)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(output.String()); message != "" {
+			return fmt.Errorf("%w: %s", err, message)
+		}
+		return err
+	}
+	return nil
+}
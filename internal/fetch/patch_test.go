@@ -0,0 +1,88 @@
+package fetch
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/thisismeamir/hepsw/internal/manifest"
+)
+
+const (
+	greetingPatch = `--- a/hello.txt
++++ b/hello.txt
+@@ -1 +1 @@
+-hello
++hello, world
+`
+	brokenPatch = `--- a/hello.txt
++++ b/hello.txt
+@@ -1 +1 @@
+-goodbye
++goodbye, world
+`
+)
+
+func writePatchFixture(t *testing.T) (srcDir, patchDir string) {
+	t.Helper()
+	if _, err := exec.LookPath("patch"); err != nil {
+		t.Skip("patch is not installed")
+	}
+
+	srcDir = t.TempDir()
+	patchDir = t.TempDir()
+	if err := os.WriteFile(filepath.Join(srcDir, "hello.txt"), []byte("hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"greeting.patch": greetingPatch, "broken.patch": brokenPatch} {
+		if err := os.WriteFile(filepath.Join(patchDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return srcDir, patchDir
+}
+
+func TestApplyPatches(t *testing.T) {
+	srcDir, patchDir := writePatchFixture(t)
+	m := &manifest.Manifest{Source: manifest.SourceSpec{
+		Patches: []manifest.PatchSpec{{Path: "greeting.patch"}},
+	}}
+
+	applied, err := ApplyPatches(m, srcDir, PatchOptions{BaseDir: patchDir})
+	if err != nil {
+		t.Fatalf("ApplyPatches: %v", err)
+	}
+	if len(applied) != 1 || applied[0].Name != "greeting.patch" {
+		t.Fatalf("unexpected applied patches: %+v", applied)
+	}
+
+	data, _ := os.ReadFile(filepath.Join(srcDir, "hello.txt"))
+	if string(data) != "hello, world\n" {
+		t.Errorf("hello.txt = %q", data)
+	}
+
+	// Applying again is a no-op since the patch is recorded
+	if _, err := ApplyPatches(m, srcDir, PatchOptions{BaseDir: patchDir}); err != nil {
+		t.Fatalf("second ApplyPatches: %v", err)
+	}
+}
+
+func TestApplyPatchesRollsBack(t *testing.T) {
+	srcDir, patchDir := writePatchFixture(t)
+	m := &manifest.Manifest{Source: manifest.SourceSpec{
+		Patches: []manifest.PatchSpec{{Path: "greeting.patch"}, {Path: "broken.patch"}},
+	}}
+
+	if _, err := ApplyPatches(m, srcDir, PatchOptions{BaseDir: patchDir}); err == nil {
+		t.Fatal("expected the broken patch to fail")
+	}
+
+	data, _ := os.ReadFile(filepath.Join(srcDir, "hello.txt"))
+	if string(data) != "hello\n" {
+		t.Errorf("source was not rolled back, hello.txt = %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(srcDir, PatchRecordFile)); !os.IsNotExist(err) {
+		t.Error("patches were recorded although they were rolled back")
+	}
+}
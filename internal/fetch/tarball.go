@@ -0,0 +1,65 @@
+package fetch
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/thisismeamir/hepsw/internal/archive"
+	"github.com/thisismeamir/hepsw/internal/checksum"
+	"github.com/thisismeamir/hepsw/internal/distfiles"
+	"github.com/thisismeamir/hepsw/internal/manifest"
+)
+
+// fetchTarball downloads a tarball through the distfile cache, trying each of
+// urls in order, and unpacks it into dest
+func fetchTarball(source manifest.SourceSpec, dest string, cache *distfiles.Cache, urls []string, output io.Writer) error {
+	archivePath, _, err := cache.Fetch(source, MirrorDownloader(urls, output))
+	if err != nil {
+		return err
+	}
+
+	return unpackArchive(archivePath, source, dest)
+}
+
+// DownloadArchive downloads the archive of a tarball source into path. When the
+// source declares a checksum, the archive is hashed while it is downloaded and
+// removed again if the digest does not match.
+func DownloadArchive(source manifest.SourceSpec, path string) error {
+	if source.Checksum == "" {
+		return downloadFile(source.Url, path)
+	}
+
+	verifier, err := checksum.NewVerifier(source.Checksum)
+	if err != nil {
+		return err
+	}
+	if err := downloadFile(source.Url, path, verifier); err != nil {
+		return err
+	}
+	if err := verifier.Verify(); err != nil {
+		_ = os.Remove(path)
+		return fmt.Errorf("refusing to use %s: %w", source.Url, err)
+	}
+	return nil
+}
+
+// unpackArchive extracts a source archive into dest. Without an explicit
+// strip_components in the manifest, a single wrapping top-level directory
+// (e.g. root-6.30.02/) is stripped so the source lands directly in dest.
+func unpackArchive(archivePath string, source manifest.SourceSpec, dest string) error {
+	strip := 0
+	if source.StripComponents != nil {
+		strip = *source.StripComponents
+	} else {
+		single, err := archive.HasSingleTopLevelDirectory(archivePath)
+		if err != nil {
+			return err
+		}
+		if single {
+			strip = 1
+		}
+	}
+
+	return archive.Extract(archivePath, dest, archive.Options{StripComponents: strip})
+}
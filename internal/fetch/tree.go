@@ -0,0 +1,206 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/thisismeamir/hepsw/internal/configuration"
+	"github.com/thisismeamir/hepsw/internal/index/resolver"
+	"github.com/thisismeamir/hepsw/internal/manifest"
+)
+
+// DefaultWorkers is the number of concurrent fetches when none is configured
+const DefaultWorkers = 4
+
+// Target is a package to fetch as part of a dependency tree
+type Target struct {
+	Name    string
+	Version string
+	// Depth is the distance from the requested package, 0 for the package itself
+	Depth int
+}
+
+// ID returns the name@version of the target
+func (t Target) ID() string {
+	return fmt.Sprintf("%s@%s", t.Name, t.Version)
+}
+
+// TargetsFromTree returns the nodes of a dependency tree up to maxDepth, each
+// package once at the smallest depth it appears at
+func TargetsFromTree(root *resolver.DependencyNode, maxDepth int) []Target {
+	targets := make([]Target, 0)
+	seen := make(map[string]bool)
+
+	// Breadth first, so a package reachable through several paths is
+	// recorded at its smallest depth.
+	queue := []*resolver.DependencyNode{root}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		if node.Depth > maxDepth {
+			continue
+		}
+
+		target := Target{Name: node.Package, Version: node.Version, Depth: node.Depth}
+		// Nodes that were already visited by the resolver carry no version,
+		// the same package appears elsewhere in the tree with one.
+		key := target.Name
+		if target.Version != "" {
+			key = target.ID()
+		}
+		if !seen[key] {
+			seen[key] = true
+			targets = append(targets, target)
+		}
+		queue = append(queue, node.Dependencies...)
+	}
+
+	// Drop versionless duplicates of packages that are resolved elsewhere
+	resolved := make(map[string]bool)
+	for _, t := range targets {
+		if t.Version != "" {
+			resolved[t.Name] = true
+		}
+	}
+	unique := make([]Target, 0, len(targets))
+	for _, t := range targets {
+		if t.Version == "" && resolved[t.Name] {
+			continue
+		}
+		unique = append(unique, t)
+	}
+	return unique
+}
+
+// ManifestLoader loads the manifest of a package version
+type ManifestLoader func(name, version string) (*manifest.Manifest, error)
+
+// TreeResult is the outcome of fetching one target
+type TreeResult struct {
+	Target Target
+	Result *Result
+	Err    error
+}
+
+// TreeSummary groups the outcome of FetchTree
+type TreeSummary struct {
+	Fetched []TreeResult
+	Present []TreeResult
+	Failed  []TreeResult
+}
+
+// FetchTree fetches the manifests and sources of all targets with at most
+// workers concurrent fetches. Targets that appear more than once are fetched
+// once. Every fetched source is recorded in the workspace state, the
+// configuration is modified but not saved. A failing target does not stop the
+// others.
+func FetchTree(ctx context.Context, config *configuration.Configuration, targets []Target, load ManifestLoader, opts Options, workers int) *TreeSummary {
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+
+	unique := make([]Target, 0, len(targets))
+	seen := make(map[string]bool)
+	for _, target := range targets {
+		if !seen[target.ID()] {
+			seen[target.ID()] = true
+			unique = append(unique, target)
+		}
+	}
+
+	jobs := make(chan Target)
+	results := make(chan TreeResult)
+	var stateLock sync.Mutex
+
+	var wg sync.WaitGroup
+	for range min(workers, len(unique)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for target := range jobs {
+				results <- fetchTarget(ctx, config, target, load, opts, &stateLock)
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		for _, target := range unique {
+			select {
+			case jobs <- target:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	summary := &TreeSummary{}
+	done := make(map[string]bool)
+	for r := range results {
+		done[r.Target.ID()] = true
+		switch {
+		case r.Err != nil:
+			summary.Failed = append(summary.Failed, r)
+		case r.Result.Skipped:
+			summary.Present = append(summary.Present, r)
+		default:
+			summary.Fetched = append(summary.Fetched, r)
+		}
+	}
+
+	// Targets never handed to a worker because the context was cancelled
+	for _, target := range unique {
+		if !done[target.ID()] {
+			summary.Failed = append(summary.Failed, TreeResult{Target: target, Err: ctx.Err()})
+		}
+	}
+
+	for _, group := range [][]TreeResult{summary.Fetched, summary.Present, summary.Failed} {
+		sort.Slice(group, func(i, j int) bool {
+			if group[i].Target.Depth != group[j].Target.Depth {
+				return group[i].Target.Depth < group[j].Target.Depth
+			}
+			return group[i].Target.Name < group[j].Target.Name
+		})
+	}
+	return summary
+}
+
+// fetchTarget loads the manifest of a target and fetches its source. The
+// workspace state is only accessed while holding stateLock.
+func fetchTarget(ctx context.Context, config *configuration.Configuration, target Target, load ManifestLoader, opts Options, stateLock *sync.Mutex) TreeResult {
+	r := TreeResult{Target: target}
+	if err := ctx.Err(); err != nil {
+		r.Err = err
+		return r
+	}
+	if target.Version == "" {
+		r.Err = fmt.Errorf("%s could not be resolved in the index", target.Name)
+		return r
+	}
+
+	m, err := load(target.Name, target.Version)
+	if err != nil {
+		r.Err = fmt.Errorf("failed to fetch manifest: %w", err)
+		return r
+	}
+
+	stateLock.Lock()
+	revision := recordedRevision(config, m, opts)
+	stateLock.Unlock()
+
+	r.Result, r.Err = fetchPackage(config, m, opts, revision)
+	if r.Err == nil && !r.Result.Skipped {
+		stateLock.Lock()
+		config.RecordSource(sourceState(m, r.Result))
+		stateLock.Unlock()
+	}
+	return r
+}
@@ -0,0 +1,84 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/thisismeamir/hepsw/internal/configuration"
+	"github.com/thisismeamir/hepsw/internal/index/resolver"
+	"github.com/thisismeamir/hepsw/internal/manifest"
+)
+
+func TestTargetsFromTree(t *testing.T) {
+	// geant4 -> clhep, xerces -> clhep (already visited, no version)
+	tree := &resolver.DependencyNode{Package: "geant4", Version: "11.2.0", Depth: 0, Dependencies: []*resolver.DependencyNode{
+		{Package: "clhep", Version: "2.4.7", Depth: 1},
+		{Package: "xerces", Version: "3.2.5", Depth: 1, Dependencies: []*resolver.DependencyNode{
+			{Package: "clhep", Depth: 2},
+			{Package: "icu", Version: "74.1", Depth: 2},
+		}},
+	}}
+
+	targets := TargetsFromTree(tree, 1)
+	var ids []string
+	for _, target := range targets {
+		ids = append(ids, target.ID())
+	}
+	want := []string{"geant4@11.2.0", "clhep@2.4.7", "xerces@3.2.5"}
+	if fmt.Sprint(ids) != fmt.Sprint(want) {
+		t.Errorf("targets = %v, want %v", ids, want)
+	}
+
+	if got := len(TargetsFromTree(tree, 2)); got != 4 {
+		t.Errorf("expected 4 targets at depth 2, got %d", got)
+	}
+}
+
+func TestFetchTree(t *testing.T) {
+	upstream := t.TempDir()
+	if err := os.WriteFile(filepath.Join(upstream, "README"), []byte("hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := &configuration.Configuration{Sources: t.TempDir()}
+	var loads atomic.Int32
+	load := func(name, version string) (*manifest.Manifest, error) {
+		loads.Add(1)
+		if name == "broken" {
+			return nil, fmt.Errorf("not in the index")
+		}
+		return &manifest.Manifest{
+			Name:    name,
+			Version: version,
+			Source:  manifest.SourceSpec{Type: "local", Url: upstream},
+		}, nil
+	}
+
+	targets := []Target{
+		{Name: "a", Version: "1.0", Depth: 0},
+		{Name: "b", Version: "1.0", Depth: 1},
+		{Name: "b", Version: "1.0", Depth: 1},
+		{Name: "broken", Version: "1.0", Depth: 1},
+	}
+	summary := FetchTree(context.Background(), config, targets, load, Options{}, 2)
+
+	if len(summary.Fetched) != 2 || len(summary.Failed) != 1 || len(summary.Present) != 0 {
+		t.Fatalf("unexpected summary: %d fetched, %d present, %d failed",
+			len(summary.Fetched), len(summary.Present), len(summary.Failed))
+	}
+	if loads.Load() != 3 {
+		t.Errorf("duplicate targets were loaded more than once: %d loads", loads.Load())
+	}
+	if len(config.State.Sources) != 2 {
+		t.Errorf("expected 2 recorded sources, got %d", len(config.State.Sources))
+	}
+
+	again := FetchTree(context.Background(), config, targets[:2], load, Options{}, 2)
+	if len(again.Present) != 2 {
+		t.Errorf("expected both packages to be already present, got %d", len(again.Present))
+	}
+}
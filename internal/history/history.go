@@ -0,0 +1,252 @@
+package history
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// FileName is the build history database in the workspace
+const FileName = "history.db"
+
+const schema = `
+CREATE TABLE IF NOT EXISTS runs (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	package TEXT NOT NULL,
+	version TEXT NOT NULL,
+	build_hash TEXT NOT NULL DEFAULT '',
+	command TEXT NOT NULL,
+	started_at TEXT NOT NULL,
+	wall_seconds REAL NOT NULL,
+	succeeded BOOLEAN NOT NULL,
+	dependencies TEXT NOT NULL DEFAULT '',
+	partial BOOLEAN NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS steps (
+	run_id INTEGER NOT NULL,
+	phase TEXT NOT NULL,
+	step_index INTEGER NOT NULL,
+	name TEXT NOT NULL,
+	status TEXT NOT NULL,
+	wall_seconds REAL NOT NULL,
+	user_seconds REAL NOT NULL,
+	system_seconds REAL NOT NULL,
+	peak_rss INTEGER NOT NULL,
+	FOREIGN KEY (run_id) REFERENCES runs(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_runs_package ON runs(package, started_at);
+CREATE INDEX IF NOT EXISTS idx_steps_run ON steps(run_id);
+`
+
+// Step statuses recorded in the history
+const (
+	StatusDone    = "done"
+	StatusSkipped = "skipped"
+	StatusFailed  = "failed"
+)
+
+// Run is a recorded execution of the recipe of a package
+type Run struct {
+	ID        int64
+	Package   string
+	Version   string
+	BuildHash string
+	// Command is the hepsw command that ran the recipe
+	Command   string
+	StartedAt time.Time
+	WallTime  time.Duration
+	Succeeded bool
+	// Partial is set when steps were skipped, resumed from the checkpoints of
+	// an earlier run: the wall time only covers part of the recipe
+	Partial bool
+	// Dependencies are the names of the packages the package depends on
+	Dependencies []string
+	Steps        []Step
+}
+
+// PackageID returns the name@version of the package of the run
+func (r *Run) PackageID() string {
+	return r.Package + "@" + r.Version
+}
+
+// Step is the resource usage of a recipe step in a run
+type Step struct {
+	Phase      string
+	Index      int
+	Name       string
+	Status     string
+	WallTime   time.Duration
+	UserTime   time.Duration
+	SystemTime time.Duration
+	// PeakRSS is the peak resident set size in bytes
+	PeakRSS int64
+}
+
+// DB is the build history database
+type DB struct {
+	db *sql.DB
+}
+
+// Open opens the build history database at path, creating it when needed
+func Open(path string) (*DB, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create history directory: %w", err)
+	}
+
+	db, err := sql.Open("sqlite3", "file:"+path+"?_foreign_keys=on&_busy_timeout=5000")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open build history: %w", err)
+	}
+	// Local SQLite — single writer, no pool needed
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(schema); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to initialize build history: %w", err)
+	}
+	// Histories recorded before partial runs were told apart lack the column
+	if err := addColumn(db, "runs", "partial", "BOOLEAN NOT NULL DEFAULT 0"); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to initialize build history: %w", err)
+	}
+	return &DB{db: db}, nil
+}
+
+// addColumn adds a column to a table created by an older schema
+func addColumn(db *sql.DB, table, column, definition string) error {
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, table, column).Scan(&count)
+	if err != nil || count > 0 {
+		return err
+	}
+	_, err = db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, column, definition))
+	return err
+}
+
+// Close closes the database
+func (h *DB) Close() error {
+	return h.db.Close()
+}
+
+// Record stores a run and its steps, and sets its ID
+func (h *DB) Record(run *Run) error {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to record run: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`INSERT INTO runs (package, version, build_hash, command, started_at, wall_seconds, succeeded, partial, dependencies)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		run.Package, run.Version, run.BuildHash, run.Command, run.StartedAt.UTC().Format(time.RFC3339Nano),
+		run.WallTime.Seconds(), run.Succeeded, run.Partial, strings.Join(run.Dependencies, ","))
+	if err != nil {
+		return fmt.Errorf("failed to record run: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to record run: %w", err)
+	}
+
+	for _, step := range run.Steps {
+		_, err := tx.Exec(`INSERT INTO steps (run_id, phase, step_index, name, status, wall_seconds, user_seconds, system_seconds, peak_rss)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			id, step.Phase, step.Index, step.Name, step.Status,
+			step.WallTime.Seconds(), step.UserTime.Seconds(), step.SystemTime.Seconds(), step.PeakRSS)
+		if err != nil {
+			return fmt.Errorf("failed to record step %s: %w", step.Name, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to record run: %w", err)
+	}
+	run.ID = id
+	return nil
+}
+
+// Runs returns the runs of the named packages, or of every package when none
+// is named, most recent first. limit bounds the runs per package, 0 returns
+// all of them.
+func (h *DB) Runs(packages []string, limit int) ([]Run, error) {
+	query := `SELECT id, package, version, build_hash, command, started_at, wall_seconds, succeeded, partial, dependencies FROM runs`
+	args := make([]any, 0, len(packages))
+	if len(packages) > 0 {
+		query += ` WHERE package IN (?` + strings.Repeat(`, ?`, len(packages)-1) + `)`
+		for _, name := range packages {
+			args = append(args, name)
+		}
+	}
+	query += ` ORDER BY started_at DESC, id DESC`
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query build history: %w", err)
+	}
+	defer rows.Close()
+
+	runs := make([]Run, 0)
+	perPackage := make(map[string]int)
+	for rows.Next() {
+		var run Run
+		var startedAt, dependencies string
+		var wall float64
+		if err := rows.Scan(&run.ID, &run.Package, &run.Version, &run.BuildHash, &run.Command,
+			&startedAt, &wall, &run.Succeeded, &run.Partial, &dependencies); err != nil {
+			return nil, fmt.Errorf("failed to read build history: %w", err)
+		}
+		if limit > 0 && perPackage[run.Package] >= limit {
+			continue
+		}
+		perPackage[run.Package]++
+
+		run.StartedAt, _ = time.Parse(time.RFC3339Nano, startedAt)
+		run.WallTime = seconds(wall)
+		if dependencies != "" {
+			run.Dependencies = strings.Split(dependencies, ",")
+		}
+		runs = append(runs, run)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read build history: %w", err)
+	}
+
+	for i := range runs {
+		if runs[i].Steps, err = h.steps(runs[i].ID); err != nil {
+			return nil, err
+		}
+	}
+	return runs, nil
+}
+
+func (h *DB) steps(runID int64) ([]Step, error) {
+	rows, err := h.db.Query(`SELECT phase, step_index, name, status, wall_seconds, user_seconds, system_seconds, peak_rss
+		FROM steps WHERE run_id = ? ORDER BY rowid`, runID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query build history: %w", err)
+	}
+	defer rows.Close()
+
+	steps := make([]Step, 0)
+	for rows.Next() {
+		var step Step
+		var wall, user, system float64
+		if err := rows.Scan(&step.Phase, &step.Index, &step.Name, &step.Status, &wall, &user, &system, &step.PeakRSS); err != nil {
+			return nil, fmt.Errorf("failed to read build history: %w", err)
+		}
+		step.WallTime, step.UserTime, step.SystemTime = seconds(wall), seconds(user), seconds(system)
+		steps = append(steps, step)
+	}
+	return steps, rows.Err()
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
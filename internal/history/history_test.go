@@ -0,0 +1,117 @@
+package history
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func run(pkg string, wall time.Duration, deps ...string) Run {
+	return Run{
+		Package: pkg, Version: "1.0", Command: "build", StartedAt: time.Now(),
+		WallTime: wall, Succeeded: true, Dependencies: deps,
+		Steps: []Step{{Phase: "build", Name: "compile", Status: StatusDone, WallTime: wall, PeakRSS: 1024}},
+	}
+}
+
+func TestRecordAndRuns(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), FileName))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer db.Close()
+
+	first := run("root", 10*time.Second, "zlib")
+	first.StartedAt = time.Now().Add(-time.Hour)
+	second := run("root", 12*time.Second, "zlib")
+	second.Steps = append(second.Steps, Step{Phase: "install", Name: "install", Status: StatusFailed,
+		WallTime: time.Second, UserTime: 500 * time.Millisecond, SystemTime: 250 * time.Millisecond, PeakRSS: 4096})
+	for _, r := range []*Run{&first, &second} {
+		if err := db.Record(r); err != nil {
+			t.Fatalf("Record failed: %v", err)
+		}
+	}
+	zlib := run("zlib", time.Second)
+	if err := db.Record(&zlib); err != nil {
+		t.Fatal(err)
+	}
+
+	runs, err := db.Runs([]string{"root"}, 0)
+	if err != nil {
+		t.Fatalf("Runs failed: %v", err)
+	}
+	if len(runs) != 2 || runs[0].ID != second.ID || runs[0].WallTime != 12*time.Second {
+		t.Fatalf("expected the most recent run first, got %+v", runs)
+	}
+	if len(runs[0].Dependencies) != 1 || len(runs[0].Steps) != 2 {
+		t.Fatalf("run not restored: %+v", runs[0])
+	}
+	if step := runs[0].Steps[1]; step.Status != StatusFailed || step.UserTime != 500*time.Millisecond || step.PeakRSS != 4096 {
+		t.Errorf("step not restored: %+v", step)
+	}
+
+	partial := run("zlib", 100*time.Millisecond)
+	partial.Partial = true
+	if err := db.Record(&partial); err != nil {
+		t.Fatal(err)
+	}
+	if runs, err := db.Runs([]string{"zlib"}, 0); err != nil || len(runs) != 2 || !runs[0].Partial || runs[1].Partial {
+		t.Errorf("partial run not restored: %+v (%v)", runs, err)
+	}
+
+	if runs, err := db.Runs(nil, 1); err != nil || len(runs) != 2 {
+		t.Errorf("expected the latest run of each package, got %d (%v)", len(runs), err)
+	}
+}
+
+func TestStats(t *testing.T) {
+	// Most recent first, like DB.Runs
+	runs := []Run{
+		run("app", 2*time.Second, "physics", "io"),
+		run("physics", 8*time.Second, "core"),
+		run("io", 3*time.Second, "core"),
+		run("core", 5*time.Second),
+		run("core", 4*time.Second),
+	}
+
+	trends := Trends(runs)
+	if len(trends) != 4 || trends[0].Package != "physics" {
+		t.Fatalf("expected the slowest package first, got %+v", trends)
+	}
+	for _, trend := range trends {
+		if trend.Package == "core" && (len(trend.WallTimes) != 2 || trend.Change() != 0.25) {
+			t.Errorf("unexpected core trend %+v, change %f", trend, trend.Change())
+		}
+	}
+
+	slowest := SlowestSteps(runs, 2)
+	if len(slowest) != 2 || slowest[0].Package != "physics" || slowest[1].Package != "core" || slowest[1].Runs != 2 {
+		t.Errorf("unexpected slowest steps: %+v", slowest)
+	}
+
+	path, total := CriticalPath(runs, nil)
+	if len(path) != 3 || path[0].Package != "core" || path[1].Package != "physics" || path[2].Package != "app" {
+		t.Fatalf("unexpected critical path: %+v", path)
+	}
+	// The latest run of core counts
+	if total != 15*time.Second {
+		t.Errorf("expected 15s, got %s", total)
+	}
+
+	if path, _ := CriticalPath(runs, []string{"io"}); len(path) != 2 || path[1].Package != "io" {
+		t.Errorf("expected the path to end at io, got %+v", path)
+	}
+
+	// A resumed run of core only covers part of its recipe
+	resumed := run("core", time.Second)
+	resumed.Partial = true
+	runs = append([]Run{resumed}, runs...)
+	for _, trend := range Trends(runs) {
+		if trend.Package == "core" && (trend.Latest != 5*time.Second || len(trend.WallTimes) != 2) {
+			t.Errorf("expected the resumed run to be left out, got %+v", trend)
+		}
+	}
+	if _, total := CriticalPath(runs, nil); total != 15*time.Second {
+		t.Errorf("expected the resumed run to be left out of the critical path, got %s", total)
+	}
+}
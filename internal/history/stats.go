@@ -0,0 +1,199 @@
+package history
+
+import (
+	"sort"
+	"time"
+)
+
+// Trend summarizes the complete successful runs of a package
+type Trend struct {
+	Package string
+	Version string
+	// Latest is the wall time of the most recent successful run
+	Latest time.Duration
+	// Average is the mean wall time over the runs
+	Average time.Duration
+	// WallTimes are the wall times of the runs, most recent first
+	WallTimes []time.Duration
+}
+
+// Change is the relative change of the latest run compared with the average
+// of the earlier ones, 0 with a single run
+func (t *Trend) Change() float64 {
+	if len(t.WallTimes) < 2 {
+		return 0
+	}
+	var earlier time.Duration
+	for _, wall := range t.WallTimes[1:] {
+		earlier += wall
+	}
+	mean := earlier / time.Duration(len(t.WallTimes)-1)
+	if mean == 0 {
+		return 0
+	}
+	return float64(t.Latest-mean) / float64(mean)
+}
+
+// StepStat aggregates the completed runs of a recipe step
+type StepStat struct {
+	Package string
+	Phase   string
+	Name    string
+	Runs    int
+	// AverageWall and MaxWall are the mean and longest wall times
+	AverageWall time.Duration
+	MaxWall     time.Duration
+	// AverageCPU is the mean user and system time
+	AverageCPU time.Duration
+	// PeakRSS is the largest peak resident set size in bytes
+	PeakRSS int64
+}
+
+// PathNode is a package on the critical path
+type PathNode struct {
+	Package  string
+	Version  string
+	WallTime time.Duration
+}
+
+// Trends returns the trend of every package with successful runs, slowest
+// latest run first. Partial runs are left out, their wall time does not
+// compare. runs must be ordered most recent first, like Runs returns them.
+func Trends(runs []Run) []Trend {
+	byPackage := make(map[string]*Trend)
+	order := make([]string, 0)
+	for _, run := range runs {
+		if !run.Succeeded || run.Partial {
+			continue
+		}
+		trend, ok := byPackage[run.Package]
+		if !ok {
+			trend = &Trend{Package: run.Package, Version: run.Version, Latest: run.WallTime}
+			byPackage[run.Package] = trend
+			order = append(order, run.Package)
+		}
+		trend.WallTimes = append(trend.WallTimes, run.WallTime)
+	}
+
+	trends := make([]Trend, 0, len(order))
+	for _, name := range order {
+		trend := byPackage[name]
+		var total time.Duration
+		for _, wall := range trend.WallTimes {
+			total += wall
+		}
+		trend.Average = total / time.Duration(len(trend.WallTimes))
+		trends = append(trends, *trend)
+	}
+	sort.SliceStable(trends, func(i, j int) bool { return trends[i].Latest > trends[j].Latest })
+	return trends
+}
+
+// SlowestSteps returns the completed steps with the longest average wall
+// time, at most limit of them
+func SlowestSteps(runs []Run, limit int) []StepStat {
+	type key struct{ pkg, phase, name string }
+	stats := make(map[key]*StepStat)
+	totals := make(map[key][2]time.Duration)
+	for _, run := range runs {
+		for _, step := range run.Steps {
+			if step.Status != StatusDone {
+				continue
+			}
+			k := key{run.Package, step.Phase, step.Name}
+			stat, ok := stats[k]
+			if !ok {
+				stat = &StepStat{Package: run.Package, Phase: step.Phase, Name: step.Name}
+				stats[k] = stat
+			}
+			stat.Runs++
+			stat.MaxWall = max(stat.MaxWall, step.WallTime)
+			stat.PeakRSS = max(stat.PeakRSS, step.PeakRSS)
+			total := totals[k]
+			total[0] += step.WallTime
+			total[1] += step.UserTime + step.SystemTime
+			totals[k] = total
+		}
+	}
+
+	slowest := make([]StepStat, 0, len(stats))
+	for k, stat := range stats {
+		stat.AverageWall = totals[k][0] / time.Duration(stat.Runs)
+		stat.AverageCPU = totals[k][1] / time.Duration(stat.Runs)
+		slowest = append(slowest, *stat)
+	}
+	sort.Slice(slowest, func(i, j int) bool {
+		if slowest[i].AverageWall != slowest[j].AverageWall {
+			return slowest[i].AverageWall > slowest[j].AverageWall
+		}
+		return slowest[i].Package+slowest[i].Name < slowest[j].Package+slowest[j].Name
+	})
+	if limit > 0 && len(slowest) > limit {
+		slowest = slowest[:limit]
+	}
+	return slowest
+}
+
+// CriticalPath returns the chain of dependent packages with the longest total
+// wall time, using the latest complete successful run of every package and
+// the dependencies it recorded. The chain ends at one of the roots, or at any
+// package when no root is given, and is ordered dependencies first.
+func CriticalPath(runs []Run, roots []string) ([]PathNode, time.Duration) {
+	latest := make(map[string]Run)
+	for _, run := range runs {
+		if _, ok := latest[run.Package]; !ok && run.Succeeded && !run.Partial {
+			latest[run.Package] = run
+		}
+	}
+
+	type best struct {
+		total time.Duration
+		next  string
+	}
+	memo := make(map[string]best)
+	visiting := make(map[string]bool)
+	var longest func(name string) time.Duration
+	longest = func(name string) time.Duration {
+		if result, ok := memo[name]; ok {
+			return result.total
+		}
+		run, ok := latest[name]
+		if !ok || visiting[name] {
+			return 0
+		}
+		visiting[name] = true
+		defer delete(visiting, name)
+
+		deps := append([]string{}, run.Dependencies...)
+		sort.Strings(deps)
+		result := best{}
+		for _, dep := range deps {
+			if total := longest(dep); total > result.total {
+				result = best{total: total, next: dep}
+			}
+		}
+		result.total += run.WallTime
+		memo[name] = result
+		return result.total
+	}
+
+	if len(roots) == 0 {
+		for name := range latest {
+			roots = append(roots, name)
+		}
+		sort.Strings(roots)
+	}
+	end, total := "", time.Duration(0)
+	for _, root := range roots {
+		if t := longest(root); t > total {
+			end, total = root, t
+		}
+	}
+
+	path := make([]PathNode, 0)
+	for name := end; name != ""; name = memo[name].next {
+		run := latest[name]
+		path = append([]PathNode{{Package: name, Version: run.Version, WallTime: run.WallTime}}, path...)
+	}
+	return path, total
+}
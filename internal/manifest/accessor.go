@@ -92,10 +92,25 @@ func (ma *ManifestAccessor) AllDependencies() []Dependency {
 
 // Get dependencies filtered by options
 func (ma *ManifestAccessor) GetDependenciesForOptions(options []string) []Dependency {
-	allDeps := ma.AllDependencies()
+	return filterForOptions(ma.AllDependencies(), options)
+}
+
+// GetBuildDependenciesForOptions returns the build dependencies enabled by the
+// options
+func (ma *ManifestAccessor) GetBuildDependenciesForOptions(options []string) []Dependency {
+	return filterForOptions(ma.BuildDependencies(), options)
+}
+
+// GetRuntimeDependenciesForOptions returns the runtime dependencies enabled by
+// the options
+func (ma *ManifestAccessor) GetRuntimeDependenciesForOptions(options []string) []Dependency {
+	return filterForOptions(ma.RuntimeDependencies(), options)
+}
+
+func filterForOptions(deps []Dependency, options []string) []Dependency {
 	filtered := make([]Dependency, 0)
 
-	for _, dep := range allDeps {
+	for _, dep := range deps {
 		if len(dep.ForOptions) == 0 {
 			// No option requirement, always include
 			filtered = append(filtered, dep)
@@ -189,6 +204,10 @@ func (ma *ManifestAccessor) BuildSteps() []RecipeStep {
 	return ma.manifest.Recipe.Build
 }
 
+func (ma *ManifestAccessor) TestSteps() []RecipeStep {
+	return ma.manifest.Recipe.Test
+}
+
 func (ma *ManifestAccessor) InstallSteps() []RecipeStep {
 	return ma.manifest.Recipe.Install
 }
@@ -202,6 +221,7 @@ func (ma *ManifestAccessor) AllRecipeSteps() []RecipeStep {
 	steps := make([]RecipeStep, 0)
 	steps = append(steps, ma.ConfigurationSteps()...)
 	steps = append(steps, ma.BuildSteps()...)
+	steps = append(steps, ma.TestSteps()...)
 	steps = append(steps, ma.InstallSteps()...)
 	steps = append(steps, ma.UseSteps()...)
 	return steps
@@ -214,6 +234,8 @@ func (ma *ManifestAccessor) GetStepsByPhase(phase string) []RecipeStep {
 		return ma.ConfigurationSteps()
 	case "build":
 		return ma.BuildSteps()
+	case "test":
+		return ma.TestSteps()
 	case "install":
 		return ma.InstallSteps()
 	case "use":
@@ -72,7 +72,7 @@ func LoadManifestFromIndex(packageIdentifier string) (*manifest.Manifest, error)
 	// Checking the validity of the URL (it must be YAML).
 	if !strings.HasSuffix(strings.ToLower(*manifestURL), ".yaml") &&
 		!strings.HasSuffix(strings.ToLower(*manifestURL), ".yml") {
-		return nil, fmt.Errorf("URL does not point to a YAML file: %s", manifestURL)
+		return nil, fmt.Errorf("URL does not point to a YAML file: %s", *manifestURL)
 	}
 
 	resp, err := http.Get(*manifestURL)
@@ -96,7 +96,7 @@ func LoadManifestFromIndex(packageIdentifier string) (*manifest.Manifest, error)
 	}
 
 	var thisManifest manifest.Manifest
-	if err := yaml.Unmarshal(data, thisManifest); err != nil {
+	if err := yaml.Unmarshal(data, &thisManifest); err != nil {
 		return nil, fmt.Errorf("failed to parse manifest YAML: %w", err)
 	}
 
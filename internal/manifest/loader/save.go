@@ -1,8 +1,10 @@
 package loader
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/thisismeamir/hepsw/internal/configuration"
 	"github.com/thisismeamir/hepsw/internal/manifest"
@@ -23,6 +25,82 @@ func SaveManifest(m *manifest.Manifest, path string) error {
 	return nil
 }
 
+// ErrNotPatchable is returned when a manifest file cannot be edited in place
+var ErrNotPatchable = errors.New("manifest cannot be edited in place")
+
+// SetSourceChecksum writes checksum into the source section of a YAML
+// manifest file. Only that line is added, or replaced when the checksum is
+// declared empty: comments, key order and formatting are kept. Manifests whose
+// source section is not a block mapping give ErrNotPatchable.
+func SetSourceChecksum(path, checksum string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read manifest file: %w", err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 {
+		return ErrNotPatchable
+	}
+	_, source := mappingEntry(doc.Content[0], "source")
+	if source == nil || source.Kind != yaml.MappingNode || source.Style&yaml.FlowStyle != 0 || len(source.Content) == 0 {
+		return ErrNotPatchable
+	}
+
+	newline := "\n"
+	if strings.Contains(string(data), "\r\n") {
+		newline = "\r\n"
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	key, value := mappingEntry(source, "checksum")
+	switch {
+	case key == nil:
+		// Added as the first key of the section, with its indentation
+		first := source.Content[0]
+		line := strings.Repeat(" ", first.Column-1) + "checksum: " + checksum + newline
+		lines = append(lines[:first.Line-1], append([]string{line}, lines[first.Line-1:]...)...)
+	case value.Kind == yaml.ScalarNode && value.Value == "" && value.Line == key.Line:
+		lines[key.Line-1] = strings.Repeat(" ", key.Column-1) + "checksum: " + checksum + newline
+	default:
+		return ErrNotPatchable
+	}
+	patched := strings.Join(lines, "")
+
+	// The edit must give the manifest the checksum and change nothing else
+	var before, after manifest.Manifest
+	if err := yaml.Unmarshal(data, &before); err != nil {
+		return fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	if err := yaml.Unmarshal([]byte(patched), &after); err != nil {
+		return ErrNotPatchable
+	}
+	before.Source.Checksum = checksum
+	want, _ := yaml.Marshal(&before)
+	got, _ := yaml.Marshal(&after)
+	if string(want) != string(got) {
+		return ErrNotPatchable
+	}
+	if err := os.WriteFile(path, []byte(patched), 0644); err != nil {
+		return fmt.Errorf("failed to write manifest file: %w", err)
+	}
+	return nil
+}
+
+// mappingEntry returns the key and value nodes of a key of a block mapping
+func mappingEntry(node *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+	if node.Kind != yaml.MappingNode || node.Style&yaml.FlowStyle != 0 {
+		return nil, nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i], node.Content[i+1]
+		}
+	}
+	return nil, nil
+}
+
 func SaveManifestFromRemote(packageIdentifier string) error {
 	config, configError := configuration.GetConfiguration()
 	if configError != nil {
@@ -0,0 +1,86 @@
+package loader
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSetSourceChecksum(t *testing.T) {
+	const checksum = "sha256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	cases := []struct {
+		name, manifest, want string
+	}{
+		{
+			name: "missing",
+			manifest: `# hello
+name: hello
+version: 1.0.0
+source:
+    # upstream release
+    type: tarball
+    url: https://example.org/hello-1.0.0.tar.gz
+recipe: {}
+`,
+			want: `# hello
+name: hello
+version: 1.0.0
+source:
+    # upstream release
+    checksum: ` + checksum + `
+    type: tarball
+    url: https://example.org/hello-1.0.0.tar.gz
+recipe: {}
+`,
+		},
+		{
+			name: "empty",
+			manifest: `name: hello
+version: 1.0.0
+source:
+  url: https://example.org/hello-1.0.0.tar.gz
+  checksum: ""
+  type: tarball
+`,
+			want: `name: hello
+version: 1.0.0
+source:
+  url: https://example.org/hello-1.0.0.tar.gz
+  checksum: ` + checksum + `
+  type: tarball
+`,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "hello.yaml")
+			if err := os.WriteFile(path, []byte(c.manifest), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := SetSourceChecksum(path, checksum); err != nil {
+				t.Fatalf("SetSourceChecksum failed: %v", err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != c.want {
+				t.Errorf("got\n%s\nwant\n%s", data, c.want)
+			}
+		})
+	}
+
+	// A flow mapping is left alone
+	path := filepath.Join(t.TempDir(), "hello.yaml")
+	flow := "name: hello\nversion: 1.0.0\nsource: {type: tarball, url: https://example.org/hello.tar.gz}\n"
+	if err := os.WriteFile(path, []byte(flow), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetSourceChecksum(path, checksum); !errors.Is(err, ErrNotPatchable) {
+		t.Errorf("expected ErrNotPatchable, got %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != flow {
+		t.Errorf("manifest changed: %s", data)
+	}
+}
@@ -1,5 +1,10 @@
 package manifest
 
+import (
+	"fmt"
+	"time"
+)
+
 type Manifest struct {
 	Name           string           `yaml:"name"`
 	Version        string           `yaml:"version"`
@@ -11,10 +16,29 @@ type Manifest struct {
 }
 
 type SourceSpec struct {
-	Type     string `yaml:"type"`
-	Url      string `yaml:"url"`
-	Tag      string `yaml:"tag,omitempty"`
+	Type            string   `yaml:"type"`
+	Url             string   `yaml:"url"`
+	Mirrors         []string `yaml:"mirrors,omitempty"`
+	Tag             string   `yaml:"tag,omitempty"`
+	Checksum        string   `yaml:"checksum,omitempty"`
+	StripComponents *int     `yaml:"strip_components,omitempty"`
+	// Depth of git clones, defaults to a shallow clone of 1, 0 clones the full history
+	Depth *int `yaml:"depth,omitempty"`
+	// Submodules recursively checks out git submodules
+	Submodules bool `yaml:"submodules,omitempty"`
+	// Patches are applied in order to the fetched source
+	Patches []PatchSpec `yaml:"patches,omitempty"`
+}
+
+// PatchSpec describes a patch applied to the source after it is fetched.
+// Exactly one of Path (relative to the manifest file) and Url is set.
+type PatchSpec struct {
+	Path     string `yaml:"path,omitempty"`
+	Url      string `yaml:"url,omitempty"`
 	Checksum string `yaml:"checksum,omitempty"`
+	// Strip is the number of leading path components removed from file
+	// names in the patch, as in patch -p. Defaults to 1.
+	Strip *int `yaml:"strip,omitempty"`
 }
 
 type ManifestMetaData struct {
@@ -69,6 +93,7 @@ type Targets struct {
 type Recipe struct {
 	Configuration []RecipeStep `yaml:"configuration"`
 	Build         []RecipeStep `yaml:"build"`
+	Test          []RecipeStep `yaml:"test,omitempty"`
 	Install       []RecipeStep `yaml:"install"`
 	Use           []RecipeStep `yaml:"use"`
 }
@@ -81,4 +106,47 @@ type RecipeStep struct {
 	WorkingDir string            `yaml:"working_dir,omitempty"`
 	If         string            `yaml:"if,omitempty"`
 	Set        map[string]string `yaml:"set,omitempty"`
+
+	// Timeout bounds every attempt of the step, as a duration like "90s" or
+	// "2h"
+	Timeout string `yaml:"timeout,omitempty"`
+	// Retries is how many times a failing step runs again
+	Retries int `yaml:"retries,omitempty"`
+	// ContinueOnError lets the recipe go on when the step still fails
+	ContinueOnError bool `yaml:"continue_on_error,omitempty"`
+
+	// Env is added to the environment of the step process only
+	Env map[string]string `yaml:"env,omitempty"`
+	// Shell runs the command with sh (the default), bash or python
+	Shell string `yaml:"shell,omitempty"`
+	// Capture names a variable receiving the trimmed standard output of the
+	// step, for the steps after it
+	Capture string `yaml:"capture,omitempty"`
+	// Network lets the step reach the network in a network isolated build
+	Network bool `yaml:"network,omitempty"`
 }
+
+// TimeoutDuration parses the timeout of the step, zero means no timeout
+func (s RecipeStep) TimeoutDuration() (time.Duration, error) {
+	if s.Timeout == "" {
+		return 0, nil
+	}
+	timeout, err := time.ParseDuration(s.Timeout)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timeout %q: %w", s.Timeout, err)
+	}
+	if timeout <= 0 {
+		return 0, fmt.Errorf("invalid timeout %q: must be positive", s.Timeout)
+	}
+	return timeout, nil
+}
+
+// Shells a recipe step command can run with
+const (
+	ShellSh     = "sh"
+	ShellBash   = "bash"
+	ShellPython = "python"
+)
+
+// Shells lists the supported step shells
+var Shells = []string{ShellSh, ShellBash, ShellPython}
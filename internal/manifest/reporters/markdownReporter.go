@@ -157,6 +157,7 @@ func generateMarkdownReport(m *manifest.Manifest) string {
 	sb.WriteString("## Recipe\n\n")
 	printMarkdownRecipePhase(&sb, "Configuration", m.Recipe.Configuration)
 	printMarkdownRecipePhase(&sb, "Build", m.Recipe.Build)
+	printMarkdownRecipePhase(&sb, "Test", m.Recipe.Test)
 	printMarkdownRecipePhase(&sb, "Install", m.Recipe.Install)
 	printMarkdownRecipePhase(&sb, "Use", m.Recipe.Use)
 
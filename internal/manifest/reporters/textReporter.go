@@ -2,6 +2,8 @@ package reporters
 
 import (
 	"fmt"
+	"maps"
+	"slices"
 	"strings"
 
 	"github.com/thisismeamir/hepsw/internal/manifest"
@@ -177,6 +179,7 @@ func textRecipeSummaryGenerator(m *manifest.Manifest) string {
 	sb.WriteString(strings.Repeat("-", 80) + "\n")
 	sb.WriteString(fmt.Sprintf("Configuration steps: %d\n", len(m.Recipe.Configuration)))
 	sb.WriteString(fmt.Sprintf("Build steps:         %d\n", len(m.Recipe.Build)))
+	sb.WriteString(fmt.Sprintf("Test steps:          %d\n", len(m.Recipe.Test)))
 	sb.WriteString(fmt.Sprintf("Install steps:       %d\n", len(m.Recipe.Install)))
 	sb.WriteString(fmt.Sprintf("Use steps:           %d\n", len(m.Recipe.Use)))
 	sb.WriteString("\n")
@@ -213,6 +216,7 @@ func generateTextReport(m *manifest.Manifest) string {
 	// Recipe Details
 	printRecipePhase(&sb, "Configuration", m.Recipe.Configuration)
 	printRecipePhase(&sb, "Build", m.Recipe.Build)
+	printRecipePhase(&sb, "Test", m.Recipe.Test)
 	printRecipePhase(&sb, "Install", m.Recipe.Install)
 	printRecipePhase(&sb, "Use", m.Recipe.Use)
 
@@ -244,6 +248,30 @@ func printRecipePhase(sb *strings.Builder, phaseName string, steps []manifest.Re
 		if step.If != "" {
 			sb.WriteString(fmt.Sprintf("   Condition: %s\n", step.If))
 		}
+		if step.Shell != "" {
+			sb.WriteString(fmt.Sprintf("   Shell: %s\n", step.Shell))
+		}
+		if step.Env != nil {
+			sb.WriteString("   Environment:\n")
+			for _, k := range slices.Sorted(maps.Keys(step.Env)) {
+				sb.WriteString(fmt.Sprintf("     %s = %s\n", k, step.Env[k]))
+			}
+		}
+		if step.Capture != "" {
+			sb.WriteString(fmt.Sprintf("   Captures: %s\n", step.Capture))
+		}
+		if step.Timeout != "" {
+			sb.WriteString(fmt.Sprintf("   Timeout: %s\n", step.Timeout))
+		}
+		if step.Retries > 0 {
+			sb.WriteString(fmt.Sprintf("   Retries: %d\n", step.Retries))
+		}
+		if step.ContinueOnError {
+			sb.WriteString("   On error: continue\n")
+		}
+		if step.Network {
+			sb.WriteString("   Network: allowed\n")
+		}
 		if step.Set != nil {
 			sb.WriteString("   Sets variables:\n")
 			for k, v := range step.Set {
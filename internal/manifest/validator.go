@@ -4,7 +4,10 @@ import (
 	"fmt"
 	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
+
+	"github.com/thisismeamir/hepsw/internal/checksum"
 )
 
 type ValidationResult struct {
@@ -124,16 +127,81 @@ func validateSource(m *Manifest, result *ValidationResult) {
 		}
 	}
 
+	for i, mirror := range m.Source.Mirrors {
+		if _, err := url.Parse(mirror); err != nil || mirror == "" {
+			result.AddError(fmt.Sprintf("source.mirrors[%d]", i), "invalid URL format")
+		}
+	}
+	if len(m.Source.Mirrors) > 0 && m.Source.Type != "tarball" {
+		result.AddWarning("source.mirrors", "mirrors only apply to tarball sources")
+	}
+
 	// Git-specific validation
 	if m.Source.Type == "git" && m.Source.Tag == "" {
 		result.AddWarning("source.tag", "git sources should specify a tag or branch")
 	}
 
+	// Svn-specific validation, the tag holds the revision
+	if m.Source.Type == "svn" {
+		if m.Source.Tag == "" || strings.EqualFold(m.Source.Tag, "HEAD") {
+			result.AddWarning("source.tag", "svn sources should pin a revision number")
+		} else if _, err := strconv.Atoi(m.Source.Tag); err != nil {
+			result.AddError("source.tag", "svn revision must be a number or HEAD")
+		}
+	}
+
+	if m.Source.Depth != nil && *m.Source.Depth < 0 {
+		result.AddError("source.depth", "depth must not be negative")
+	}
+	if m.Source.Type != "git" && (m.Source.Depth != nil || m.Source.Submodules) {
+		result.AddWarning("source", "depth and submodules only apply to git sources")
+	}
+
+	// Archive extraction validation
+	if m.Source.StripComponents != nil {
+		if *m.Source.StripComponents < 0 {
+			result.AddError("source.strip_components", "strip_components must not be negative")
+		}
+		if m.Source.Type != "tarball" && m.Source.Type != "local" {
+			result.AddWarning("source.strip_components", "strip_components only applies to tarball and local archive sources")
+		}
+	}
+
 	// Checksum validation
 	if m.Source.Checksum == "" {
 		result.AddWarning("source.checksum", "checksum is recommended for reproducibility")
 	} else if !isValidChecksum(m.Source.Checksum) {
-		result.AddError("source.checksum", "invalid checksum format (should be algorithm:hash)")
+		result.AddError("source.checksum", "invalid checksum format (should be algorithm:hash, with the hex digest of the algorithm)")
+	}
+
+	validatePatches(m, result)
+}
+
+// validatePatches checks the structure of the patch list. Whether the patch
+// files exist is checked by the commands that can resolve their location.
+func validatePatches(m *Manifest, result *ValidationResult) {
+	for i, p := range m.Source.Patches {
+		field := fmt.Sprintf("source.patches[%d]", i)
+
+		if p.Path == "" && p.Url == "" {
+			result.AddError(field, "patch must specify a path or a url")
+		}
+		if p.Path != "" && p.Url != "" {
+			result.AddError(field, "patch must specify either a path or a url, not both")
+		}
+		if p.Strip != nil && *p.Strip < 0 {
+			result.AddError(field+".strip", "strip must not be negative")
+		}
+
+		if p.Checksum == "" {
+			if p.Url != "" {
+				result.AddError(field+".checksum", "checksum is required for downloaded patches")
+			} else {
+				result.AddWarning(field+".checksum", "checksum is recommended for reproducibility")
+			}
+		} else if !isValidChecksum(p.Checksum) {
+			result.AddError(field+".checksum", "invalid checksum format (should be algorithm:hash, with the hex digest of the algorithm)")
+		}
 	}
 }
 
@@ -193,7 +261,7 @@ func validateDependency(dep Dependency, prefix string, result *ValidationResult)
 func validateRecipe(m *Manifest, result *ValidationResult) {
 	// Check if recipe has any steps
 	totalSteps := len(m.Recipe.Configuration) + len(m.Recipe.Build) +
-		len(m.Recipe.Install) + len(m.Recipe.Use)
+		len(m.Recipe.Test) + len(m.Recipe.Install) + len(m.Recipe.Use)
 
 	if totalSteps == 0 {
 		result.AddError("recipe", "recipe must contain at least one step")
@@ -203,6 +271,7 @@ func validateRecipe(m *Manifest, result *ValidationResult) {
 	// Validate each phase
 	validateRecipePhase(m.Recipe.Configuration, "recipe.configuration", result)
 	validateRecipePhase(m.Recipe.Build, "recipe.build", result)
+	validateRecipePhase(m.Recipe.Test, "recipe.test", result)
 	validateRecipePhase(m.Recipe.Install, "recipe.install", result)
 	validateRecipePhase(m.Recipe.Use, "recipe.use", result)
 
@@ -238,6 +307,43 @@ func validateRecipePhase(steps []RecipeStep, prefix string, result *ValidationRe
 		if step.If != "" && !isValidConditional(step.If) {
 			result.AddWarning(stepPrefix+".if", "conditional syntax may be invalid")
 		}
+
+		if _, err := step.TimeoutDuration(); err != nil {
+			result.AddError(stepPrefix+".timeout", err.Error())
+		}
+		if step.Retries < 0 {
+			result.AddError(stepPrefix+".retries", "retries cannot be negative")
+		}
+
+		// Timeouts, retries and continue_on_error only apply to steps running a process
+		if step.Command == "" && step.Script == "" && (step.Timeout != "" || step.Retries > 0 || step.ContinueOnError) {
+			result.AddWarning(stepPrefix, "timeout, retries and continue_on_error have no effect on a step without command or script")
+		}
+
+		if step.Shell != "" && !contains(Shells, step.Shell) {
+			result.AddError(stepPrefix+".shell", fmt.Sprintf("unsupported shell %q, expected one of %s", step.Shell, strings.Join(Shells, ", ")))
+		}
+		if step.Shell != "" && step.Command == "" {
+			result.AddWarning(stepPrefix+".shell", "shell only applies to command")
+		}
+
+		for k := range step.Env {
+			if !isValidVariableName(k) {
+				result.AddError(stepPrefix+".env", fmt.Sprintf("invalid environment variable name %q", k))
+			}
+		}
+		if len(step.Env) > 0 && step.Command == "" && step.Script == "" {
+			result.AddWarning(stepPrefix+".env", "env has no effect on a step without command or script")
+		}
+
+		if step.Capture != "" {
+			if !isValidVariableName(step.Capture) {
+				result.AddError(stepPrefix+".capture", fmt.Sprintf("invalid variable name %q", step.Capture))
+			}
+			if step.Command == "" && step.Script == "" {
+				result.AddError(stepPrefix+".capture", "capture needs a command or script")
+			}
+		}
 	}
 }
 
@@ -301,21 +407,31 @@ func isValidPackageName(name string) bool {
 	return matched
 }
 
+func isValidVariableName(name string) bool {
+	// Variable names are shell identifiers
+	matched, _ := regexp.MatchString(`^[A-Za-z_][A-Za-z0-9_]*$`, name)
+	return matched
+}
+
 func isValidVersion(version string) bool {
 	// Basic semantic versioning check
 	matched, _ := regexp.MatchString(`^\d+\.\d+\.\d+`, version)
 	return matched
 }
 
-func isValidChecksum(checksum string) bool {
-	// Format: algorithm:hash
-	parts := strings.Split(checksum, ":")
+func isValidChecksum(sum string) bool {
+	// Format: algorithm:hash, the hash being the hex digest of the algorithm
+	parts := strings.Split(sum, ":")
 	if len(parts) != 2 {
 		return false
 	}
 
 	validAlgos := []string{"md5", "sha1", "sha256", "sha512"}
-	return contains(validAlgos, parts[0])
+	if !contains(validAlgos, parts[0]) {
+		return false
+	}
+	_, _, err := checksum.Parse(sum)
+	return err == nil
 }
 
 func isValidVersionConstraint(constraint string) bool {
@@ -2,8 +2,10 @@ package manifest
 
 import (
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 )
 
@@ -31,8 +33,20 @@ type StepWalk struct {
 	Conditional string
 	WillExecute bool
 	Reason      string
+
+	Timeout         string
+	Retries         int
+	ContinueOnError bool
+	Env             map[string]string
+	Shell           string
+	Capture         string
+	Network         bool
 }
 
+// CapturedPlaceholder is the value of a captured variable during a walk, the
+// output of the step is only known once it runs
+const CapturedPlaceholder = "<determined at build time>"
+
 // WalkManifest simulates walking through a manifest's recipe
 func WalkManifest(m *Manifest, options []string, variables map[string]string) (*WalkResult, error) {
 	result := &WalkResult{
@@ -42,7 +56,7 @@ func WalkManifest(m *Manifest, options []string, variables map[string]string) (*
 	}
 
 	// Initialize default variables
-	initializeDefaultVariables(result.Variables, m)
+	InitializeDefaultVariables(result.Variables, m)
 
 	// Merge provided variables
 	for k, v := range variables {
@@ -56,6 +70,7 @@ func WalkManifest(m *Manifest, options []string, variables map[string]string) (*
 	}{
 		{"configuration", m.Recipe.Configuration},
 		{"build", m.Recipe.Build},
+		{"test", m.Recipe.Test},
 		{"install", m.Recipe.Install},
 		{"use", m.Recipe.Use},
 	}
@@ -87,11 +102,19 @@ func walkPhase(name string, steps []RecipeStep, options []string, variables map[
 			Conditional: step.If,
 			WillExecute: true,
 			Reason:      "",
+
+			Timeout:         step.Timeout,
+			Retries:         step.Retries,
+			ContinueOnError: step.ContinueOnError,
+			Env:             step.Env,
+			Shell:           step.Shell,
+			Capture:         step.Capture,
+			Network:         step.Network,
 		}
 
 		// Evaluate conditional
 		if step.If != "" {
-			willExecute, reason := evaluateConditional(step.If, options, variables)
+			willExecute, reason := EvaluateConditional(step.If, options, variables)
 			stepWalk.WillExecute = willExecute
 			stepWalk.Reason = reason
 		}
@@ -99,21 +122,26 @@ func walkPhase(name string, steps []RecipeStep, options []string, variables map[
 		// Process set variables
 		if step.Set != nil {
 			for k, v := range step.Set {
-				expanded := expandVariables(v, variables)
+				expanded := ExpandVariables(v, variables)
 				variables[k] = expanded
 				stepWalk.Reason = fmt.Sprintf("Sets variables: %v", step.Set)
 			}
 		}
 
+		if step.Capture != "" && stepWalk.WillExecute {
+			variables[step.Capture] = CapturedPlaceholder
+		}
+
 		phaseWalk.Steps = append(phaseWalk.Steps, stepWalk)
 	}
 
 	return phaseWalk
 }
 
-func evaluateConditional(condition string, options []string, variables map[string]string) (bool, string) {
+// EvaluateConditional decides whether a step guarded by an `if` runs
+func EvaluateConditional(condition string, options []string, variables map[string]string) (bool, string) {
 	// Expand variables in condition
-	expanded := expandVariables(condition, variables)
+	expanded := ExpandVariables(condition, variables)
 
 	// Check for negation
 	negated := false
@@ -162,7 +190,8 @@ func evaluateConditional(condition string, options []string, variables map[strin
 	return true, fmt.Sprintf("Cannot evaluate condition: %s", condition)
 }
 
-func initializeDefaultVariables(variables map[string]string, m *Manifest) error {
+// InitializeDefaultVariables fills in the variables every recipe can rely on
+func InitializeDefaultVariables(variables map[string]string, m *Manifest) error {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		return err
@@ -187,7 +216,8 @@ func initializeDefaultVariables(variables map[string]string, m *Manifest) error
 	return nil
 }
 
-func expandVariables(input string, variables map[string]string) string {
+// ExpandVariables replaces ${VAR} and $VAR references with their values
+func ExpandVariables(input string, variables map[string]string) string {
 	result := input
 
 	// Replace ${var} patterns
@@ -237,7 +267,7 @@ func PrintWalkResult(result *WalkResult) string {
 
 			if step.WillExecute {
 				if step.Command != "" {
-					expanded := expandVariables(step.Command, result.Variables)
+					expanded := ExpandVariables(step.Command, result.Variables)
 					sb.WriteString(fmt.Sprintf("    Command: %s\n", expanded))
 				}
 				if step.Script != "" {
@@ -247,9 +277,33 @@ func PrintWalkResult(result *WalkResult) string {
 					}
 				}
 				if step.WorkingDir != "" {
-					expanded := expandVariables(step.WorkingDir, result.Variables)
+					expanded := ExpandVariables(step.WorkingDir, result.Variables)
 					sb.WriteString(fmt.Sprintf("    Working Dir: %s\n", expanded))
 				}
+				if step.Shell != "" {
+					sb.WriteString(fmt.Sprintf("    Shell: %s\n", step.Shell))
+				}
+				if len(step.Env) > 0 {
+					sb.WriteString("    Env:\n")
+					for _, k := range slices.Sorted(maps.Keys(step.Env)) {
+						sb.WriteString(fmt.Sprintf("      %s = %s\n", k, ExpandVariables(step.Env[k], result.Variables)))
+					}
+				}
+				if step.Capture != "" {
+					sb.WriteString(fmt.Sprintf("    Captures: %s (%s)\n", step.Capture, strings.Trim(CapturedPlaceholder, "<>")))
+				}
+				if step.Timeout != "" {
+					sb.WriteString(fmt.Sprintf("    Timeout: %s\n", step.Timeout))
+				}
+				if step.Retries > 0 {
+					sb.WriteString(fmt.Sprintf("    Retries: %d\n", step.Retries))
+				}
+				if step.ContinueOnError {
+					sb.WriteString("    On error: continue\n")
+				}
+				if step.Network {
+					sb.WriteString("    Network: allowed\n")
+				}
 			} else {
 				sb.WriteString(fmt.Sprintf("    Skipped: %s\n", step.Reason))
 			}
@@ -0,0 +1,80 @@
+package relocate
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// defaultLibraryDirs are searched by the dynamic loader whatever ld.so.conf
+// says
+var defaultLibraryDirs = []string{"/lib", "/usr/lib", "/lib64", "/usr/lib64"}
+
+var (
+	systemLibraryDirs     []string
+	systemLibraryDirsOnce sync.Once
+)
+
+// SystemLibraryDirs returns the directories the dynamic loader searches for
+// libraries: LD_LIBRARY_PATH, the directories of /etc/ld.so.conf and its
+// includes, then the default directories.
+func SystemLibraryDirs() []string {
+	systemLibraryDirsOnce.Do(func() {
+		dirs := filepath.SplitList(os.Getenv("LD_LIBRARY_PATH"))
+		dirs = append(dirs, readLdSoConf("/etc/ld.so.conf", map[string]bool{})...)
+		dirs = append(dirs, defaultLibraryDirs...)
+
+		seen := make(map[string]bool)
+		for _, dir := range dirs {
+			if dir != "" && !seen[dir] {
+				seen[dir] = true
+				systemLibraryDirs = append(systemLibraryDirs, dir)
+			}
+		}
+	})
+	return append([]string{}, systemLibraryDirs...)
+}
+
+// readLdSoConf returns the directories listed in an ld.so.conf file,
+// following its include directives
+func readLdSoConf(path string, visited map[string]bool) []string {
+	if visited[path] {
+		return nil
+	}
+	visited[path] = true
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	dirs := make([]string, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		if pattern, ok := strings.CutPrefix(line, "include"); ok && pattern != "" && (pattern[0] == ' ' || pattern[0] == '\t') {
+			pattern = strings.TrimSpace(pattern)
+			if !filepath.IsAbs(pattern) {
+				pattern = filepath.Join(filepath.Dir(path), pattern)
+			}
+			matches, _ := filepath.Glob(pattern)
+			for _, match := range matches {
+				dirs = append(dirs, readLdSoConf(match, visited)...)
+			}
+			continue
+		}
+		dirs = append(dirs, line)
+	}
+	return dirs
+}
@@ -0,0 +1,99 @@
+package relocate
+
+import (
+	"debug/elf"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// NeededLibraries maps the DT_NEEDED libraries of the ELF files under prefix
+// to the files needing them, relative to prefix. Libraries provided by the
+// tree itself are left out.
+func NeededLibraries(prefix string) (map[string][]string, error) {
+	provided, err := SharedLibraries(prefix)
+	if err != nil {
+		return nil, err
+	}
+	own := make(map[string]bool, len(provided))
+	for _, library := range provided {
+		own[library] = true
+	}
+
+	needed := make(map[string][]string)
+	err = filepath.WalkDir(prefix, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() || !isELF(path) {
+			return nil
+		}
+		f, err := elf.Open(path)
+		if err != nil {
+			return nil
+		}
+		defer f.Close()
+
+		rel, err := filepath.Rel(prefix, path)
+		if err != nil {
+			return err
+		}
+		libraries, _ := f.DynString(elf.DT_NEEDED)
+		for _, library := range libraries {
+			library = filepath.Base(library)
+			if !own[library] {
+				needed[library] = append(needed[library], filepath.ToSlash(rel))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %w", prefix, err)
+	}
+	return needed, nil
+}
+
+// SharedLibraries lists the names a DT_NEEDED entry can use to load a shared
+// library of the tree under prefix: the file names of the libraries and
+// their symbolic links, and their sonames.
+func SharedLibraries(prefix string) ([]string, error) {
+	names := make(map[string]bool)
+	err := filepath.WalkDir(prefix, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !isSharedLibrary(d.Name()) {
+			return nil
+		}
+		names[d.Name()] = true
+
+		if d.Type().IsRegular() && isELF(path) {
+			if f, err := elf.Open(path); err == nil {
+				sonames, _ := f.DynString(elf.DT_SONAME)
+				for _, soname := range sonames {
+					names[soname] = true
+				}
+				_ = f.Close()
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %w", prefix, err)
+	}
+
+	libraries := make([]string, 0, len(names))
+	for name := range names {
+		libraries = append(libraries, name)
+	}
+	sort.Strings(libraries)
+	return libraries, nil
+}
+
+// isSharedLibrary reports whether a file name is the one of a shared library,
+// libfoo.so or libfoo.so.1.2
+func isSharedLibrary(name string) bool {
+	return strings.HasSuffix(name, ".so") || strings.Contains(name, ".so.")
+}
@@ -0,0 +1,348 @@
+package relocate
+
+import (
+	"bufio"
+	"bytes"
+	"debug/elf"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Kinds of relocatability issues
+const (
+	// KindBuildPath is a reference to the build or source directory
+	KindBuildPath = "build-path"
+	// KindMissingLibrary is a DT_NEEDED library that cannot be found
+	KindMissingLibrary = "missing-library"
+	// KindExternalRpath is an RPATH or RUNPATH entry outside of the workspace
+	KindExternalRpath = "external-rpath"
+)
+
+// textSuffixes are the text files scanned for build paths, next to *-config
+// scripts
+var textSuffixes = []string{".cmake", ".pc", ".la"}
+
+// Finding is a relocatability issue of an installed file
+type Finding struct {
+	Kind string `json:"kind"`
+	// File is relative to the audited prefix
+	File string `json:"file"`
+	// Line is set for findings in text files
+	Line   int    `json:"line,omitempty"`
+	Detail string `json:"detail"`
+}
+
+func (f Finding) String() string {
+	if f.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s", f.File, f.Line, f.Detail)
+	}
+	return fmt.Sprintf("%s: %s", f.File, f.Detail)
+}
+
+// Options configure an audit
+type Options struct {
+	// BuildPaths are directories the install must not reference, like the
+	// build and source directories
+	BuildPaths []string
+	// Workspace is the directory RPATH entries must stay within, they are not
+	// checked when empty
+	Workspace string
+	// InstallPrefix is the prefix the tree is installed into when it is
+	// audited somewhere else, like a staging area. Paths below it are looked
+	// up in the audited tree.
+	InstallPrefix string
+	// LibraryDirs are searched for DT_NEEDED libraries after the RPATH and
+	// RUNPATH entries of a file and the library directories of the tree,
+	// SystemLibraryDirs when nil
+	LibraryDirs []string
+}
+
+// Report is the result of an audit
+type Report struct {
+	Prefix string `json:"prefix"`
+	// ELFFiles and TextFiles count the scanned files
+	ELFFiles  int       `json:"elfFiles"`
+	TextFiles int       `json:"textFiles"`
+	Findings  []Finding `json:"findings"`
+}
+
+// OK reports whether the audit found no issue
+func (r *Report) OK() bool {
+	return len(r.Findings) == 0
+}
+
+// Count returns the number of findings of a kind
+func (r *Report) Count(kind string) int {
+	count := 0
+	for _, finding := range r.Findings {
+		if finding.Kind == kind {
+			count++
+		}
+	}
+	return count
+}
+
+// auditor holds the state of an audit of one tree
+type auditor struct {
+	root    string
+	options Options
+	report  *Report
+	// libraryDirs are the directories of the tree holding shared libraries,
+	// as installed paths
+	libraryDirs []string
+}
+
+// Audit scans the ELF files and the build system files of the tree at prefix
+// for references to the build paths, DT_NEEDED libraries that cannot be found
+// and RPATH entries pointing outside of the workspace.
+func Audit(prefix string, options Options) (*Report, error) {
+	if options.InstallPrefix == "" {
+		options.InstallPrefix = prefix
+	}
+	if options.LibraryDirs == nil {
+		options.LibraryDirs = SystemLibraryDirs()
+	}
+	a := &auditor{
+		root:    prefix,
+		options: options,
+		report:  &Report{Prefix: options.InstallPrefix, Findings: make([]Finding, 0)},
+	}
+
+	elfFiles := make([]string, 0)
+	textFiles := make([]string, 0)
+	libraryDirs := make(map[string]bool)
+	err := filepath.WalkDir(prefix, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(prefix, path)
+		if err != nil {
+			return err
+		}
+		switch {
+		case isELF(path):
+			elfFiles = append(elfFiles, rel)
+			if isSharedLibrary(d.Name()) {
+				libraryDirs[filepath.Dir(rel)] = true
+			}
+		case isText(d.Name()):
+			textFiles = append(textFiles, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %w", prefix, err)
+	}
+
+	for dir := range libraryDirs {
+		a.libraryDirs = append(a.libraryDirs, filepath.Join(options.InstallPrefix, dir))
+	}
+	sort.Strings(a.libraryDirs)
+
+	for _, rel := range elfFiles {
+		if err := a.auditELF(rel); err != nil {
+			return nil, err
+		}
+	}
+	for _, rel := range textFiles {
+		if err := a.auditText(rel); err != nil {
+			return nil, err
+		}
+	}
+	a.report.ELFFiles = len(elfFiles)
+	a.report.TextFiles = len(textFiles)
+	return a.report, nil
+}
+
+func (a *auditor) add(kind, rel string, line int, format string, args ...any) {
+	a.report.Findings = append(a.report.Findings, Finding{
+		Kind:   kind,
+		File:   filepath.ToSlash(rel),
+		Line:   line,
+		Detail: fmt.Sprintf(format, args...),
+	})
+}
+
+// auditELF checks the dynamic section and the loaded data of an ELF file
+func (a *auditor) auditELF(rel string) error {
+	f, err := elf.Open(filepath.Join(a.root, rel))
+	if err != nil {
+		// Not an ELF file after all, or one debug/elf cannot parse
+		return nil
+	}
+	defer f.Close()
+
+	// DT_RPATH is ignored by the loader when DT_RUNPATH is set
+	origin := filepath.Join(a.options.InstallPrefix, filepath.Dir(rel))
+	rpath, _ := f.DynString(elf.DT_RPATH)
+	runpath, _ := f.DynString(elf.DT_RUNPATH)
+	rpathDirs := a.checkSearchPath(rel, "RPATH", rpath, origin)
+	searchPath := a.checkSearchPath(rel, "RUNPATH", runpath, origin)
+	if len(runpath) == 0 {
+		searchPath = rpathDirs
+	}
+
+	needed, _ := f.DynString(elf.DT_NEEDED)
+	for _, library := range needed {
+		if !a.findLibrary(library, searchPath) {
+			a.add(KindMissingLibrary, rel, 0, "needed library %s is not found", library)
+		}
+	}
+
+	for _, section := range f.Sections {
+		// The dynamic strings were checked as RPATH entries already
+		if section.Type == elf.SHT_NOBITS || section.Flags&elf.SHF_ALLOC == 0 || section.Name == ".dynstr" {
+			continue
+		}
+		data, err := section.Data()
+		if err != nil {
+			continue
+		}
+		for _, buildPath := range a.options.BuildPaths {
+			if buildPath != "" && bytes.Contains(data, []byte(buildPath)) {
+				a.add(KindBuildPath, rel, 0, "%s references %s", section.Name, buildPath)
+			}
+		}
+	}
+	return nil
+}
+
+// checkSearchPath reports the RPATH or RUNPATH entries pointing into a build
+// path or outside of the workspace, and returns them as installed paths
+func (a *auditor) checkSearchPath(rel, tag string, values []string, origin string) []string {
+	dirs := make([]string, 0)
+	for _, value := range values {
+		for _, entry := range filepath.SplitList(value) {
+			dir := expandOrigin(entry, origin)
+			if dir == "" {
+				continue
+			}
+			dirs = append(dirs, dir)
+			if !filepath.IsAbs(dir) {
+				a.add(KindExternalRpath, rel, 0, "%s entry %s is relative to the working directory", tag, entry)
+				continue
+			}
+			if buildPath := a.buildPath(dir); buildPath != "" {
+				a.add(KindBuildPath, rel, 0, "%s entry %s points into %s", tag, entry, buildPath)
+				continue
+			}
+			if a.options.Workspace != "" && !within(dir, a.options.Workspace) {
+				a.add(KindExternalRpath, rel, 0, "%s entry %s is outside of the workspace", tag, entry)
+			}
+		}
+	}
+	return dirs
+}
+
+// buildPath returns the build path dir is below, if any
+func (a *auditor) buildPath(dir string) string {
+	for _, buildPath := range a.options.BuildPaths {
+		if buildPath != "" && within(dir, buildPath) {
+			return buildPath
+		}
+	}
+	return ""
+}
+
+// findLibrary looks a DT_NEEDED library up like the dynamic loader would
+func (a *auditor) findLibrary(library string, searchPath []string) bool {
+	if strings.Contains(library, "/") {
+		return a.exists(library)
+	}
+	dirs := append(append(append([]string{}, searchPath...), a.libraryDirs...), a.options.LibraryDirs...)
+	for _, dir := range dirs {
+		if a.exists(filepath.Join(dir, library)) {
+			return true
+		}
+	}
+	return false
+}
+
+// exists checks an installed path, in the audited tree when it is below the
+// install prefix
+func (a *auditor) exists(path string) bool {
+	if within(path, a.options.InstallPrefix) {
+		rel, _ := filepath.Rel(a.options.InstallPrefix, path)
+		path = filepath.Join(a.root, rel)
+	}
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// auditText reports the lines of a text file referencing a build path
+func (a *auditor) auditText(rel string) error {
+	f, err := os.Open(filepath.Join(a.root, rel))
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", rel, err)
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	for line := 1; ; line++ {
+		text, err := reader.ReadString('\n')
+		for _, buildPath := range a.options.BuildPaths {
+			if buildPath != "" && strings.Contains(text, buildPath) {
+				a.add(KindBuildPath, rel, line, "references %s", buildPath)
+				break
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", rel, err)
+		}
+	}
+}
+
+// expandOrigin expands $ORIGIN in an RPATH entry. Entries using other
+// dynamic string tokens cannot be resolved and are returned empty.
+func expandOrigin(entry, origin string) string {
+	entry = strings.ReplaceAll(entry, "${ORIGIN}", origin)
+	entry = strings.ReplaceAll(entry, "$ORIGIN", origin)
+	if entry == "" || strings.Contains(entry, "$") {
+		return ""
+	}
+	// Relative entries are resolved against the working directory
+	return filepath.Clean(entry)
+}
+
+// within reports whether path is dir or below it
+func within(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func isText(name string) bool {
+	if strings.HasSuffix(name, "-config") {
+		return true
+	}
+	for _, suffix := range textSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func isELF(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	magic := make([]byte, len(elf.ELFMAG))
+	if _, err := io.ReadFull(f, magic); err != nil {
+		return false
+	}
+	return string(magic) == elf.ELFMAG
+}
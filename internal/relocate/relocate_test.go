@@ -0,0 +1,66 @@
+package relocate
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAudit(t *testing.T) {
+	root := t.TempDir()
+	buildDir := filepath.Join(root, "builds", "hello", "1.0.0")
+	prefix := filepath.Join(root, "installs", "hello", "1.0.0")
+
+	for path, content := range map[string]string{
+		"lib/pkgconfig/hello.pc":            "prefix=" + prefix + "\nlibdir=" + buildDir + "/lib\n",
+		"lib/cmake/hello/helloConfig.cmake": "set(HELLO_PREFIX " + prefix + ")\n",
+		"share/doc/README":                  "built in " + buildDir + "\n",
+		"bin/hello-config":                  "#!/bin/sh\necho " + buildDir + "\n",
+	} {
+		full := filepath.Join(prefix, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Any dynamically linked system binary serves as an ELF file
+	system := "/bin/true"
+	data, err := os.ReadFile(system)
+	if err != nil {
+		t.Skipf("no %s to audit: %v", system, err)
+	}
+	if err := os.WriteFile(filepath.Join(prefix, "bin", "hello"), data, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	options := Options{BuildPaths: []string{buildDir}, Workspace: root}
+	report, err := Audit(prefix, options)
+	if err != nil {
+		t.Fatalf("Audit failed: %v", err)
+	}
+	if report.ELFFiles != 1 || report.TextFiles != 3 {
+		t.Errorf("expected 1 ELF and 3 text files, got %d and %d", report.ELFFiles, report.TextFiles)
+	}
+	// README is not a build system file
+	if report.Count(KindBuildPath) != 2 || report.Count(KindMissingLibrary) != 0 {
+		t.Fatalf("unexpected findings: %+v", report.Findings)
+	}
+	for _, finding := range report.Findings {
+		if finding.File == "lib/pkgconfig/hello.pc" && finding.Line != 2 {
+			t.Errorf("expected the finding on line 2, got %d", finding.Line)
+		}
+	}
+
+	// Without library directories the C library of the binary is missing
+	options.LibraryDirs = []string{}
+	report, err = Audit(prefix, options)
+	if err != nil {
+		t.Fatalf("Audit failed: %v", err)
+	}
+	if report.Count(KindMissingLibrary) == 0 {
+		t.Skipf("%s is not dynamically linked", system)
+	}
+}
@@ -25,12 +25,17 @@ func OpenRepo(repoDir string) (*git.Repository, error) {
 	return git.PlainOpen(repoDir)
 }
 
-// CloneRepo clones a repository from the given URL to the specified directory
+// CloneRepo clones the package index repository to the specified directory
 func CloneRepo(repoDir, branch string) error {
+	return CloneBranch(PackageIndexRepoURL, branch, repoDir)
+}
+
+// CloneBranch clones a single branch of the repository at url to the specified directory
+func CloneBranch(url, branch, repoDir string) error {
 	branchRef := plumbing.NewBranchReferenceName(branch)
 
 	_, err := git.PlainClone(repoDir, false, &git.CloneOptions{
-		URL:           PackageIndexRepoURL,
+		URL:           url,
 		ReferenceName: branchRef,
 		SingleBranch:  true,
 		Progress:      os.Stdout,
@@ -0,0 +1,136 @@
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// Package source checkouts. Unlike the package index repository, manifests may
+// point at any repository and pin it by tag, branch or commit.
+
+var commitPattern = regexp.MustCompile(`^[0-9a-fA-F]{40}$`)
+
+// CheckoutOptions describes a package source checkout
+type CheckoutOptions struct {
+	// URL of the repository, anything go-git can clone (https, ssh, local path)
+	URL string
+	// Ref is a tag, a branch or a full commit SHA. Empty means the default branch.
+	Ref string
+	// Depth limits the history to that many commits, 0 clones everything.
+	// Commits are always cloned with full history.
+	Depth int
+	// Submodules recursively initializes submodules
+	Submodules bool
+	// Progress receives the clone progress when set
+	Progress io.Writer
+}
+
+// IsCommitHash reports whether ref is a full commit SHA
+func IsCommitHash(ref string) bool {
+	return commitPattern.MatchString(ref)
+}
+
+// CheckoutSource clones a package source into repoDir at the requested ref and
+// returns the hash of the commit that was checked out, so the checkout can be
+// reproduced even if a tag or branch is moved later.
+func CheckoutSource(repoDir string, opts CheckoutOptions) (string, error) {
+	if IsCommitHash(opts.Ref) {
+		return checkoutCommit(repoDir, opts)
+	}
+
+	options := &git.CloneOptions{
+		URL:          opts.URL,
+		SingleBranch: true,
+		Depth:        opts.Depth,
+		Progress:     opts.Progress,
+	}
+	if opts.Submodules {
+		options.RecurseSubmodules = git.DefaultSubmoduleRecursionDepth
+	}
+
+	if opts.Ref == "" {
+		repo, err := git.PlainClone(repoDir, false, options)
+		if err != nil {
+			return "", fmt.Errorf("failed to clone %s: %w", opts.URL, err)
+		}
+		return headCommit(repo)
+	}
+
+	// Tags are the common case for released packages, fall back to branches.
+	options.ReferenceName = plumbing.NewTagReferenceName(opts.Ref)
+	repo, tagErr := git.PlainClone(repoDir, false, options)
+	if tagErr == nil {
+		return headCommit(repo)
+	}
+	if err := cleanDirectory(repoDir); err != nil {
+		return "", err
+	}
+
+	options.ReferenceName = plumbing.NewBranchReferenceName(opts.Ref)
+	repo, err := git.PlainClone(repoDir, false, options)
+	if err != nil {
+		if errors.Is(err, plumbing.ErrReferenceNotFound) || errors.Is(tagErr, plumbing.ErrReferenceNotFound) {
+			return "", fmt.Errorf("%s has no tag or branch named %s", opts.URL, opts.Ref)
+		}
+		return "", fmt.Errorf("failed to clone %s at %s: %w", opts.URL, opts.Ref, err)
+	}
+	return headCommit(repo)
+}
+
+// checkoutCommit clones the full repository and checks out a single commit
+func checkoutCommit(repoDir string, opts CheckoutOptions) (string, error) {
+	repo, err := git.PlainClone(repoDir, false, &git.CloneOptions{
+		URL:      opts.URL,
+		Progress: opts.Progress,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to clone %s: %w", opts.URL, err)
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return "", err
+	}
+
+	hash := plumbing.NewHash(opts.Ref)
+	if err := worktree.Checkout(&git.CheckoutOptions{Hash: hash, Force: true}); err != nil {
+		return "", fmt.Errorf("failed to check out commit %s: %w", opts.Ref, err)
+	}
+
+	if opts.Submodules {
+		submodules, err := worktree.Submodules()
+		if err != nil {
+			return "", err
+		}
+		if err := submodules.Update(&git.SubmoduleUpdateOptions{
+			Init:              true,
+			RecurseSubmodules: git.DefaultSubmoduleRecursionDepth,
+		}); err != nil {
+			return "", fmt.Errorf("failed to update submodules: %w", err)
+		}
+	}
+
+	return headCommit(repo)
+}
+
+func headCommit(repo *git.Repository) (string, error) {
+	head, err := repo.Head()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve HEAD: %w", err)
+	}
+	return head.Hash().String(), nil
+}
+
+// cleanDirectory removes the content of dir after a failed clone attempt
+func cleanDirectory(dir string) error {
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	return os.MkdirAll(dir, 0755)
+}
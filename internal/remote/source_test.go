@@ -0,0 +1,98 @@
+package remote
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// newTestRepository creates a repository with two commits, a tag on the first
+// one and a branch on the second one
+func newTestRepository(t *testing.T) (dir, first, second string) {
+	t.Helper()
+	dir = t.TempDir()
+
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	commit := func(content string) plumbing.Hash {
+		if err := os.WriteFile(filepath.Join(dir, "VERSION"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := worktree.Add("VERSION"); err != nil {
+			t.Fatal(err)
+		}
+		hash, err := worktree.Commit(content, &git.CommitOptions{
+			Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hash
+	}
+
+	firstHash := commit("1.0")
+	if _, err := repo.CreateTag("v1.0", firstHash, nil); err != nil {
+		t.Fatal(err)
+	}
+	secondHash := commit("2.0")
+	if err := repo.Storer.SetReference(plumbing.NewHashReference(plumbing.NewBranchReferenceName("develop"), secondHash)); err != nil {
+		t.Fatal(err)
+	}
+
+	return dir, firstHash.String(), secondHash.String()
+}
+
+func TestCheckoutSource(t *testing.T) {
+	origin, first, second := newTestRepository(t)
+
+	tests := []struct {
+		name    string
+		ref     string
+		commit  string
+		content string
+	}{
+		{"tag", "v1.0", first, "1.0"},
+		{"branch", "develop", second, "2.0"},
+		{"commit", first, first, "1.0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dest := t.TempDir()
+			commit, err := CheckoutSource(dest, CheckoutOptions{URL: origin, Ref: tt.ref, Depth: 1})
+			if err != nil {
+				t.Fatalf("CheckoutSource: %v", err)
+			}
+			if commit != tt.commit {
+				t.Errorf("commit = %s, want %s", commit, tt.commit)
+			}
+			data, err := os.ReadFile(filepath.Join(dest, "VERSION"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.content {
+				t.Errorf("VERSION = %q, want %q", data, tt.content)
+			}
+		})
+	}
+}
+
+func TestCheckoutSourceUnknownRef(t *testing.T) {
+	origin, _, _ := newTestRepository(t)
+
+	if _, err := CheckoutSource(t.TempDir(), CheckoutOptions{URL: origin, Ref: "missing"}); err == nil {
+		t.Fatal("expected an error for an unknown ref")
+	}
+}
@@ -0,0 +1,75 @@
+package remote
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// Subversion sources are handled by the svn command line client, there is no
+// maintained pure Go implementation.
+
+// ErrSvnNotFound is returned when the svn client is not installed
+var ErrSvnNotFound = errors.New("svn client not found in PATH, install subversion to fetch svn sources")
+
+// SvnExportOptions describes an svn source export
+type SvnExportOptions struct {
+	// URL of the repository path, e.g. https://svn.example.org/repo/tags/1.0
+	URL string
+	// Revision to export, a number or HEAD. Empty means HEAD.
+	Revision string
+	// Progress receives the client output when set
+	Progress io.Writer
+}
+
+// ExportSvnSource exports a revision of an svn repository into dest, without
+// .svn metadata, and returns the resolved revision number
+func ExportSvnSource(dest string, opts SvnExportOptions) (string, error) {
+	client, err := exec.LookPath("svn")
+	if err != nil {
+		return "", ErrSvnNotFound
+	}
+
+	revision := opts.Revision
+	if revision == "" {
+		revision = "HEAD"
+	}
+
+	// Resolve the revision first, so HEAD is recorded as the number it was.
+	resolved, err := runSvn(client, nil, "info", "--non-interactive", "--show-item", "last-changed-revision",
+		"-r", revision, opts.URL)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve revision %s of %s: %w", revision, opts.URL, err)
+	}
+	resolved = strings.TrimSpace(resolved)
+
+	if _, err := runSvn(client, opts.Progress, "export", "--non-interactive", "--force", "-r", resolved,
+		opts.URL, dest); err != nil {
+		return "", fmt.Errorf("failed to export %s at revision %s: %w", opts.URL, resolved, err)
+	}
+
+	return resolved, nil
+}
+
+// runSvn runs the svn client and returns its standard output. The standard
+// error is included in the returned error.
+func runSvn(client string, progress io.Writer, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(client, args...)
+	cmd.Stdout = &stdout
+	if progress != nil {
+		cmd.Stdout = io.MultiWriter(&stdout, progress)
+	}
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return "", fmt.Errorf("%w: %s", err, message)
+		}
+		return "", err
+	}
+	return stdout.String(), nil
+}
@@ -0,0 +1,67 @@
+package remote
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// newSvnRepository creates a file:// repository with one committed file
+func newSvnRepository(t *testing.T) string {
+	t.Helper()
+	for _, tool := range []string{"svn", "svnadmin"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s is not installed", tool)
+		}
+	}
+
+	root := t.TempDir()
+	repo := filepath.Join(root, "repo")
+	if out, err := exec.Command("svnadmin", "create", repo).CombinedOutput(); err != nil {
+		t.Fatalf("svnadmin create: %v: %s", err, out)
+	}
+
+	content := filepath.Join(root, "content")
+	if err := os.MkdirAll(content, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(content, "README"), []byte("svn"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	url := "file://" + repo
+	if out, err := exec.Command("svn", "import", "--non-interactive", "-m", "initial", content, url+"/trunk").CombinedOutput(); err != nil {
+		t.Fatalf("svn import: %v: %s", err, out)
+	}
+	return url + "/trunk"
+}
+
+func TestExportSvnSource(t *testing.T) {
+	url := newSvnRepository(t)
+	dest := t.TempDir()
+
+	revision, err := ExportSvnSource(dest, SvnExportOptions{URL: url, Revision: "1"})
+	if err != nil {
+		t.Fatalf("ExportSvnSource: %v", err)
+	}
+	if revision != "1" {
+		t.Errorf("revision = %s, want 1", revision)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "README")); err != nil {
+		t.Errorf("README was not exported: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, ".svn")); !os.IsNotExist(err) {
+		t.Errorf("export contains .svn metadata")
+	}
+}
+
+func TestExportSvnSourceMissingClient(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+
+	_, err := ExportSvnSource(t.TempDir(), SvnExportOptions{URL: "file:///nowhere"})
+	if !errors.Is(err, ErrSvnNotFound) {
+		t.Fatalf("err = %v, want ErrSvnNotFound", err)
+	}
+}
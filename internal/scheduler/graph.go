@@ -0,0 +1,234 @@
+package scheduler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/thisismeamir/hepsw/internal/configuration"
+	"github.com/thisismeamir/hepsw/internal/index/resolver"
+	"github.com/thisismeamir/hepsw/internal/manifest"
+	"github.com/thisismeamir/hepsw/internal/workspace"
+)
+
+// Node is a package in the build graph
+type Node struct {
+	// ID is the name@version of the package
+	ID       string
+	Name     string
+	Version  string
+	Manifest *manifest.Manifest
+	// SourceDir is the fetched source tree the recipe runs against
+	SourceDir string
+	// Dependencies are the IDs of the nodes that must be built first
+	Dependencies []string
+}
+
+// Graph is a dependency DAG of packages to build
+type Graph struct {
+	nodes map[string]*Node
+	ids   []string
+}
+
+// NewGraph creates an empty build graph
+func NewGraph() *Graph {
+	return &Graph{nodes: make(map[string]*Node)}
+}
+
+// Add adds a node to the graph. Adding a node twice is an error.
+func (g *Graph) Add(node *Node) error {
+	if _, exists := g.nodes[node.ID]; exists {
+		return fmt.Errorf("%s is already in the build graph", node.ID)
+	}
+	g.nodes[node.ID] = node
+	g.ids = append(g.ids, node.ID)
+	return nil
+}
+
+// Node returns the node with the given ID
+func (g *Graph) Node(id string) (*Node, bool) {
+	node, ok := g.nodes[id]
+	return node, ok
+}
+
+// Len returns the number of nodes in the graph
+func (g *Graph) Len() int {
+	return len(g.ids)
+}
+
+// Order returns the nodes in topological order, every node after its
+// dependencies. Dependencies that are not part of the graph are assumed to be
+// available already. Nodes without an ordering constraint keep the order they
+// were added in, so the result is deterministic.
+func (g *Graph) Order() ([]*Node, error) {
+	indegree := make(map[string]int)
+	dependents := g.dependents()
+	for _, id := range g.ids {
+		for _, dep := range g.nodes[id].Dependencies {
+			if _, ok := g.nodes[dep]; ok {
+				indegree[id]++
+			}
+		}
+	}
+
+	position := make(map[string]int)
+	for i, id := range g.ids {
+		position[id] = i
+	}
+
+	ready := make([]string, 0)
+	for _, id := range g.ids {
+		if indegree[id] == 0 {
+			ready = append(ready, id)
+		}
+	}
+
+	order := make([]*Node, 0, len(g.ids))
+	for len(ready) > 0 {
+		id := ready[0]
+		ready = ready[1:]
+		order = append(order, g.nodes[id])
+
+		for _, dependent := range dependents[id] {
+			indegree[dependent]--
+			if indegree[dependent] == 0 {
+				ready = append(ready, dependent)
+				sort.Slice(ready, func(i, j int) bool { return position[ready[i]] < position[ready[j]] })
+			}
+		}
+	}
+
+	if len(order) != len(g.ids) {
+		cyclic := make([]string, 0)
+		for _, id := range g.ids {
+			if indegree[id] > 0 {
+				cyclic = append(cyclic, id)
+			}
+		}
+		return nil, fmt.Errorf("dependency cycle between %s", strings.Join(cyclic, ", "))
+	}
+	return order, nil
+}
+
+// dependents maps each node to the nodes depending on it
+func (g *Graph) dependents() map[string][]string {
+	dependents := make(map[string][]string)
+	for _, id := range g.ids {
+		for _, dep := range g.nodes[id].Dependencies {
+			if _, ok := g.nodes[dep]; ok {
+				dependents[dep] = append(dependents[dep], id)
+			}
+		}
+	}
+	return dependents
+}
+
+// FromPackages builds a graph from fetched packages. A package depends on
+// another one of the list when its manifest names it as a dependency for the
+// given options; other dependencies are expected to be installed already.
+func FromPackages(packages []*workspace.FetchedPackage, options []string) (*Graph, error) {
+	g := NewGraph()
+	byName := make(map[string]string)
+	for _, pkg := range packages {
+		node := &Node{
+			ID:        pkg.Manifest.Name + "@" + pkg.Manifest.Version,
+			Name:      pkg.Manifest.Name,
+			Version:   pkg.Manifest.Version,
+			Manifest:  pkg.Manifest,
+			SourceDir: pkg.BuildFile.Src,
+		}
+		if err := g.Add(node); err != nil {
+			return nil, err
+		}
+		byName[node.Name] = node.ID
+	}
+
+	for _, id := range g.ids {
+		node := g.nodes[id]
+		accessor := manifest.NewManifestAccessor(node.Manifest)
+		for _, dep := range accessor.GetDependenciesForOptions(options) {
+			if depID, ok := byName[dep.Name]; ok && depID != id && !contains(node.Dependencies, depID) {
+				node.Dependencies = append(node.Dependencies, depID)
+			}
+		}
+	}
+	return g, nil
+}
+
+// FromDependencyTree builds a graph from dependency trees resolved from the
+// index, packages shared by several trees are built once. Every package of
+// the trees must have been fetched into the workspace.
+func FromDependencyTree(config *configuration.Configuration, roots ...*resolver.DependencyNode) (*Graph, error) {
+	// The resolver leaves out the version of packages it has seen before,
+	// find the resolved version of each package first.
+	versions := make(map[string]string)
+	var collect func(*resolver.DependencyNode)
+	collect = func(node *resolver.DependencyNode) {
+		if node.Version != "" {
+			if _, ok := versions[node.Package]; !ok {
+				versions[node.Package] = node.Version
+			}
+		}
+		for _, dep := range node.Dependencies {
+			collect(dep)
+		}
+	}
+	for _, root := range roots {
+		collect(root)
+	}
+
+	g := NewGraph()
+	var add func(*resolver.DependencyNode) (string, error)
+	add = func(treeNode *resolver.DependencyNode) (string, error) {
+		version, ok := versions[treeNode.Package]
+		if !ok {
+			return "", fmt.Errorf("%s could not be resolved in the index", treeNode.Package)
+		}
+		id := treeNode.Package + "@" + version
+
+		node, exists := g.nodes[id]
+		if !exists {
+			pkg, err := workspace.Locate(config, id)
+			if err != nil {
+				return "", err
+			}
+			node = &Node{
+				ID:        id,
+				Name:      treeNode.Package,
+				Version:   version,
+				Manifest:  pkg.Manifest,
+				SourceDir: pkg.BuildFile.Src,
+			}
+			if err := g.Add(node); err != nil {
+				return "", err
+			}
+		}
+
+		for _, dep := range treeNode.Dependencies {
+			depID, err := add(dep)
+			if err != nil {
+				return "", err
+			}
+			if !contains(node.Dependencies, depID) {
+				node.Dependencies = append(node.Dependencies, depID)
+			}
+		}
+		return id, nil
+	}
+
+	for _, root := range roots {
+		if _, err := add(root); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+func contains(slice []string, item string) bool {
+	for _, s := range slice {
+		if s == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,187 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Status is the state of a node during a scheduled build
+type Status string
+
+const (
+	StatusRunning Status = "running"
+	StatusBuilt   Status = "built"
+	StatusSkipped Status = "skipped"
+	StatusFailed  Status = "failed"
+)
+
+// BuildFunc builds a single node. It must honour ctx cancellation.
+type BuildFunc func(ctx context.Context, node *Node) error
+
+// Event reports a node changing its status
+type Event struct {
+	Node     *Node
+	Status   Status
+	Reason   string
+	Err      error
+	Duration time.Duration
+}
+
+// Outcome is the final status of a node
+type Outcome struct {
+	Node     *Node
+	Reason   string
+	Err      error
+	Duration time.Duration
+}
+
+// Summary groups the outcome of a scheduled build, each list in build order
+type Summary struct {
+	Built   []Outcome
+	Skipped []Outcome
+	Failed  []Outcome
+}
+
+// Scheduler builds the nodes of a graph concurrently, each one once all its
+// dependencies are built
+type Scheduler struct {
+	// Jobs is the maximum number of packages built at the same time
+	Jobs int
+	// Build builds a single node
+	Build BuildFunc
+	// Notify is called whenever a node changes its status
+	Notify func(Event)
+}
+
+// New creates a scheduler running at most jobs builds at a time
+func New(jobs int, build BuildFunc) *Scheduler {
+	return &Scheduler{Jobs: jobs, Build: build}
+}
+
+type completion struct {
+	node     *Node
+	err      error
+	duration time.Duration
+}
+
+// Run builds the graph. When a node fails, every node depending on it,
+// directly or not, is skipped while unrelated branches keep building. When ctx
+// is cancelled no new build is started and the remaining nodes are skipped.
+// An error is only returned when the graph cannot be ordered.
+func (s *Scheduler) Run(ctx context.Context, g *Graph) (*Summary, error) {
+	order, err := g.Order()
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := s.Jobs
+	if jobs <= 0 {
+		jobs = 1
+	}
+
+	dependents := g.dependents()
+	pending := make(map[string]int)
+	for _, node := range order {
+		for _, dep := range node.Dependencies {
+			if _, ok := g.nodes[dep]; ok {
+				pending[node.ID]++
+			}
+		}
+	}
+
+	outcomes := make(map[string]Outcome)
+	statuses := make(map[string]Status)
+	done := make(chan completion)
+	running := 0
+
+	// skip marks a node and everything depending on it as skipped
+	var skip func(id, reason string)
+	skip = func(id, reason string) {
+		if _, decided := statuses[id]; decided {
+			return
+		}
+		node := g.nodes[id]
+		statuses[id] = StatusSkipped
+		outcomes[id] = Outcome{Node: node, Reason: reason}
+		s.notify(Event{Node: node, Status: StatusSkipped, Reason: reason})
+		for _, dependent := range dependents[id] {
+			skip(dependent, fmt.Sprintf("dependency %s was not built", id))
+		}
+	}
+
+	start := func() {
+		for _, node := range order {
+			if running >= jobs {
+				return
+			}
+			if _, decided := statuses[node.ID]; decided || pending[node.ID] > 0 {
+				continue
+			}
+			if ctx.Err() != nil {
+				return
+			}
+
+			statuses[node.ID] = StatusRunning
+			running++
+			s.notify(Event{Node: node, Status: StatusRunning})
+			go func(node *Node) {
+				began := time.Now()
+				err := s.Build(ctx, node)
+				done <- completion{node: node, err: err, duration: time.Since(began)}
+			}(node)
+		}
+	}
+
+	start()
+	for running > 0 {
+		c := <-done
+		running--
+		id := c.node.ID
+
+		if c.err != nil {
+			statuses[id] = StatusFailed
+			outcomes[id] = Outcome{Node: c.node, Err: c.err, Duration: c.duration}
+			s.notify(Event{Node: c.node, Status: StatusFailed, Err: c.err, Duration: c.duration})
+			for _, dependent := range dependents[id] {
+				skip(dependent, fmt.Sprintf("dependency %s failed", id))
+			}
+		} else {
+			statuses[id] = StatusBuilt
+			outcomes[id] = Outcome{Node: c.node, Duration: c.duration}
+			s.notify(Event{Node: c.node, Status: StatusBuilt, Duration: c.duration})
+			for _, dependent := range dependents[id] {
+				pending[dependent]--
+			}
+		}
+
+		start()
+	}
+
+	// Only a cancelled context leaves nodes undecided
+	for _, node := range order {
+		if _, decided := statuses[node.ID]; !decided {
+			skip(node.ID, "build was cancelled")
+		}
+	}
+
+	summary := &Summary{}
+	for _, node := range order {
+		outcome := outcomes[node.ID]
+		switch statuses[node.ID] {
+		case StatusBuilt:
+			summary.Built = append(summary.Built, outcome)
+		case StatusFailed:
+			summary.Failed = append(summary.Failed, outcome)
+		default:
+			summary.Skipped = append(summary.Skipped, outcome)
+		}
+	}
+	return summary, nil
+}
+
+func (s *Scheduler) notify(event Event) {
+	if s.Notify != nil {
+		s.Notify(event)
+	}
+}
@@ -0,0 +1,174 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/thisismeamir/hepsw/internal/configuration"
+	"github.com/thisismeamir/hepsw/internal/index/resolver"
+	"github.com/thisismeamir/hepsw/internal/manifest"
+	"github.com/thisismeamir/hepsw/internal/manifest/loader"
+	"github.com/thisismeamir/hepsw/internal/workspace"
+)
+
+func buildGraph(t *testing.T, edges map[string][]string, ids ...string) *Graph {
+	t.Helper()
+	g := NewGraph()
+	for _, id := range ids {
+		if err := g.Add(&Node{ID: id, Name: id, Dependencies: edges[id]}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return g
+}
+
+func TestOrder(t *testing.T) {
+	g := buildGraph(t, map[string][]string{
+		"app":    {"root", "geant4"},
+		"root":   {"python"},
+		"geant4": {"clhep"},
+	}, "app", "root", "geant4", "python", "clhep")
+
+	order, err := g.Order()
+	if err != nil {
+		t.Fatal(err)
+	}
+	position := make(map[string]int)
+	for i, node := range order {
+		position[node.ID] = i
+	}
+	for id, deps := range map[string][]string{"app": {"root", "geant4"}, "root": {"python"}, "geant4": {"clhep"}} {
+		for _, dep := range deps {
+			if position[dep] > position[id] {
+				t.Errorf("%s is ordered before its dependency %s", id, dep)
+			}
+		}
+	}
+
+	cyclic := buildGraph(t, map[string][]string{"a": {"b"}, "b": {"a"}}, "a", "b")
+	if _, err := cyclic.Order(); err == nil {
+		t.Error("expected a cycle error")
+	}
+}
+
+func TestFromDependencyTree(t *testing.T) {
+	workspaceDir := t.TempDir()
+	config := &configuration.Configuration{Workspace: workspaceDir, Sources: filepath.Join(workspaceDir, "sources")}
+	for _, id := range []string{"geant4@11.2.0", "clhep@2.4.7", "xerces@3.2.5", "app@1.0.0"} {
+		name, version := workspace.ParseReference(id)
+		root := workspace.SourceRoot(config, name, version)
+		if err := os.MkdirAll(root, 0755); err != nil {
+			t.Fatal(err)
+		}
+		manifestPath := filepath.Join(root, workspace.ManifestFileName)
+		if err := loader.SaveManifest(&manifest.Manifest{Name: name, Version: version}, manifestPath); err != nil {
+			t.Fatal(err)
+		}
+		if err := workspace.WriteBuildFile(filepath.Join(root, workspace.BuildFileName), &workspace.BuildFile{
+			Name: name, Version: version, Manifest: manifestPath, Src: filepath.Join(root, "src"),
+		}); err != nil {
+			t.Fatal(err)
+		}
+		config.RecordSource(configuration.WorkspaceSourceState{SourceId: id, Name: name, Version: version, Path: root})
+	}
+
+	// The resolver only gives the version of a package the first time it
+	// meets it
+	geant4 := &resolver.DependencyNode{Package: "geant4", Version: "11.2.0", Dependencies: []*resolver.DependencyNode{
+		{Package: "clhep", Version: "2.4.7"},
+		{Package: "xerces", Version: "3.2.5", Dependencies: []*resolver.DependencyNode{{Package: "clhep"}}},
+	}}
+	app := &resolver.DependencyNode{Package: "app", Version: "1.0.0", Dependencies: []*resolver.DependencyNode{{Package: "clhep"}}}
+
+	g, err := FromDependencyTree(config, geant4, app)
+	if err != nil {
+		t.Fatalf("FromDependencyTree failed: %v", err)
+	}
+	if g.Len() != 4 {
+		t.Errorf("expected every package once, got %d nodes", g.Len())
+	}
+	xerces, _ := g.Node("xerces@3.2.5")
+	if xerces == nil || len(xerces.Dependencies) != 1 || xerces.Dependencies[0] != "clhep@2.4.7" {
+		t.Errorf("expected xerces to depend on the resolved clhep, got %+v", xerces)
+	}
+	if node, _ := g.Node("app@1.0.0"); node == nil || node.Manifest == nil || node.SourceDir == "" {
+		t.Errorf("expected app to be located in the workspace, got %+v", node)
+	}
+	if _, err := g.Order(); err != nil {
+		t.Error(err)
+	}
+
+	missing := &resolver.DependencyNode{Package: "app", Version: "1.0.0", Dependencies: []*resolver.DependencyNode{{Package: "root", Version: "6.30.02"}}}
+	if _, err := FromDependencyTree(config, missing); err == nil {
+		t.Error("expected a package that is not fetched to be an error")
+	}
+}
+
+func TestRunSkipsDependentsOfFailures(t *testing.T) {
+	// clhep fails: geant4 and app are skipped, python/root build anyway
+	g := buildGraph(t, map[string][]string{
+		"app":    {"root", "geant4"},
+		"root":   {"python"},
+		"geant4": {"clhep"},
+	}, "app", "root", "geant4", "python", "clhep")
+
+	var mu sync.Mutex
+	built := make(map[string]bool)
+	var active, peak atomic.Int32
+
+	s := New(2, func(ctx context.Context, node *Node) error {
+		n := active.Add(1)
+		defer active.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		mu.Lock()
+		defer mu.Unlock()
+		for _, dep := range node.Dependencies {
+			if !built[dep] {
+				return fmt.Errorf("%s built before %s", node.ID, dep)
+			}
+		}
+		if node.ID == "clhep" {
+			return fmt.Errorf("compiler error")
+		}
+		built[node.ID] = true
+		return nil
+	})
+
+	summary, err := s.Run(context.Background(), g)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := func(outcomes []Outcome) []string {
+		var result []string
+		for _, o := range outcomes {
+			result = append(result, o.Node.ID)
+		}
+		return result
+	}
+	if got := ids(summary.Built); fmt.Sprint(got) != "[python root]" {
+		t.Errorf("built = %v", got)
+	}
+	if got := ids(summary.Failed); fmt.Sprint(got) != "[clhep]" {
+		t.Errorf("failed = %v", got)
+	}
+	if got := ids(summary.Skipped); len(got) != 2 {
+		t.Errorf("skipped = %v, want geant4 and app", got)
+	}
+	if peak.Load() > 2 {
+		t.Errorf("%d builds ran at once, the limit is 2", peak.Load())
+	}
+}
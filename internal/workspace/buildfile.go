@@ -0,0 +1,54 @@
+package workspace
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// BuildFile is the build.yml generated next to a fetched source. It tells the
+// build process where the source and the manifest live, so a build can be
+// delayed (or repeated) without consulting the index again.
+type BuildFile struct {
+	Name       string   `yaml:"name"`
+	Version    string   `yaml:"version"`
+	Src        string   `yaml:"src"`
+	Manifest   string   `yaml:"manifest"`
+	SourceType string   `yaml:"sourceType"`
+	SourceUrl  string   `yaml:"sourceUrl"`
+	SourceTag  string   `yaml:"sourceTag,omitempty"`
+	Commit     string   `yaml:"commit,omitempty"`
+	Patches    []string `yaml:"patches,omitempty"`
+	FetchedAt  string   `yaml:"fetchedAt"`
+	ThirdParty bool     `yaml:"third-party"`
+}
+
+// WriteBuildFile writes a build.yml to the given path
+func WriteBuildFile(path string, bf *BuildFile) error {
+	data, err := yaml.Marshal(bf)
+	if err != nil {
+		return fmt.Errorf("failed to marshal build file: %w", err)
+	}
+
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write build file: %w", err)
+	}
+
+	return nil
+}
+
+// ReadBuildFile reads a build.yml from the given path
+func ReadBuildFile(path string) (*BuildFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read build file: %w", err)
+	}
+
+	bf := &BuildFile{}
+	if err := yaml.Unmarshal(data, bf); err != nil {
+		return nil, fmt.Errorf("failed to parse build file: %w", err)
+	}
+
+	return bf, nil
+}
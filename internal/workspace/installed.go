@@ -0,0 +1,282 @@
+package workspace
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileListName is the file at the root of an install prefix listing the files
+// the install put there
+const FileListName = ".hepsw-files.yml"
+
+// InstalledFile is a file, or symbolic link, written by an install. Paths are
+// relative to the install prefix.
+type InstalledFile struct {
+	Path   string `yaml:"path"`
+	Size   int64  `yaml:"size"`
+	SHA256 string `yaml:"sha256,omitempty"`
+	// Link is the target of a symbolic link
+	Link string `yaml:"link,omitempty"`
+}
+
+// ScanInstalledFiles lists the files and symbolic links below an install
+// prefix with their size and hash, in path order. The file list itself is not
+// part of the result.
+func ScanInstalledFiles(prefix string) ([]InstalledFile, error) {
+	files := make([]InstalledFile, 0)
+	err := filepath.WalkDir(prefix, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(prefix, path)
+		if err != nil {
+			return err
+		}
+		if rel == FileListName {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		file := InstalledFile{Path: filepath.ToSlash(rel), Size: info.Size()}
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			if file.Link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		case info.Mode().IsRegular():
+			if file.SHA256, err = hashFile(path); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+		files = append(files, file)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan installed files: %w", err)
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
+}
+
+// WriteFileList writes the file list of an install prefix
+func WriteFileList(prefix string, files []InstalledFile) error {
+	data, err := yaml.Marshal(files)
+	if err != nil {
+		return fmt.Errorf("failed to marshal file list: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(prefix, FileListName), data, 0644); err != nil {
+		return fmt.Errorf("failed to write file list: %w", err)
+	}
+	return nil
+}
+
+// ReadFileList reads the file list of an install prefix
+func ReadFileList(prefix string) ([]InstalledFile, error) {
+	data, err := os.ReadFile(filepath.Join(prefix, FileListName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file list: %w", err)
+	}
+	files := make([]InstalledFile, 0)
+	if err := yaml.Unmarshal(data, &files); err != nil {
+		return nil, fmt.Errorf("failed to parse file list: %w", err)
+	}
+	return files, nil
+}
+
+// TotalSize is the sum of the sizes of the files
+func TotalSize(files []InstalledFile) int64 {
+	var size int64
+	for _, file := range files {
+		size += file.Size
+	}
+	return size
+}
+
+// FileChanges reports how an install prefix differs from its file list
+type FileChanges struct {
+	// Missing are listed files that are gone
+	Missing []string
+	// Modified are listed files whose content or link target changed
+	Modified []string
+}
+
+// CheckInstalledFiles compares the files of an install prefix with its file
+// list
+func CheckInstalledFiles(prefix string) (*FileChanges, error) {
+	files, err := ReadFileList(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := &FileChanges{Missing: []string{}, Modified: []string{}}
+	for _, file := range files {
+		path := filepath.Join(prefix, filepath.FromSlash(file.Path))
+		info, err := os.Lstat(path)
+		if os.IsNotExist(err) {
+			changes.Missing = append(changes.Missing, file.Path)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to inspect %s: %w", file.Path, err)
+		}
+
+		switch {
+		case file.Link != "":
+			if target, err := os.Readlink(path); err != nil || target != file.Link {
+				changes.Modified = append(changes.Modified, file.Path)
+			}
+		case file.SHA256 != "" && info.Mode().IsRegular():
+			if hash, err := hashFile(path); err != nil || hash != file.SHA256 {
+				changes.Modified = append(changes.Modified, file.Path)
+			}
+		}
+	}
+	return changes, nil
+}
+
+// throughSymlink reports whether a parent directory of rel below the prefix
+// is a symlink, removing rel would then remove whatever the link points to
+func throughSymlink(prefix, rel string) bool {
+	dir := prefix
+	for _, part := range strings.Split(filepath.Dir(rel), string(filepath.Separator)) {
+		if part == "." {
+			break
+		}
+		dir = filepath.Join(dir, part)
+		info, err := os.Lstat(dir)
+		if err != nil {
+			return false
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// RemovedFiles reports what an uninstall did
+type RemovedFiles struct {
+	// Removed is the number of listed files that were removed
+	Removed int
+	// Missing are listed files that were already gone
+	Missing []string
+	// Modified are listed files whose content changed since the install,
+	// they are removed all the same
+	Modified []string
+	// Kept are files of the prefix that the install did not write, they are
+	// left in place together with their directories
+	Kept []string
+	// Outside are listed paths that are absolute, leave the prefix or go
+	// through a symlinked directory, they are never removed
+	Outside []string
+}
+
+// RemoveInstalledFiles removes the files listed for an install prefix, then
+// the directories left empty and the file list. The prefix itself is removed
+// when nothing else remains in it.
+func RemoveInstalledFiles(prefix string) (*RemovedFiles, error) {
+	files, err := ReadFileList(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &RemovedFiles{Missing: []string{}, Modified: []string{}, Kept: []string{}, Outside: []string{}}
+	dirs := make(map[string]bool)
+	for _, file := range files {
+		path := filepath.Join(prefix, filepath.FromSlash(file.Path))
+		rel, err := filepath.Rel(prefix, path)
+		if filepath.IsAbs(file.Path) || err != nil || rel == "." || rel == ".." ||
+			strings.HasPrefix(rel, ".."+string(filepath.Separator)) || throughSymlink(prefix, rel) {
+			result.Outside = append(result.Outside, file.Path)
+			continue
+		}
+		for dir := filepath.Dir(path); dir != prefix && dir != "." && dir != "/"; dir = filepath.Dir(dir) {
+			dirs[dir] = true
+		}
+
+		info, err := os.Lstat(path)
+		if os.IsNotExist(err) {
+			result.Missing = append(result.Missing, file.Path)
+			continue
+		}
+		if err != nil {
+			return result, fmt.Errorf("failed to inspect %s: %w", file.Path, err)
+		}
+		if file.SHA256 != "" && info.Mode().IsRegular() {
+			if hash, err := hashFile(path); err == nil && hash != file.SHA256 {
+				result.Modified = append(result.Modified, file.Path)
+			}
+		}
+		if err := os.Remove(path); err != nil {
+			return result, fmt.Errorf("failed to remove %s: %w", file.Path, err)
+		}
+		result.Removed++
+	}
+
+	// Deepest directories first, so parents are empty by the time they are
+	// removed
+	sorted := make([]string, 0, len(dirs))
+	for dir := range dirs {
+		sorted = append(sorted, dir)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+	for _, dir := range sorted {
+		_ = os.Remove(dir)
+	}
+
+	if err := os.Remove(filepath.Join(prefix, FileListName)); err != nil {
+		return result, fmt.Errorf("failed to remove file list: %w", err)
+	}
+
+	err = filepath.WalkDir(prefix, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			rel, _ := filepath.Rel(prefix, path)
+			result.Kept = append(result.Kept, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		return result, fmt.Errorf("failed to inspect %s: %w", prefix, err)
+	}
+	if len(result.Kept) == 0 {
+		if err := os.RemoveAll(prefix); err != nil {
+			return result, fmt.Errorf("failed to remove %s: %w", prefix, err)
+		}
+	}
+	return result, nil
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,122 @@
+package workspace
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRemoveInstalledFiles(t *testing.T) {
+	prefix := filepath.Join(t.TempDir(), "hello", "1.0.0")
+	for path, content := range map[string]string{
+		"bin/hello":         "binary",
+		"lib/libhello.so.1": "library",
+		"share/doc/README":  "docs",
+	} {
+		full := filepath.Join(prefix, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("libhello.so.1", filepath.Join(prefix, "lib", "libhello.so")); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := ScanInstalledFiles(prefix)
+	if err != nil {
+		t.Fatalf("ScanInstalledFiles failed: %v", err)
+	}
+	if len(files) != 4 || files[0].Path != "bin/hello" || files[0].Size != 6 || files[0].SHA256 == "" {
+		t.Fatalf("unexpected file list: %+v", files)
+	}
+	if files[1].Path != "lib/libhello.so" || files[1].Link != "libhello.so.1" {
+		t.Errorf("expected the symbolic link to be recorded, got %+v", files[1])
+	}
+	if err := WriteFileList(prefix, files); err != nil {
+		t.Fatal(err)
+	}
+
+	// A file added after the install survives, a changed one is reported
+	if err := os.WriteFile(filepath.Join(prefix, "share", "local.conf"), []byte("mine"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(prefix, "bin", "hello"), []byte("patched"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := RemoveInstalledFiles(prefix)
+	if err != nil {
+		t.Fatalf("RemoveInstalledFiles failed: %v", err)
+	}
+	if removed.Removed != 4 || len(removed.Modified) != 1 || len(removed.Kept) != 1 {
+		t.Errorf("unexpected result: %+v", removed)
+	}
+	for _, path := range []string{"bin", "lib", "share/doc"} {
+		if _, err := os.Stat(filepath.Join(prefix, path)); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed", path)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(prefix, "share", "local.conf")); err != nil {
+		t.Errorf("unlisted file was removed: %v", err)
+	}
+
+	if err := os.Remove(filepath.Join(prefix, "share", "local.conf")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := WriteFileList(prefix, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RemoveInstalledFiles(prefix); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(prefix); !os.IsNotExist(err) {
+		t.Error("expected the empty prefix to be removed")
+	}
+
+	// A tampered list cannot reach outside of the prefix
+	if err := os.MkdirAll(prefix, 0755); err != nil {
+		t.Fatal(err)
+	}
+	victim := filepath.Join(filepath.Dir(prefix), "victim")
+	if err := os.WriteFile(victim, []byte("precious"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFileList(prefix, []InstalledFile{{Path: "../victim"}, {Path: victim}, {Path: "."}}); err != nil {
+		t.Fatal(err)
+	}
+	removed, err = RemoveInstalledFiles(prefix)
+	if err != nil {
+		t.Fatalf("RemoveInstalledFiles failed: %v", err)
+	}
+	if removed.Removed != 0 || len(removed.Outside) != 3 {
+		t.Errorf("expected every path to be refused, got %+v", removed)
+	}
+	if _, err := os.Stat(victim); err != nil {
+		t.Errorf("a file outside of the prefix was removed: %v", err)
+	}
+
+	// Nor through a directory replaced by a symlink
+	if err := os.MkdirAll(prefix, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("..", filepath.Join(prefix, "lib")); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFileList(prefix, []InstalledFile{{Path: "lib/victim"}}); err != nil {
+		t.Fatal(err)
+	}
+	removed, err = RemoveInstalledFiles(prefix)
+	if err != nil {
+		t.Fatalf("RemoveInstalledFiles failed: %v", err)
+	}
+	if removed.Removed != 0 || len(removed.Outside) != 1 {
+		t.Errorf("expected the path through the symlink to be refused, got %+v", removed)
+	}
+	if _, err := os.Stat(victim); err != nil {
+		t.Errorf("a file was removed through a symlinked directory: %v", err)
+	}
+}
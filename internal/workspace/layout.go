@@ -0,0 +1,58 @@
+package workspace
+
+import (
+	"path/filepath"
+
+	"github.com/thisismeamir/hepsw/internal/configuration"
+)
+
+// Layout of a fetched package inside the workspace:
+//
+//	<sources>/<name>/<version>/
+//	├── src/            the fetched source tree
+//	├── manifest.yaml   the manifest the source was fetched with
+//	└── build.yml       the build description consumed by hepsw build
+//
+// Third-party packages imported from a local manifest use the same layout
+// under <thirdparty>/<name>/<version>/.
+
+const (
+	ManifestFileName = "manifest.yaml"
+	BuildFileName    = "build.yml"
+	SourceDirName    = "src"
+)
+
+// SourceRoot returns the directory holding everything fetched for a package version
+func SourceRoot(config *configuration.Configuration, name, version string) string {
+	return filepath.Join(config.Sources, name, version)
+}
+
+// ThirdPartyRoot returns the directory holding an imported third-party package version
+func ThirdPartyRoot(config *configuration.Configuration, name, version string) string {
+	return filepath.Join(config.ThirdPartyDir(), name, version)
+}
+
+// SourceDir returns the default location of the fetched source tree
+func SourceDir(config *configuration.Configuration, name, version string) string {
+	return filepath.Join(SourceRoot(config, name, version), SourceDirName)
+}
+
+// ManifestPath returns the location of the manifest stored beside the source
+func ManifestPath(config *configuration.Configuration, name, version string) string {
+	return filepath.Join(SourceRoot(config, name, version), ManifestFileName)
+}
+
+// BuildFilePath returns the location of the build.yml of a package version
+func BuildFilePath(config *configuration.Configuration, name, version string) string {
+	return filepath.Join(SourceRoot(config, name, version), BuildFileName)
+}
+
+// BuildDir returns the build directory of a package version
+func BuildDir(config *configuration.Configuration, name, version string) string {
+	return filepath.Join(config.Builds, name, version)
+}
+
+// InstallDir returns the install prefix of a package version
+func InstallDir(config *configuration.Configuration, name, version string) string {
+	return filepath.Join(config.Installs, name, version)
+}
@@ -0,0 +1,145 @@
+package workspace
+
+import (
+	"os"
+	"sort"
+
+	"github.com/thisismeamir/hepsw/internal/configuration"
+	"github.com/thisismeamir/hepsw/internal/manifest"
+	"github.com/thisismeamir/hepsw/internal/relocate"
+)
+
+// LinkedDependency is a workspace package an install is linked against
+type LinkedDependency struct {
+	Name    string
+	Version string
+	// Libraries are the DT_NEEDED libraries of the install it provides
+	Libraries []string
+	// BuildOnly is set when the manifest declares it as a build dependency
+	// but not as a runtime one
+	BuildOnly bool
+}
+
+// RuntimeLinkage compares the runtime dependencies declared by a manifest
+// with the workspace packages its install is linked against
+type RuntimeLinkage struct {
+	// Linked are the packages providing needed libraries
+	Linked []LinkedDependency
+	// Undeclared are linked packages that are not runtime dependencies
+	Undeclared []LinkedDependency
+	// Unused are runtime dependencies installed with shared libraries, none
+	// of which the install is linked against
+	Unused []manifest.Dependency
+	// Unresolved are needed libraries no workspace package provides, they are
+	// expected from the system
+	Unresolved []string
+}
+
+// CheckRuntimeLinkage resolves the DT_NEEDED libraries of an install against
+// the install prefixes of the other installed packages. Runtime dependencies
+// are the ones of the manifest enabled by the options of the install.
+func CheckRuntimeLinkage(config *configuration.Configuration, m *manifest.Manifest, pkg configuration.WorkspacePackageState) (*RuntimeLinkage, error) {
+	needed, err := relocate.NeededLibraries(pkg.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	providers, libraries := libraryProviders(config, m.Name)
+
+	declared := make(map[string]manifest.Dependency)
+	for _, dep := range manifest.NewManifestAccessor(m).GetRuntimeDependenciesForOptions(pkg.Options) {
+		declared[dep.Name] = dep
+	}
+	buildOnly := make(map[string]bool)
+	for _, dep := range m.Specifications.Build.Dependencies {
+		if _, ok := declared[dep.Name]; !ok {
+			buildOnly[dep.Name] = true
+		}
+	}
+
+	linkage := &RuntimeLinkage{
+		Linked:     []LinkedDependency{},
+		Undeclared: []LinkedDependency{},
+		Unused:     []manifest.Dependency{},
+		Unresolved: []string{},
+	}
+	linked := make(map[string]*LinkedDependency)
+	for library := range needed {
+		provider, ok := providers[library]
+		if !ok {
+			linkage.Unresolved = append(linkage.Unresolved, library)
+			continue
+		}
+		if linked[provider.Name] == nil {
+			linked[provider.Name] = &LinkedDependency{
+				Name:      provider.Name,
+				Version:   provider.Version,
+				Libraries: []string{},
+				BuildOnly: buildOnly[provider.Name],
+			}
+		}
+		linked[provider.Name].Libraries = append(linked[provider.Name].Libraries, library)
+	}
+	sort.Strings(linkage.Unresolved)
+
+	names := make([]string, 0, len(linked))
+	for name := range linked {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		dep := linked[name]
+		sort.Strings(dep.Libraries)
+		linkage.Linked = append(linkage.Linked, *dep)
+		if _, ok := declared[name]; !ok {
+			linkage.Undeclared = append(linkage.Undeclared, *dep)
+		}
+	}
+
+	// Dependencies without shared libraries in the workspace may be needed
+	// for anything else, like data or executables
+	for _, dep := range m.Specifications.Runtime.Dependencies {
+		if _, ok := declared[dep.Name]; !ok || linked[dep.Name] != nil || !libraries[dep.Name] {
+			continue
+		}
+		linkage.Unused = append(linkage.Unused, dep)
+	}
+	return linkage, nil
+}
+
+// libraryProviders maps the shared libraries of the installed packages, other
+// than the named one, to the packages providing them. Default installs are
+// preferred over variants. The names of the packages that provide shared
+// libraries are returned as well.
+func libraryProviders(config *configuration.Configuration, exclude string) (map[string]configuration.WorkspacePackageState, map[string]bool) {
+	packages := make([]configuration.WorkspacePackageState, 0, len(config.State.Packages))
+	for _, pkg := range config.State.Packages {
+		if pkg.Name != exclude {
+			packages = append(packages, pkg)
+		}
+	}
+	sort.SliceStable(packages, func(i, j int) bool {
+		return packages[i].Variant == "" && packages[j].Variant != ""
+	})
+
+	providers := make(map[string]configuration.WorkspacePackageState)
+	libraries := make(map[string]bool)
+	for _, pkg := range packages {
+		if _, err := os.Stat(pkg.Path); err != nil {
+			continue
+		}
+		provided, err := relocate.SharedLibraries(pkg.Path)
+		if err != nil {
+			continue
+		}
+		for _, library := range provided {
+			if _, ok := providers[library]; !ok {
+				providers[library] = pkg
+			}
+		}
+		if len(provided) > 0 {
+			libraries[pkg.Name] = true
+		}
+	}
+	return providers, libraries
+}
@@ -0,0 +1,63 @@
+package workspace
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/thisismeamir/hepsw/internal/configuration"
+	"github.com/thisismeamir/hepsw/internal/manifest"
+)
+
+func TestCheckRuntimeLinkage(t *testing.T) {
+	// Any dynamically linked system binary links against the C library
+	binary, err := os.ReadFile("/bin/true")
+	if err != nil {
+		t.Skipf("no binary to inspect: %v", err)
+	}
+
+	root := t.TempDir()
+	config := &configuration.Configuration{Workspace: root, Installs: filepath.Join(root, "installs")}
+	install := func(name string, files map[string][]byte) configuration.WorkspacePackageState {
+		pkg := configuration.WorkspacePackageState{
+			PackageId: name + "@1.0", Name: name, Version: "1.0", Path: InstallDir(config, name, "1.0"),
+		}
+		for path, content := range files {
+			full := filepath.Join(pkg.Path, path)
+			if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(full, content, 0755); err != nil {
+				t.Fatal(err)
+			}
+		}
+		config.RecordPackage(pkg)
+		return pkg
+	}
+
+	app := install("app", map[string][]byte{"bin/app": binary})
+	install("libc", map[string][]byte{"lib/libc.so.6": []byte("stand-in")})
+	install("other", map[string][]byte{"lib/libother.so": []byte("stand-in")})
+	install("data", map[string][]byte{"share/data.txt": []byte("stand-in")})
+
+	m := &manifest.Manifest{Name: "app", Version: "1.0"}
+	m.Specifications.Build.Dependencies = []manifest.Dependency{{Name: "libc"}}
+	m.Specifications.Runtime.Dependencies = []manifest.Dependency{
+		{Name: "other"}, {Name: "data"}, {Name: "optional", ForOptions: []string{"with-optional"}},
+	}
+
+	linkage, err := CheckRuntimeLinkage(config, m, app)
+	if err != nil {
+		t.Fatalf("CheckRuntimeLinkage failed: %v", err)
+	}
+	if len(linkage.Linked) == 0 {
+		t.Skip("/bin/true is not linked against libc.so.6")
+	}
+	if len(linkage.Undeclared) != 1 || linkage.Undeclared[0].Name != "libc" || !linkage.Undeclared[0].BuildOnly {
+		t.Errorf("expected libc to be an undeclared build-only dependency, got %+v", linkage.Undeclared)
+	}
+	// data provides no library, so it cannot be judged
+	if len(linkage.Unused) != 1 || linkage.Unused[0].Name != "other" {
+		t.Errorf("expected other to be unused, got %+v", linkage.Unused)
+	}
+}
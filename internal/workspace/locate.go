@@ -0,0 +1,66 @@
+package workspace
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/thisismeamir/hepsw/internal/configuration"
+	"github.com/thisismeamir/hepsw/internal/manifest"
+	"github.com/thisismeamir/hepsw/internal/manifest/loader"
+)
+
+// FetchedPackage is a package whose source is present in the workspace
+type FetchedPackage struct {
+	Manifest  *manifest.Manifest
+	BuildFile *BuildFile
+}
+
+// ParseReference splits a name[@version] reference. The version is empty when
+// it is not given.
+func ParseReference(reference string) (string, string) {
+	name, version, _ := strings.Cut(reference, "@")
+	if version == "latest" {
+		version = ""
+	}
+	return name, version
+}
+
+// Locate finds a fetched package by a name[@version] reference. Without a
+// version the most recently recorded source of that package is used. Packages
+// requested by name are found even if they are third-party imports.
+func Locate(config *configuration.Configuration, reference string) (*FetchedPackage, error) {
+	name, version := ParseReference(reference)
+
+	if version == "" {
+		for _, source := range config.State.Sources {
+			if source.Name == name {
+				version = source.Version
+			}
+		}
+		if version == "" {
+			return nil, fmt.Errorf("%s has not been fetched, run 'hepsw fetch %s' first", name, name)
+		}
+	}
+
+	buildFilePath := BuildFilePath(config, name, version)
+	if source, ok := config.FindSource(name, version); ok && source.Path != "" {
+		buildFilePath = filepath.Join(source.Path, BuildFileName)
+	}
+	if _, err := os.Stat(buildFilePath); os.IsNotExist(err) {
+		return nil, fmt.Errorf("%s@%s has not been fetched, run 'hepsw fetch %s@%s' first", name, version, name, version)
+	}
+
+	buildFile, err := ReadBuildFile(buildFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := loader.ReadManifest(buildFile.Manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FetchedPackage{Manifest: m, BuildFile: buildFile}, nil
+}
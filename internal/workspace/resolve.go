@@ -0,0 +1,84 @@
+package workspace
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/thisismeamir/hepsw/internal/configuration"
+	"github.com/thisismeamir/hepsw/internal/manifest"
+)
+
+// ErrThirdParty is returned when a dependency is only available as a
+// third-party package and third-party packages are not allowed
+var ErrThirdParty = errors.New("only available as a third-party package")
+
+// ResolveOptions controls which fetched packages may satisfy a dependency
+type ResolveOptions struct {
+	// AllowThirdParty lets imported third-party packages satisfy dependencies.
+	// Third-party packages are always found when requested by name with Locate.
+	AllowThirdParty bool
+}
+
+// ResolveDependency finds the fetched package satisfying a dependency. An
+// exact version must match, otherwise the most recently fetched version is
+// used. Third-party packages are skipped unless opts allows them.
+func ResolveDependency(config *configuration.Configuration, dep manifest.Dependency, opts ResolveOptions) (*FetchedPackage, error) {
+	var match *configuration.WorkspaceSourceState
+	skippedThirdParty := false
+
+	for i := range config.State.Sources {
+		source := &config.State.Sources[i]
+		if source.Name != dep.Name || !versionMatches(dep.Version, source.Version) {
+			continue
+		}
+		if source.ThirdParty && !opts.AllowThirdParty {
+			skippedThirdParty = true
+			continue
+		}
+		match = source
+	}
+
+	if match == nil {
+		if skippedThirdParty {
+			return nil, fmt.Errorf("%s is %w", dep.Name, ErrThirdParty)
+		}
+		return nil, fmt.Errorf("%s has not been fetched", dep.Name)
+	}
+	return Locate(config, match.Name+"@"+match.Version)
+}
+
+// ResolveDependencies resolves the dependencies of a manifest enabled by the
+// given options against the workspace. Required dependencies that cannot be
+// resolved are returned with the reason, optional ones are left out.
+func ResolveDependencies(config *configuration.Configuration, m *manifest.Manifest, options []string, opts ResolveOptions) ([]*FetchedPackage, map[string]error) {
+	resolved := make([]*FetchedPackage, 0)
+	missing := make(map[string]error)
+	seen := make(map[string]bool)
+
+	for _, dep := range manifest.NewManifestAccessor(m).GetDependenciesForOptions(options) {
+		if seen[dep.Name] {
+			continue
+		}
+		seen[dep.Name] = true
+
+		pkg, err := ResolveDependency(config, dep, opts)
+		if err != nil {
+			if !dep.IsOptional {
+				missing[dep.Name] = err
+			}
+			continue
+		}
+		resolved = append(resolved, pkg)
+	}
+	return resolved, missing
+}
+
+// versionMatches reports whether a fetched version satisfies the version of a
+// dependency. Only exact versions are enforced, ranges accept any version.
+func versionMatches(want, have string) bool {
+	if want == "" || want == "latest" || strings.ContainsAny(want, "<>=~^*,| ") {
+		return true
+	}
+	return want == have
+}
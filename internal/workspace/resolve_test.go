@@ -0,0 +1,69 @@
+package workspace
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/thisismeamir/hepsw/internal/configuration"
+	"github.com/thisismeamir/hepsw/internal/manifest"
+	"github.com/thisismeamir/hepsw/internal/manifest/loader"
+)
+
+// addFetched writes the manifest and build.yml of a package and records it
+func addFetched(t *testing.T, config *configuration.Configuration, name, version string, thirdParty bool) {
+	t.Helper()
+	root := SourceRoot(config, name, version)
+	if thirdParty {
+		root = ThirdPartyRoot(config, name, version)
+	}
+
+	if err := os.MkdirAll(root, 0755); err != nil {
+		t.Fatal(err)
+	}
+	m := &manifest.Manifest{Name: name, Version: version}
+	manifestPath := filepath.Join(root, ManifestFileName)
+	if err := loader.SaveManifest(m, manifestPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteBuildFile(filepath.Join(root, BuildFileName), &BuildFile{
+		Name: name, Version: version, Manifest: manifestPath, ThirdParty: thirdParty,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	config.RecordSource(configuration.WorkspaceSourceState{
+		SourceId: name + "@" + version, Name: name, Version: version, Path: root, ThirdParty: thirdParty,
+	})
+}
+
+func TestResolveDependencyThirdParty(t *testing.T) {
+	workspaceDir := t.TempDir()
+	config := &configuration.Configuration{
+		Workspace:  workspaceDir,
+		Sources:    filepath.Join(workspaceDir, "sources"),
+		Thirdparty: filepath.Join(workspaceDir, "thirdparty"),
+	}
+	addFetched(t, config, "clhep", "2.4.7", false)
+	addFetched(t, config, "mylib", "0.1.0", true)
+
+	if pkg, err := ResolveDependency(config, manifest.Dependency{Name: "clhep", Version: "2.4.7"}, ResolveOptions{}); err != nil || pkg.Manifest.Name != "clhep" {
+		t.Fatalf("clhep was not resolved: %v", err)
+	}
+	if _, err := ResolveDependency(config, manifest.Dependency{Name: "clhep", Version: "2.4.6"}, ResolveOptions{}); err == nil {
+		t.Error("an exact version mismatch was accepted")
+	}
+
+	_, err := ResolveDependency(config, manifest.Dependency{Name: "mylib"}, ResolveOptions{})
+	if !errors.Is(err, ErrThirdParty) {
+		t.Errorf("third-party package was used without being allowed: %v", err)
+	}
+	if _, err := ResolveDependency(config, manifest.Dependency{Name: "mylib"}, ResolveOptions{AllowThirdParty: true}); err != nil {
+		t.Errorf("third-party package was not resolved when allowed: %v", err)
+	}
+
+	// Requested by name, third-party packages are always found
+	if _, err := Locate(config, "mylib"); err != nil {
+		t.Errorf("Locate: %v", err)
+	}
+}